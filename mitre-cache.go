@@ -0,0 +1,333 @@
+// mitre-cache.go
+//
+// The bundle cache, one <collection>.json per domain (with the pinned
+// -attack-version or, for -bundle-url mirrors, a hash of the URL appended),
+// in -cache-dir. Bundles are stored as <collection>.json.gz (roughly a
+// tenth of the size); -cache-compress=false keeps a plain
+// <collection>.json for people who read the cache by hand.
+// Reads decompress transparently and take either form, preferring .gz, and
+// rewrite a copy in the other form to the configured one, so caches from
+// earlier versions are compressed on first use. The .sha256 sidecar always
+// describes the file on disk, so `sha256sum -c` keeps working for both
+// forms, while -checksum applies to the decompressed bundle as published.
+//
+// A cached copy older than -cache-ttl (by file mtime) is downloaded again,
+// except for a pinned release, which never changes; -refresh always
+// downloads; -cache-only and -offline never do. When a download fails the
+// stale copy is used with a warning.
+//
+// The ETag and Last-Modified of the download are kept in
+// <collection>.http.json, so re-checking a stale cache is a conditional
+// request: a 304 only touches the cache mtime. Servers that send neither
+// header get a plain download every time.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacyCacheDir is where versions before -cache-dir kept the cache,
+// relative to the working directory.
+const legacyCacheDir = ".mitre-cache"
+
+// cacheDir is set by setupCacheDir.
+var cacheDir = legacyCacheDir
+
+// setupCacheDir picks the cache directory: -cache-dir, MITRE_CACHE_DIR or
+// <user cache dir>/mitremit. With the default, a ./.mitre-cache left by an
+// older version is moved there (or, if that fails, used where it is). No
+// user cache directory, or one that can't be created, means a private one
+// under the temp dir (tempCacheDir); the run fails only if that can't be
+// made either. Nothing is created for -bundle-path runs, which never use
+// the cache.
+func setupCacheDir() error {
+	dir := *flagCacheDir
+	if dir == "" {
+		dir = os.Getenv("MITRE_CACHE_DIR")
+	}
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			cacheDir, err = tempCacheDir(fmt.Sprintf("no user cache directory (%v)", err))
+			return err
+		}
+		dir = filepath.Join(base, "mitremit")
+		if hasFiles(legacyCacheDir) && !hasFiles(dir) && *flagBundlePath == "" {
+			_ = os.Remove(dir) // an empty directory is in the way of the rename
+			err := os.MkdirAll(filepath.Dir(dir), 0o755)
+			if err == nil {
+				err = os.Rename(legacyCacheDir, dir)
+			}
+			if err != nil {
+				infof("using the old cache in ./%s (moving it to %s failed: %v)\n", legacyCacheDir, dir, err)
+				cacheDir = legacyCacheDir
+				return nil
+			}
+			infof("moved the bundle cache from ./%s to %s\n", legacyCacheDir, dir)
+		}
+	}
+	cacheDir = dir
+	debugf("cache directory: %s\n", cacheDir)
+	if *flagBundlePath != "" {
+		return nil
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		cacheDir, err = tempCacheDir(fmt.Sprintf("can't create cache directory %s (%v)", cacheDir, err))
+		return err
+	}
+	return nil
+}
+
+// tempCacheDir is the fallback cache directory, why the preferred one
+// can't be used: mitremit-cache-<uid> under the temp dir, created 0700 so
+// later runs reuse it. Anyone can create names in /tmp, so a directory that
+// is a symlink, belongs to another user or is writable by others is not
+// trusted with bundles and indexes; a fresh os.MkdirTemp one is used
+// instead, which lasts only for this run.
+func tempCacheDir(why string) (string, error) {
+	name := "mitremit-cache"
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	dir := filepath.Join(os.TempDir(), name)
+	err := os.Mkdir(dir, 0o700)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		var info os.FileInfo
+		if info, err = os.Lstat(dir); err == nil && (!info.IsDir() || !ownedByUser(info) || info.Mode().Perm()&0o022 != 0) {
+			err = fmt.Errorf("%s is not a private directory of this user", dir)
+		}
+	}
+	if err != nil {
+		debugf("temp cache directory: %v\n", err)
+		if dir, err = os.MkdirTemp("", name+"-"); err != nil {
+			return "", fmt.Errorf("%s, and no temp cache directory either: %w", why, err)
+		}
+	}
+	warnf("%s; using %s\n", why, dir)
+	return dir, nil
+}
+
+// hasFiles reports whether dir exists and holds anything.
+func hasFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
+// missingCacheError is the failure of a -cache-only or -offline run that
+// finds no cached bundle: which files were looked for and how to seed them.
+func missingCacheError(dom attackDomain) error {
+	mode := "-cache-only"
+	if *flagOffline {
+		mode = "-offline"
+	}
+	var seed string
+	if dom.Name != attackDomains[0].Name {
+		seed += " -domain " + dom.Name
+	}
+	if attackVersion != "" {
+		seed += " -attack-version " + attackVersion
+	}
+	if bundleURL != "" {
+		seed += " -bundle-url '" + bundleURL + "'" // the URL is part of the file name
+	}
+	return fmt.Errorf("no cached %s bundle and %s forbids downloading it (looked for %s and %s); "+
+		"seed it by copying %s.json.gz (or .json) from the cache directory of a connected host that ran `mitremit -list-mitigations%s`, "+
+		"or download %s and pass it with -bundle-path",
+		dom.Name, mode, cacheFile(dom, true), cacheFile(dom, false), dom.cacheName(), seed, dom.url())
+}
+
+// cacheFile is the cache path of dom, compressed or plain.
+func cacheFile(dom attackDomain, compressed bool) string {
+	path := filepath.Join(cacheDir, dom.cacheName()+".json")
+	if compressed {
+		path += ".gz"
+	}
+	return path
+}
+
+// cachedBundle is a usable cached copy of a bundle.
+type cachedBundle struct {
+	Data []byte        // decompressed
+	Path string        // file it was read from
+	Age  time.Duration // by file mtime
+}
+
+// readCachedBundle returns the cached bundle of dom, or nil if there is no
+// usable copy. A copy that doesn't decompress or fails validation (say one
+// truncated by a full disk) is removed with its sidecar and validators, so
+// the caller downloads the bundle again.
+func readCachedBundle(dom attackDomain) (*cachedBundle, error) {
+	for _, path := range []string{cacheFile(dom, true), cacheFile(dom, false)} {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		debugf("cached bundle found – %s\n", path)
+
+		data := raw
+		compressed := strings.HasSuffix(path, ".gz")
+		if compressed {
+			data, err = gunzip(raw)
+			if err != nil {
+				err = fmt.Errorf("cached bundle %s is not valid gzip: %w", path, err)
+			}
+		}
+		switch {
+		case err != nil:
+		case indexed(dom, bundleSum(data)):
+			debugf("cached bundle was parsed into %s before; not validating it again\n", indexPath(dom))
+		default:
+			err = validateBundle(data, "cached bundle")
+		}
+		if err != nil {
+			// A broken cache is replaced, not fatal
+			warnf("%v; downloading it again\n", err)
+			removeCachedFile(path)
+			_ = os.Remove(validatorsPath(dom))
+			continue
+		}
+
+		if err := checkSidecar(path, raw); err != nil {
+			return nil, err
+		}
+		if compressed != *flagCompressCache {
+			// Convert a cache in the other form (say a plain one left by
+			// an earlier version), keeping its mtime so the age stays right
+			if err := writeCachedBundle(dom, data); err != nil {
+				debugf("converting %s: %v\n", path, err)
+			} else {
+				path = cacheFile(dom, *flagCompressCache)
+				_ = os.Chtimes(path, info.ModTime(), info.ModTime())
+			}
+		}
+		return &cachedBundle{Data: data, Path: path, Age: time.Since(info.ModTime())}, nil
+	}
+	return nil, nil
+}
+
+// cacheStale reports whether a cached copy of this age must be downloaded
+// again. -cache-ttl 0 never expires the cache.
+func cacheStale(age time.Duration) bool {
+	return *flagCacheTTL > 0 && age > *flagCacheTTL
+}
+
+// formatAge renders a cache age for notes: "3 days", "5h12m".
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	case d >= time.Minute:
+		return strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	}
+	return "less than a minute"
+}
+
+// writeCachedBundle caches data for dom, gzipped under -compress-cache, and
+// removes the other form so a stale copy can't be picked up later.
+func writeCachedBundle(dom attackDomain, data []byte) error {
+	path, body := cacheFile(dom, false), data
+	if *flagCompressCache {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		path, body = cacheFile(dom, true), buf.Bytes()
+	}
+	// Temp file and rename: a run killed mid-write leaves the old copy
+	// (or none), never a truncated one
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(body)
+		return err
+	}); err != nil {
+		return err
+	}
+	removeCachedFile(cacheFile(dom, !*flagCompressCache))
+	debugf("cached %d bytes as %s\n", len(body), path)
+	return writeSidecar(path, body)
+}
+
+// touchCache marks a cached copy as fresh after a 304.
+func touchCache(c *cachedBundle) {
+	now := time.Now()
+	if err := os.Chtimes(c.Path, now, now); err != nil {
+		debugf("touching %s: %v\n", c.Path, err)
+	}
+	c.Age = 0
+}
+
+// httpValidators are the conditional-request headers of the cached download.
+type httpValidators struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func validatorsPath(dom attackDomain) string {
+	return filepath.Join(cacheDir, dom.cacheName()+".http.json")
+}
+
+// readValidators returns the stored validators of dom if they are for url;
+// a missing or unreadable file means an unconditional download.
+func readValidators(dom attackDomain, url string) httpValidators {
+	var v httpValidators
+	raw, err := os.ReadFile(validatorsPath(dom))
+	if err != nil || json.Unmarshal(raw, &v) != nil || v.URL != url {
+		return httpValidators{}
+	}
+	return v
+}
+
+// writeValidators stores v, or removes a stale file when the server sent
+// no validators.
+func writeValidators(dom attackDomain, v httpValidators) error {
+	if v.ETag == "" && v.LastModified == "" {
+		err := os.Remove(validatorsPath(dom))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(validatorsPath(dom), append(raw, '\n'), 0o644)
+}
+
+// removeCachedFile deletes a cache file and its sidecar; missing files are fine.
+func removeCachedFile(path string) {
+	_ = os.Remove(path)
+	_ = os.Remove(sidecarPath(path))
+}
+
+func gunzip(raw []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
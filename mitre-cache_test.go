@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTruncatedCacheIsReplaced(t *testing.T) {
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	for _, compressed := range []bool{false, true} {
+		name := "plain"
+		if compressed {
+			name = "gzip"
+		}
+		t.Run(name, func(t *testing.T) {
+			srv := serveBundle(t, raw)
+			dom := useBundleServer(t, srv)
+
+			// What a run killed mid-write left before writes were atomic
+			half := raw[:len(raw)/2]
+			if compressed {
+				half = gzipBytes(t, half)
+			}
+			path := cacheFile(dom, compressed)
+			if err := os.WriteFile(path, half, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := fetchBundle(dom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, raw) || srv.gets.Load() != 1 {
+				t.Fatalf("got %d bytes after %d downloads, want the bundle after 1", len(data), srv.gets.Load())
+			}
+			if !compressed {
+				if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("truncated %s not removed: %v", path, err)
+				}
+			}
+			cached, err := readCachedBundle(dom)
+			if err != nil || cached == nil || !bytes.Equal(cached.Data, raw) {
+				t.Errorf("cache not replaced: %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheForms(t *testing.T) {
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		file      bool // which form is on disk: compressed or not
+		body      []byte
+		compress  bool // -cache-compress
+		downloads int32
+	}{
+		{"legacy plain, converted", false, raw, true, 0},
+		{"gzip", true, gzipBytes(t, raw), true, 0},
+		{"gzip, kept plain", true, gzipBytes(t, raw), false, 0},
+		{"corrupt gzip", true, append(gzipBytes(t, raw)[:200], "not gzip"...), true, 1},
+		{"not gzip at all", true, raw, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveBundle(t, raw)
+			dom := useBundleServer(t, srv)
+			swap(t, flagCompressCache, tt.compress)
+			path := cacheFile(dom, tt.file)
+			if err := os.WriteFile(path, tt.body, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := fetchBundle(dom)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, raw) {
+				t.Errorf("got %d bytes, want the bundle", len(data))
+			}
+			if n := srv.gets.Load(); n != tt.downloads {
+				t.Errorf("%d downloads, want %d", n, tt.downloads)
+			}
+
+			// One file is left, in the configured form
+			want, other := cacheFile(dom, tt.compress), cacheFile(dom, !tt.compress)
+			info, err := os.Stat(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(other); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s left behind: %v", other, err)
+			}
+			if err := checkSidecar(want, mustRead(t, want)); err != nil {
+				t.Error(err)
+			}
+			// A conversion keeps the age; a download is new
+			if tt.downloads == 0 && !info.ModTime().Equal(old) {
+				t.Errorf("converted cache has mtime %v, want %v", info.ModTime(), old)
+			}
+		})
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestTempCacheDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no uid in the name, and the temp dir is per user")
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	swap(t, &verbosity, levelError)
+	mine := filepath.Join(tmp, "mitremit-cache-"+strconv.Itoa(os.Getuid()))
+
+	// Created private, then reused
+	for i := 0; i < 2; i++ {
+		dir, err := tempCacheDir("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dir != mine || info.Mode().Perm() != 0o700 {
+			t.Errorf("run %d: %s %v, want %s 0700", i, dir, info.Mode().Perm(), mine)
+		}
+	}
+
+	// Planted by someone else: writable by others, or a symlink
+	if err := os.Chmod(mine, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	other := t.TempDir()
+	for _, tc := range []struct {
+		name  string
+		plant func() error
+	}{
+		{"world-writable", func() error { return nil }},
+		{"symlink", func() error {
+			if err := os.Remove(mine); err != nil {
+				return err
+			}
+			return os.Symlink(other, mine)
+		}},
+	} {
+		if err := tc.plant(); err != nil {
+			t.Fatal(err)
+		}
+		dir, err := tempCacheDir("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dir == mine || filepath.Dir(dir) != tmp {
+			t.Errorf("%s: got %s, want a new directory under %s", tc.name, dir, tmp)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// mitre-checksum.go
+//
+// SHA-256 checks on the ATT&CK bundle. -checksum HEX pins the expected hash:
+// a download that doesn't match is neither cached nor used, and neither is
+// -bundle-path. A cached copy that doesn't match is downloaded again (the
+// checksum of a new release, with or without -refresh). Every cached bundle gets a sha256sum-style
+// sidecar (enterprise-attack.json.sha256) so later runs notice a cache that
+// changed behind our back.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+func bundleChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastSum is the bundle bundleSum hashed last, and its checksum.
+var lastSum struct {
+	sync.Mutex
+	data []byte
+	sum  string
+}
+
+// bundleSum is bundleChecksum for a bundle the run works on. The cache
+// check, -checksum and the index lookup all need the sum of the same tens
+// of MB, so it is computed once per bundle.
+func bundleSum(data []byte) string {
+	lastSum.Lock()
+	defer lastSum.Unlock()
+	if len(data) > 0 && len(lastSum.data) == len(data) && &lastSum.data[0] == &data[0] {
+		return lastSum.sum
+	}
+	lastSum.data, lastSum.sum = data, bundleChecksum(data)
+	return lastSum.sum
+}
+
+// verifyChecksum compares data against -checksum; an empty flag passes.
+func verifyChecksum(data []byte, what string) error {
+	want := strings.ToLower(strings.TrimSpace(*flagChecksum))
+	got := bundleSum(data)
+	debugf("sha256 of %s: %s\n", what, got)
+	if want == "" {
+		return nil
+	}
+	if len(want) != sha256.Size*2 || strings.Trim(want, "0123456789abcdef") != "" {
+		return fmt.Errorf("-checksum must be %d hex digits", sha256.Size*2)
+	}
+	if got != want {
+		return &checksumMismatchError{What: what, Got: got, Want: want}
+	}
+	return nil
+}
+
+// checksumMismatchError is a bundle that doesn't match -checksum, as opposed
+// to a malformed -checksum.
+type checksumMismatchError struct {
+	What, Got, Want string
+}
+
+func (e *checksumMismatchError) Error() string {
+	return fmt.Sprintf("%s sha256 %s does not match -checksum %s", e.What, e.Got, e.Want)
+}
+
+func sidecarPath(bundlePath string) string {
+	return bundlePath + ".sha256"
+}
+
+// writeSidecar records the checksum of a freshly cached bundle.
+func writeSidecar(bundlePath string, data []byte) error {
+	line := fmt.Sprintf("%s  %s\n", bundleChecksum(data), filepath.Base(bundlePath))
+	return os.WriteFile(sidecarPath(bundlePath), []byte(line), 0o644)
+}
+
+// checkSidecar verifies a cached bundle against its sidecar. Caches from
+// before sidecars existed get one written now.
+func checkSidecar(bundlePath string, data []byte) error {
+	raw, err := os.ReadFile(sidecarPath(bundlePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return writeSidecar(bundlePath, data)
+	}
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s is empty", sidecarPath(bundlePath))
+	}
+	if got := bundleChecksum(data); got != strings.ToLower(fields[0]) {
+		return fmt.Errorf("cached bundle %s changed since it was downloaded (sha256 %s, %s says %s); delete both files to re-download",
+			bundlePath, got, sidecarPath(bundlePath), fields[0])
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestFetchBundleChecksumMismatchedCache(t *testing.T) {
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	srv := serveBundle(t, raw)
+	dom := useBundleServer(t, srv)
+
+	// A cached copy of another release
+	old := append([]byte(nil), raw...)
+	old = append(old, '\n')
+	if err := writeCachedBundle(dom, old); err != nil {
+		t.Fatal(err)
+	}
+
+	swap(t, flagChecksum, bundleChecksum(raw))
+	for _, refresh := range []bool{false, true} {
+		swap(t, flagRefresh, refresh)
+		data, err := fetchBundle(dom)
+		if err != nil {
+			t.Fatalf("-refresh=%v: %v", refresh, err)
+		}
+		if bundleChecksum(data) != bundleChecksum(raw) {
+			t.Errorf("-refresh=%v: got the cached copy", refresh)
+		}
+		if err := writeCachedBundle(dom, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.gets.Load(); n != 2 {
+		t.Errorf("%d downloads, want 2", n)
+	}
+
+	// Without the network the mismatch stays an error
+	swap(t, flagRefresh, false)
+	swap(t, flagOffline, true)
+	if _, err := fetchBundle(dom); err == nil {
+		t.Error("-offline: mismatched cache accepted")
+	}
+}
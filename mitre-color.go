@@ -0,0 +1,71 @@
+// mitre-color.go
+//
+// ANSI colours for terminal output. Controlled by -color=auto|always|never
+// and the NO_COLOR convention (https://no-color.org). Machine formats
+// (JSON, CSV, ...) never call into this file.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// palette colours text for one output stream; the zero value is disabled.
+//
+// Every code is exactly five bytes ("\x1b[NNm") so cells of a tabwriter
+// column that are all wrapped stay aligned – tabwriter counts the escape
+// bytes as width.
+type palette struct {
+	enabled bool
+}
+
+const (
+	sgrBold    = "\x1b[01m"
+	sgrDim     = "\x1b[02m"
+	sgrRed     = "\x1b[31m"
+	sgrGreen   = "\x1b[32m"
+	sgrYellow  = "\x1b[33m"
+	sgrBlue    = "\x1b[34m"
+	sgrMagenta = "\x1b[35m"
+	sgrCyan    = "\x1b[36m"
+	sgrPlain   = "\x1b[00m" // explicit "no style", keeps widths equal
+	sgrReset   = "\x1b[0m"
+)
+
+func (p palette) wrap(code, s string) string {
+	if !p.enabled {
+		return s
+	}
+	return code + s + sgrReset
+}
+
+func (p palette) plain(s string) string  { return p.wrap(sgrPlain, s) }
+func (p palette) bold(s string) string   { return p.wrap(sgrBold, s) }
+func (p palette) red(s string) string    { return p.wrap(sgrRed, s) }
+func (p palette) green(s string) string  { return p.wrap(sgrGreen, s) }
+func (p palette) yellow(s string) string { return p.wrap(sgrYellow, s) }
+func (p palette) cyan(s string) string   { return p.wrap(sgrCyan, s) }
+func (p palette) dim(s string) string    { return p.wrap(sgrDim, s) }
+
+// Colours for stdout (tables) and stderr (summaries), set by setupColors.
+var colorOut, colorErr palette
+
+// setupColors resolves -color for both streams. "auto" colours a stream only
+// when it is a terminal and NO_COLOR is unset.
+func setupColors(mode string) error {
+	switch mode {
+	case "always":
+		colorOut, colorErr = palette{true}, palette{true}
+	case "never":
+		colorOut, colorErr = palette{}, palette{}
+	case "auto":
+		noColor := os.Getenv("NO_COLOR") != ""
+		colorOut = palette{!noColor && isTerminal(os.Stdout)}
+		colorErr = palette{!noColor && isTerminal(os.Stderr)}
+	default:
+		return fmt.Errorf("invalid -color %q (use auto, always or never)", mode)
+	}
+	return nil
+}
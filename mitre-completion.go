@@ -0,0 +1,195 @@
+// mitre-completion.go
+//
+// -completion bash|zsh|fish (hidden): print a tab-completion script for the
+// shell. The flag list comes from the flag set and the values of -format,
+// -domain, -only-domain, -sort, -log-level and friends from the same tables
+// the flags are checked against, so the script matches the binary that
+// wrote it; regenerate it after an upgrade. Deprecated flags are left out.
+//
+// Install:
+//
+//	bash: mitremit -completion bash > /etc/bash_completion.d/mitremit
+//	      (or: source <(mitremit -completion bash) in ~/.bashrc)
+//	zsh:  mitremit -completion zsh > "${fpath[1]}/_mitremit"
+//	      (then start a new shell; compinit must be enabled)
+//	fish: mitremit -completion fish > ~/.config/fish/completions/mitremit.fish
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionValues are the values offered after flags with a fixed set.
+func completionValues() map[string][]string {
+	var domains, collections []string
+	for _, d := range attackDomains {
+		domains = append(domains, d.Name)
+		collections = append(collections, d.Collection)
+	}
+	var sorts []string
+	for _, key := range []string{"id", "name", "tactic"} {
+		sorts = append(sorts, key, "-"+key)
+	}
+	return map[string][]string{
+		"format":      outputFormats,
+		"domain":      domains,
+		"only-domain": collections,
+		"color":       {"auto", "always", "never"},
+		"sort":        sorts,
+		"group-by":    {"tactic"},
+		"sql-dialect": sqlDialects,
+		"log-level":   logLevelNames,
+	}
+}
+
+// completionFiles are the flags that take a path; true for a directory.
+var completionFiles = map[string]bool{
+	"bundle-path":   false,
+	"checksum":      false,
+	"output":        false,
+	"xlsx":          false,
+	"stix":          false,
+	"dot":           false,
+	"graphml":       false,
+	"template":      false,
+	"ngql-file":     false,
+	"metrics-out":   false,
+	"history-stats": false,
+	"importer-dir":  true,
+	"cache-dir":     true,
+}
+
+type completionFlag struct {
+	Name   string
+	Desc   string
+	Bool   bool
+	Values []string
+}
+
+// completionFlags lists the flags to complete, sorted by name.
+func completionFlags() []completionFlag {
+	values := completionValues()
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Usage == "" || strings.HasPrefix(f.Usage, "Deprecated") {
+			return // hidden
+		}
+		// First sentence only; "e.g. " doesn't end one
+		desc := strings.ReplaceAll(f.Usage, "e.g. ", "e.g.\x00")
+		if i := strings.Index(desc, ". "); i > 0 {
+			desc = desc[:i]
+		}
+		desc = strings.ReplaceAll(desc, "\x00", " ")
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			Name:   f.Name,
+			Desc:   strings.TrimSuffix(desc, "."),
+			Bool:   ok && b.IsBoolFlag(),
+			Values: values[f.Name],
+		})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// writeCompletion prints the script for shell; prog is the command name
+// the completion is registered for.
+func writeCompletion(out io.Writer, shell, prog string) error {
+	flags := completionFlags()
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, prog)
+	switch shell {
+	case "bash":
+		writeBashCompletion(out, flags, prog, fn)
+	case "zsh":
+		writeZshCompletion(out, flags, prog, fn)
+	case "fish":
+		writeFishCompletion(out, flags, prog)
+	default:
+		return fmt.Errorf("invalid -completion %q (use %s)", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+func writeBashCompletion(out io.Writer, flags []completionFlag, prog, fn string) {
+	fmt.Fprintf(out, "# bash completion for %s – generated by %s -completion bash\n", prog, prog)
+	fmt.Fprintf(out, "%s() {\n", fn)
+	fmt.Fprintln(out, `	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}`)
+	// ${prev/#--/-} turns --flag into -flag; Go accepts both
+	fmt.Fprintln(out, `	case ${prev/#--/-} in`)
+	var names, valueFlags []string
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+		switch dir, file := completionFiles[f.Name]; {
+		case f.Values != nil:
+			fmt.Fprintf(out, "	%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", "-"+f.Name, strings.Join(f.Values, " "))
+		case file && dir:
+			fmt.Fprintf(out, "	%s) COMPREPLY=($(compgen -d -- \"$cur\")); return ;;\n", "-"+f.Name)
+		case file:
+			fmt.Fprintf(out, "	%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", "-"+f.Name)
+		case !f.Bool:
+			valueFlags = append(valueFlags, "-"+f.Name)
+		}
+	}
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(out, "	%s) return ;;\n", strings.Join(valueFlags, "|"))
+	}
+	fmt.Fprintln(out, `	esac`)
+	fmt.Fprintf(out, "	COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(out, `}`)
+	fmt.Fprintf(out, "complete -F %s %s\n", fn, prog)
+}
+
+func writeZshCompletion(out io.Writer, flags []completionFlag, prog, fn string) {
+	// Inside '...': a quote is '\'' and [ ] : are escaped for _arguments
+	quote := strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`)
+	fmt.Fprintf(out, "#compdef %s\n# zsh completion for %s – generated by %s -completion zsh\n\n", prog, prog, prog)
+	fmt.Fprintf(out, "%s() {\n\t_arguments \\\n", fn)
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.Name, quote.Replace(f.Desc))
+		switch dir, file := completionFiles[f.Name]; {
+		case f.Values != nil:
+			spec += fmt.Sprintf(":%s:(%s)", f.Name, strings.Join(f.Values, " "))
+		case file && dir:
+			spec += ":directory:_files -/"
+		case file:
+			spec += ":file:_files"
+		case !f.Bool:
+			spec += ":" + f.Name + ": "
+		}
+		fmt.Fprintf(out, "\t\t'%s' \\\n", spec)
+	}
+	fmt.Fprintln(out, "\t\t'1:command:(doctor)'")
+	fmt.Fprintln(out, "}")
+	fmt.Fprintf(out, "\nif [ \"$funcstack[1]\" = %q ]; then\n\t%s \"$@\"\nelse\n\tcompdef %s %s\nfi\n", fn, fn, fn, prog)
+}
+
+func writeFishCompletion(out io.Writer, flags []completionFlag, prog string) {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	fmt.Fprintf(out, "# fish completion for %s – generated by %s -completion fish\n", prog, prog)
+	fmt.Fprintf(out, "complete -c %s -f -n __fish_is_first_arg -a doctor -d 'Run pre-flight checks'\n", prog)
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c %s -o %s -d '%s'", prog, f.Name, quote.Replace(f.Desc))
+		switch _, file := completionFiles[f.Name]; {
+		case f.Values != nil:
+			line += fmt.Sprintf(" -x -a '%s'", strings.Join(f.Values, " "))
+		case file:
+			line += " -r -F"
+		case !f.Bool:
+			line += " -x"
+		}
+		fmt.Fprintln(out, line)
+	}
+}
@@ -0,0 +1,82 @@
+// mitre-cypher.go
+//
+// -cypher: the -ngql script as Neo4j MERGE statements, one per line and
+// terminated with ';' for cypher-shell. MERGE is idempotent, so there is no
+// missing-technique check and no database connection.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var cypherReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// cypherLiteral quotes s as a double-quoted Cypher string.
+func cypherLiteral(s string) string {
+	return `"` + cypherReplacer.Replace(s) + `"`
+}
+
+// generateCypher mirrors generateNGQL with Technique, Mitigation and Tactic
+// nodes and MITIGATES, HAS_SUBTECHNIQUE and PART_OF relationships.
+func generateCypher(mitigationID, mitigationName string, techniques []techniqueInfo) string {
+	var b strings.Builder
+	node := func(label, id string) string {
+		return fmt.Sprintf("(%s {id:%s})", label, cypherLiteral(id))
+	}
+
+	b.WriteString("// ============================================================\n")
+	b.WriteString(fmt.Sprintf("// Cypher script for mitigation %s (%s)\n", mitigationID, mitigationName))
+	b.WriteString(fmt.Sprintf("// Data: %s\n", bundleRelease))
+	b.WriteString("// ============================================================\n\n")
+
+	b.WriteString("// Recommended uniqueness constraints (Neo4j 5):\n")
+	for _, label := range []string{"Mitigation", "Technique", "Tactic"} {
+		b.WriteString(fmt.Sprintf("// CREATE CONSTRAINT %s_id IF NOT EXISTS FOR (n:%s) REQUIRE n.id IS UNIQUE;\n", strings.ToLower(label), label))
+	}
+
+	b.WriteString("\n// Mitigation and techniques\n")
+	b.WriteString(fmt.Sprintf("MERGE (m:Mitigation {id:%s}) SET m.name = %s;\n", cypherLiteral(mitigationID), cypherLiteral(mitigationName)))
+	for _, t := range techniques {
+		b.WriteString(fmt.Sprintf("MERGE (t:Technique {id:%s}) SET t.name = %s;\n", cypherLiteral(t.ExternalID), cypherLiteral(t.Name)))
+	}
+
+	b.WriteString("\n// HAS_SUBTECHNIQUE (parent to sub-technique)\n")
+	for _, t := range techniques {
+		if isSubtechnique(t.ExternalID) {
+			b.WriteString(fmt.Sprintf("MERGE %s MERGE %s MERGE (p)-[:HAS_SUBTECHNIQUE]->(s);\n",
+				node("p:Technique", getParentTechniqueID(t.ExternalID)), node("s:Technique", t.ExternalID)))
+		}
+	}
+
+	b.WriteString("\n// PART_OF (technique to tactic)\n")
+	for _, t := range techniques {
+		for _, phase := range t.Tactics {
+			tacticID, ok := tacticPhaseToID[phase]
+			if !ok {
+				b.WriteString(fmt.Sprintf("// WARNING: %s tactic phase %q has no tactic ID; PART_OF skipped\n", t.ExternalID, phase))
+				continue
+			}
+			b.WriteString(fmt.Sprintf("MERGE %s MERGE (ta:Tactic {id:%s}) SET ta.shortname = %s MERGE (t)-[:PART_OF]->(ta);\n",
+				node("t:Technique", t.ExternalID), cypherLiteral(tacticID), cypherLiteral(phase)))
+		}
+	}
+
+	b.WriteString("\n// MITIGATES (mitigation to techniques)\n")
+	for _, t := range techniques {
+		b.WriteString(fmt.Sprintf("MERGE %s MERGE %s MERGE (m)-[:MITIGATES {domain:%s}]->(t);\n",
+			node("m:Mitigation", mitigationID), node("t:Technique", t.ExternalID), cypherLiteral(t.Domain)))
+	}
+
+	b.WriteString(fmt.Sprintf("\n// Verify: MATCH (:Mitigation {id:%s})-[r:MITIGATES]->() RETURN count(r); // expected %d\n",
+		cypherLiteral(mitigationID), len(techniques)))
+	return b.String()
+}
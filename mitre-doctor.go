@@ -0,0 +1,313 @@
+// mitre-doctor.go
+//
+// `mitremit doctor` / `-doctor`: run every pre-flight check a real run
+// depends on, in order, and say what to fix. Each check goes through the
+// same code the tool uses (fetchBundle, parseBundle, connectNebula, ...), so
+// a green doctor means a run will get at least that far.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	nebula "github.com/vesoft-inc/nebula-go/v3"
+)
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip"
+)
+
+type doctorCheck struct {
+	Name   string      `json:"name"`
+	Status checkStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Hint   string      `json:"hint,omitempty"`
+}
+
+// runDoctor executes all checks and returns them in order. Checks that depend
+// on an earlier failed one are reported as skipped.
+func runDoctor(g graphNames) []doctorCheck {
+	var checks []doctorCheck
+	add := func(c doctorCheck) { checks = append(checks, c) }
+
+	// 1. cache directory
+	add(checkCacheDir())
+
+	// 2. bundle availability / version
+	for _, dom := range loadedDomains {
+		add(checkBundle(dom))
+	}
+
+	// 3. configuration
+	cfg := getNebulaConfig()
+	add(checkConfig(cfg))
+
+	// 4-5. connectivity and space
+	session, cleanup, err := connectNebula(cfg)
+	switch {
+	case err == nil:
+		defer cleanup()
+		add(doctorCheck{Name: "nebula connectivity", Status: checkPass, Detail: fmt.Sprintf("%s:%d as %s", cfg.Host, cfg.Port, cfg.User)})
+		add(doctorCheck{Name: "space", Status: checkPass, Detail: cfg.Space})
+	case errors.Is(err, errSpaceUnusable):
+		add(doctorCheck{Name: "nebula connectivity", Status: checkPass, Detail: fmt.Sprintf("%s:%d as %s", cfg.Host, cfg.Port, cfg.User)})
+		add(doctorCheck{Name: "space", Status: checkFail, Detail: err.Error(),
+			Hint: fmt.Sprintf("create it (CREATE SPACE %s ...) or set NEBULA_SPACE to an existing space", cfg.Space)})
+	default:
+		add(doctorCheck{Name: "nebula connectivity", Status: checkFail, Detail: err.Error(),
+			Hint: "check NEBULA_HOST/NEBULA_PORT, that graphd is running, and NEBULA_USER/NEBULA_PASS"})
+		add(doctorCheck{Name: "space", Status: checkSkip})
+	}
+
+	if session == nil {
+		for _, name := range []string{"schema", "write permission", "vid type"} {
+			add(doctorCheck{Name: name, Status: checkSkip})
+		}
+		return checks
+	}
+
+	// 6-8. schema, permissions, VID type
+	add(checkSchema(session, g))
+	add(checkWritePermission(session, cfg))
+	add(checkVIDType(session, cfg.Space))
+	return checks
+}
+
+func checkCacheDir() doctorCheck {
+	c := doctorCheck{Name: "cache directory", Detail: cacheDir}
+	if *flagBundlePath != "" {
+		c.Status, c.Detail = checkSkip, "not used with -bundle-path"
+		return c
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "point -cache-dir or MITRE_CACHE_DIR at a writable directory"
+		return c
+	}
+	f, err := os.CreateTemp(cacheDir, ".doctor-*")
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "make " + cacheDir + " writable, or point -cache-dir or MITRE_CACHE_DIR elsewhere"
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	c.Status = checkPass
+	return c
+}
+
+// checkBundle fetches and parses the bundle of dom as a run does
+// (fetchBundle, then parseBundle) and reports its release and the objects
+// the parser had to skip.
+func checkBundle(dom attackDomain) doctorCheck {
+	c := doctorCheck{Name: "ATT&CK bundle"}
+	if multiDomain() {
+		c.Name += " (" + dom.Name + ")"
+	}
+	raw, err := fetchBundle(dom)
+	if err != nil {
+		c.Status, c.Detail = checkFail, err.Error()
+		c.Hint = "check network access to " + dom.url() + " or seed " + cacheDir
+		switch {
+		case *flagBundlePath != "":
+			c.Hint = "check the -bundle-path path"
+		case *flagOffline:
+			c.Hint = "seed " + cacheDir + " as the error says, or drop -offline"
+		}
+		return c
+	}
+
+	// A broken bundle comes from -bundle-path or else the cache
+	freshCopy := "re-run with -refresh to download a fresh copy"
+	if *flagBundlePath != "" {
+		freshCopy = "replace the -bundle-path file with a fresh download of " + dom.url()
+	}
+	data, err := parseBundle(bytes.NewReader(raw), false, nil)
+	if err != nil {
+		c.Status, c.Detail, c.Hint = checkFail, err.Error(), freshCopy
+		return c
+	}
+	if err := checkPinnedRelease(dom, data.Release); err != nil {
+		c.Status, c.Detail, c.Hint = checkFail, err.Error(), "check -attack-version and the bundle source"
+		return c
+	}
+
+	c.Status = checkPass
+	c.Detail = fmt.Sprintf("%d objects, STIX %s, %s", data.Objects, data.stixVersion(), data.release())
+	switch {
+	case data.Objects == 0:
+		c.Status, c.Hint = checkFail, "bundle has no objects; "+freshCopy
+	case data.skipCount() > 0:
+		c.Status = checkWarn
+		if *flagStrict {
+			c.Status = checkFail
+		}
+		c.Detail += fmt.Sprintf(", %d malformed objects skipped", data.skipCount())
+		c.Hint = strings.Join(data.skipWarnings(), "; ")
+	}
+	return c
+}
+
+func checkConfig(cfg nebulaConfig) doctorCheck {
+	c := doctorCheck{Name: "configuration", Status: checkPass,
+		Detail: fmt.Sprintf("host=%s port=%d user=%s space=%s", cfg.Host, cfg.Port, cfg.User, cfg.Space)}
+
+	var notes []string
+	if v := os.Getenv("NEBULA_PORT"); v != "" {
+		if _, err := strconv.Atoi(v); err != nil {
+			c.Status = checkFail
+			notes = append(notes, fmt.Sprintf("NEBULA_PORT=%q is not a number (using %d)", v, cfg.Port))
+		}
+	}
+	for _, key := range []string{"NEBULA_HOST", "NEBULA_USER", "NEBULA_PASS", "NEBULA_SPACE"} {
+		if os.Getenv(key) == "" {
+			notes = append(notes, key+" unset, using default")
+		}
+	}
+	if len(notes) > 0 {
+		if c.Status == checkPass {
+			c.Status = checkWarn
+		}
+		c.Hint = strings.Join(notes, "; ")
+	}
+	return c
+}
+
+func checkSchema(session *nebula.Session, g graphNames) doctorCheck {
+	c := doctorCheck{Name: "schema"}
+	var missing []string
+	for _, stmt := range []string{
+		"DESCRIBE TAG " + g.TechniqueTag + ";",
+		"DESCRIBE TAG " + g.MitigationTag + ";",
+		"DESCRIBE EDGE " + g.MitigatesEdge + ";",
+		"DESCRIBE EDGE " + g.SubtechniqueEdge + ";",
+		"DESCRIBE EDGE " + g.PartOfEdge + ";",
+	} {
+		result, err := session.Execute(stmt)
+		if err != nil || !result.IsSucceed() {
+			missing = append(missing, strings.TrimSuffix(strings.TrimPrefix(stmt, "DESCRIBE "), ";"))
+		}
+	}
+	if len(missing) > 0 {
+		c.Status, c.Detail = checkFail, "missing: "+strings.Join(missing, ", ")
+		c.Hint = "create the missing tags/edges in the space before loading"
+		return c
+	}
+	c.Status, c.Detail = checkPass, "tags and edge types present"
+	return c
+}
+
+func checkWritePermission(session *nebula.Session, cfg nebulaConfig) doctorCheck {
+	c := doctorCheck{Name: "write permission"}
+	if cfg.User == "root" {
+		c.Status, c.Detail = checkPass, "root (GOD role)"
+		return c
+	}
+
+	result, err := session.Execute(fmt.Sprintf("SHOW ROLES IN %s;", cfg.Space))
+	if err != nil || !result.IsSucceed() {
+		c.Status, c.Detail = checkWarn, "could not read roles"
+		c.Hint = "ask an admin to confirm " + cfg.User + " has USER role or higher in " + cfg.Space
+		return c
+	}
+
+	for i := 0; i < result.GetRowSize(); i++ {
+		record, err := result.GetRowValuesByIndex(i)
+		if err != nil {
+			continue
+		}
+		account, _ := record.GetValueByIndex(0)
+		role, _ := record.GetValueByIndex(1)
+		name, _ := account.AsString()
+		roleName, _ := role.AsString()
+		if name != cfg.User {
+			continue
+		}
+		if strings.EqualFold(roleName, "GUEST") {
+			c.Status, c.Detail = checkFail, "role GUEST is read-only"
+			c.Hint = fmt.Sprintf("GRANT ROLE USER ON %s TO %s;", cfg.Space, cfg.User)
+			return c
+		}
+		c.Status, c.Detail = checkPass, "role "+roleName
+		return c
+	}
+
+	c.Status, c.Detail = checkFail, "no role in "+cfg.Space
+	c.Hint = fmt.Sprintf("GRANT ROLE USER ON %s TO %s;", cfg.Space, cfg.User)
+	return c
+}
+
+// minVIDLength is the longest vertex ID written: a sub-technique ID.
+const minVIDLength = len("T1234.567")
+
+func checkVIDType(session *nebula.Session, space string) doctorCheck {
+	c := doctorCheck{Name: "vid type"}
+	result, err := session.Execute(fmt.Sprintf("DESCRIBE SPACE %s;", space))
+	if err != nil || !result.IsSucceed() || result.GetRowSize() == 0 {
+		c.Status, c.Detail = checkWarn, "could not describe space"
+		return c
+	}
+	record, err := result.GetRowValuesByIndex(0)
+	if err != nil {
+		c.Status, c.Detail = checkWarn, err.Error()
+		return c
+	}
+	val, err := record.GetValueByColName("Vid Type")
+	if err != nil {
+		c.Status, c.Detail = checkWarn, err.Error()
+		return c
+	}
+	vidType, _ := val.AsString()
+	c.Detail = vidType
+
+	m := fixedStringType.FindStringSubmatch(strings.TrimSpace(vidType))
+	if m == nil {
+		c.Status = checkFail
+		c.Hint = "ATT&CK IDs are strings; the space needs vid_type = FIXED_STRING(n)"
+		return c
+	}
+	if n, _ := strconv.Atoi(m[1]); n < minVIDLength {
+		c.Status = checkFail
+		c.Hint = fmt.Sprintf("FIXED_STRING is too short for sub-technique IDs; use at least FIXED_STRING(%d)", minVIDLength)
+		return c
+	}
+	c.Status = checkPass
+	return c
+}
+
+/*
+-------------------------------------------------------------
+Rendering
+-------------------------------------------------------------
+*/
+
+// doctorFailed reports whether any blocking check failed.
+func doctorFailed(checks []doctorCheck) bool {
+	for _, c := range checks {
+		if c.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+func printDoctor(out io.Writer, checks []doctorCheck) {
+	for _, c := range checks {
+		fmt.Fprintf(out, "[%s] %-20s %s\n", strings.ToUpper(string(c.Status)), c.Name, c.Detail)
+		if c.Hint != "" {
+			fmt.Fprintf(out, "       %-20s → %s\n", "", c.Hint)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckBundle(t *testing.T) {
+	swap(t, &verbosity, levelError)
+	swap(t, &attackVersion, "")
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	// One technique whose kill_chain_phases doesn't decode
+	broken := bytes.Replace(raw, []byte(`"kill_chain_phases": [`), []byte(`"kill_chain_phases": "x", "unused": [`), 1)
+	if bytes.Equal(broken, raw) {
+		t.Fatal("fixture has no kill_chain_phases to break")
+	}
+
+	for _, tc := range []struct {
+		name   string
+		bundle []byte
+		strict bool
+		status checkStatus
+		detail string
+	}{
+		{"clean", raw, false, checkPass, "128 objects, STIX 2.1, Enterprise ATT&CK v16.1"},
+		{"skipped", broken, false, checkWarn, "1 malformed objects skipped"},
+		{"skipped -strict", broken, true, checkFail, "1 malformed objects skipped"},
+		{"truncated", raw[:len(raw)/2], false, checkFail, ""},
+	} {
+		path := filepath.Join(t.TempDir(), "bundle.json")
+		if err := os.WriteFile(path, tc.bundle, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		swap(t, flagBundlePath, path)
+		swap(t, flagStrict, tc.strict)
+		c := checkBundle(attackDomains[0])
+		if c.Status != tc.status || !strings.Contains(c.Detail, tc.detail) {
+			t.Errorf("%s: %s %q, want %s with %q", tc.name, c.Status, c.Detail, tc.status, tc.detail)
+		}
+		if strings.Contains(c.Hint, cacheDir) {
+			t.Errorf("%s: hint %q names the cache, which -bundle-path doesn't use", tc.name, c.Hint)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+// mitre-domain.go
+//
+// -domain enterprise,ics,mobile: load several ATT&CK domain bundles and merge
+// them into one attackData. Objects are deduplicated by STIX ID (mitigations
+// such as M1013 are shared between domains); when two bundles disagree the
+// object with the newest "modified" wins. Each object remembers the domain
+// of the bundle it came from, so mitigates edges carry the right domain
+// instead of a hard-coded "Enterprise".
+//
+// -attack-version 15.1 pins the release: bundles come from the versioned
+// files in mitre-attack/attack-stix-data (<collection>-15.1.json) instead
+// of mitre/cti master, and each version is cached under its own name.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// attackDomain is one ATT&CK matrix as published in mitre/cti.
+type attackDomain struct {
+	Name       string // -domain value
+	Label      string // written to the graph and shown in output
+	Collection string // mitre/cti directory and file name
+}
+
+var attackDomains = []attackDomain{
+	{"enterprise", "Enterprise", "enterprise-attack"},
+	{"ics", "ICS", "ics-attack"},
+	{"mobile", "Mobile", "mobile-attack"},
+}
+
+// loadedDomains are the domains of this run, set from -domain in main.
+var loadedDomains = attackDomains[:1]
+
+// bundleURL replaces the mitre/cti download URL when set (-bundle-url,
+// MITRE_BUNDLE_URL); "{collection}" in it becomes the domain's collection
+// name, so one mirror URL can serve several domains, and "{version}" the
+// -attack-version.
+var bundleURL string
+
+// attackVersion is the pinned ATT&CK release ("15.1"), set from
+// -attack-version in main; "" follows mitre/cti master.
+var attackVersion string
+
+func (d attackDomain) url() string {
+	if bundleURL != "" {
+		return strings.NewReplacer("{collection}", d.Collection, "{version}", attackVersion).Replace(bundleURL)
+	}
+	if attackVersion != "" {
+		return "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/" +
+			d.Collection + "/" + d.Collection + "-" + attackVersion + ".json"
+	}
+	return "https://raw.githubusercontent.com/mitre/cti/master/" + d.Collection + "/" + d.Collection + ".json"
+}
+
+// cacheName is the cache file name (without extension) of the domain's
+// bundle. Mirrors get a hash of their URL in it, so switching -bundle-url
+// never serves another source's copy; a pinned version is part of the name
+// ("enterprise-attack-15.1"), so switching -attack-version never serves
+// another release's.
+func (d attackDomain) cacheName() string {
+	if bundleURL == "" {
+		if attackVersion != "" {
+			return d.Collection + "-" + attackVersion
+		}
+		return d.Collection
+	}
+	sum := sha256.Sum256([]byte(d.url()))
+	return d.Collection + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// checkBundleURL rejects a -bundle-url that isn't an absolute http(s) URL,
+// or one without {collection} when several domains are loaded.
+func checkBundleURL(raw string, domains []attackDomain) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid -bundle-url %q (need an http:// or https:// URL)", raw)
+	}
+	if len(domains) > 1 && !strings.Contains(raw, "{collection}") {
+		return fmt.Errorf("-bundle-url %s names one bundle; put {collection} in it to load several domains", raw)
+	}
+	if attackVersion != "" && !strings.Contains(raw, "{version}") {
+		return fmt.Errorf("-bundle-url %s has no {version}; put it in the URL to use -attack-version", raw)
+	}
+	return nil
+}
+
+// knownAttackVersions are the ATT&CK releases published when this was
+// written, oldest first. Only used to suggest a version when the requested
+// one isn't found and attack-stix-data's index.json can't be read.
+var knownAttackVersions = []string{
+	"1.0", "2.0", "3.0", "4.0", "5.0", "5.1", "5.2", "6.0", "6.1", "6.2", "6.3",
+	"7.0", "7.1", "7.2", "8.0", "8.1", "8.2", "9.0", "10.0", "10.1",
+	"11.0", "11.1", "11.2", "11.3", "12.0", "12.1", "13.0", "13.1",
+	"14.0", "14.1", "15.0", "15.1", "16.0", "16.1", "17.0", "17.1",
+	"18.0", "18.1",
+}
+
+// attackIndexURL lists every release in attack-stix-data.
+var attackIndexURL = "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/index.json"
+
+// publishedAttackVersions reads the releases of dom from attackIndexURL,
+// oldest first.
+func publishedAttackVersions(dom attackDomain) ([]string, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, attackIndexURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", attackIndexURL, resp.StatusCode)
+	}
+	var index struct {
+		Collections []struct {
+			Versions []struct {
+				Version string `json:"version"`
+				URL     string `json:"url"`
+			} `json:"versions"`
+		} `json:"collections"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&index); err != nil {
+		return nil, fmt.Errorf("%s: %w", attackIndexURL, err)
+	}
+	var versions []string
+	for _, c := range index.Collections {
+		for _, v := range c.Versions {
+			if strings.Contains(v.URL, "/"+dom.Collection+"/") && attackVersionRe.MatchString(v.Version) {
+				versions = append(versions, v.Version)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s lists no %s releases", attackIndexURL, dom.Collection)
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	return versions, nil
+}
+
+var attackVersionRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// parseAttackVersion normalises -attack-version: "v15.1" and "15.1" are
+// 15.1, a bare major "15" is 15.0.
+func parseAttackVersion(value string) (string, error) {
+	v := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if !attackVersionRe.MatchString(v) {
+		return "", fmt.Errorf("invalid -attack-version %q (use a release number such as 15.1)", value)
+	}
+	if !strings.Contains(v, ".") {
+		v += ".0"
+	}
+	return v, nil
+}
+
+// nearbyAttackVersions returns up to n of versions closest to v.
+func nearbyAttackVersions(v string, n int, versions []string) []string {
+	key := func(s string) int {
+		major, minor, _ := strings.Cut(s, ".")
+		a, _ := strconv.Atoi(major)
+		b, _ := strconv.Atoi(minor)
+		return a*100 + b
+	}
+	target := key(v)
+	dist := func(s string) int {
+		d := key(s) - target
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	near := append([]string(nil), versions...)
+	sort.SliceStable(near, func(i, j int) bool { return dist(near[i]) < dist(near[j]) })
+	near = near[:min(n, len(near))]
+	sort.Slice(near, func(i, j int) bool { return compareVersions(near[i], near[j]) < 0 })
+	return near
+}
+
+// unknownVersionError is the error for a pinned release the server
+// doesn't have (HTTP 404 on its versioned file at url). The suggestions
+// come from attack-stix-data's index.json, so releases newer than this
+// binary are offered too; mirrors and a failed lookup use
+// knownAttackVersions.
+func unknownVersionError(dom attackDomain, url string) error {
+	versions := knownAttackVersions
+	if bundleURL == "" {
+		if published, err := publishedAttackVersions(dom); err != nil {
+			debugf("reading the ATT&CK release list: %v\n", err)
+		} else {
+			versions = published
+		}
+	}
+	return fmt.Errorf("ATT&CK %s v%s not found at %s; nearby releases: %s",
+		dom.Label, attackVersion, url, strings.Join(nearbyAttackVersions(attackVersion, 4, versions), ", "))
+}
+
+// checkPinnedRelease fails when a bundle loaded under -attack-version says
+// it is another release, e.g. a mirror or -bundle-path serving the wrong
+// file. Bundles without a version are let through.
+func checkPinnedRelease(dom attackDomain, r attackRelease) error {
+	if attackVersion == "" || r.Version == "" || r.Version == attackVersion {
+		return nil
+	}
+	return fmt.Errorf("the %s bundle is ATT&CK v%s, not the -attack-version %s", dom.Label, r.Version, attackVersion)
+}
+
+// isAttackKillChain matches the kill chain names of all domains:
+// mitre-attack, mitre-ics-attack and mitre-mobile-attack.
+func isAttackKillChain(name string) bool {
+	return strings.HasPrefix(name, "mitre-") && strings.HasSuffix(name, "attack")
+}
+
+// multiDomain reports whether output needs a Domain column.
+func multiDomain() bool {
+	return len(loadedDomains) > 1
+}
+
+// domainLabels joins the labels of the loaded domains ("Enterprise, ICS").
+func domainLabels() string {
+	labels := make([]string, len(loadedDomains))
+	for i, d := range loadedDomains {
+		labels[i] = d.Label
+	}
+	return strings.Join(labels, ", ")
+}
+
+// parseDomains parses -domain; duplicates are dropped, order is kept.
+func parseDomains(value string) ([]attackDomain, error) {
+	var out []attackDomain
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		found := false
+		for _, d := range attackDomains {
+			if d.Name == name {
+				out, found = append(out, d), true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid -domain %q (use enterprise, ics, mobile)", name)
+		}
+		seen[name] = true
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("-domain needs at least one of enterprise, ics, mobile")
+	}
+	return out, nil
+}
+
+// parseOnlyDomain parses -only-domain into an x_mitre_domains value; the
+// short -domain names are accepted too ("ics" for "ics-attack").
+func parseOnlyDomain(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, d := range attackDomains {
+		if value == d.Name || value == d.Collection {
+			return d.Collection, nil
+		}
+	}
+	return "", fmt.Errorf("invalid -only-domain %q (use enterprise-attack, ics-attack, mobile-attack)", value)
+}
+
+// inDomain reports whether x_mitre_domains lists domain.
+func inDomain(domains []string, domain string) bool {
+	for _, d := range domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAttackData returns an empty attackData ready for add or merge.
+func newAttackData(keepRaw bool) *attackData {
+	d := &attackData{
+		Mitigations: make(map[string]courseOfAction),
+		Techniques:  make(map[string]attackPattern),
+		RevokedBy:   make(map[string]string),
+		DataSources: make(map[string]xMitreDataSource),
+		Components:  make(map[string]xMitreDataComponent),
+		Skipped:     make(map[string]int),
+	}
+	if keepRaw {
+		d.Raw = make(map[string]json.RawMessage)
+	}
+	return d
+}
+
+// merge adds the objects of src, a bundle of the given domain label, to d.
+func (d *attackData) merge(src *attackData, domain string) {
+	if d.SpecVersion == "" {
+		d.SpecVersion = src.SpecVersion
+	}
+	if d.ObjectSpec == "" {
+		d.ObjectSpec = src.ObjectSpec
+	}
+	if d.Release.Version == "" {
+		d.Release = src.Release
+	} else if src.Release.Version != "" && src.Release.Version != d.Release.Version {
+		debugf("%s bundle is ATT&CK v%s, the first is v%s\n", domain, src.Release.Version, d.Release.Version)
+	}
+	d.noteModified(src.NewestObject)
+	d.Objects += src.Objects
+	for typ, n := range src.Skipped {
+		d.Skipped[typ] += n
+	}
+	for _, o := range src.SkipSamples {
+		if len(d.SkipSamples) < maxSkipSamples {
+			if multiDomain() {
+				o.Type = domain + " " + o.Type
+			}
+			d.SkipSamples = append(d.SkipSamples, o)
+		}
+	}
+
+	keep := func(id string) {
+		if d.Raw != nil && src.Raw != nil {
+			d.Raw[id] = src.Raw[id]
+		}
+	}
+
+	for id, co := range src.Mitigations {
+		co.Domain = domain
+		if old, ok := d.Mitigations[id]; ok && !replaces(id, old.Domain, old.Modified, domain, co.Modified) {
+			continue
+		}
+		d.Mitigations[id] = co
+		keep(id)
+	}
+	for id, ap := range src.Techniques {
+		ap.Domain = domain
+		if old, ok := d.Techniques[id]; ok && !replaces(id, old.Domain, old.Modified, domain, ap.Modified) {
+			continue
+		}
+		d.Techniques[id] = ap
+		keep(id)
+	}
+
+	relIndex := make(map[string]int, len(d.Relationships))
+	for i, r := range d.Relationships {
+		relIndex[r.ID] = i
+	}
+	for _, r := range src.Relationships {
+		r.Domain = domain
+		if i, ok := relIndex[r.ID]; ok {
+			if replaces(r.ID, d.Relationships[i].Domain, d.Relationships[i].Modified, domain, r.Modified) {
+				d.Relationships[i] = r
+				keep(r.ID)
+			}
+			continue
+		}
+		relIndex[r.ID] = len(d.Relationships)
+		d.Relationships = append(d.Relationships, r)
+		keep(r.ID)
+	}
+	for from, to := range src.RevokedBy {
+		if _, ok := d.RevokedBy[from]; !ok {
+			d.RevokedBy[from] = to
+		}
+	}
+
+	// Tactics, data sources and components: the first bundle's copy wins
+	tacticSeen := make(map[string]bool)
+	for _, t := range d.Tactics {
+		tacticSeen[t.ID] = true
+	}
+	for _, t := range src.Tactics {
+		if !tacticSeen[t.ID] {
+			tacticSeen[t.ID] = true
+			d.Tactics = append(d.Tactics, t)
+		}
+	}
+	for id, s := range src.DataSources {
+		if _, ok := d.DataSources[id]; !ok {
+			d.DataSources[id] = s
+		}
+	}
+	for id, c := range src.Components {
+		if _, ok := d.Components[id]; !ok {
+			d.Components[id] = c
+		}
+	}
+}
+
+// replaces reports whether the copy of id from newDomain should replace the
+// one already loaded: only when it was modified later. Differing copies are
+// reported under -debug.
+func replaces(id, oldDomain, oldModified, newDomain, newModified string) bool {
+	if oldModified == newModified {
+		return false
+	}
+	newer := modifiedAfter(newModified, oldModified)
+	if logEnabled(levelDebug) {
+		winner := oldDomain
+		if newer {
+			winner = newDomain
+		}
+		debugf("%s differs between the %s and %s bundles; keeping the %s copy (newest modified)\n", id, oldDomain, newDomain, winner)
+	}
+	return newer
+}
+
+// modifiedAfter compares two STIX timestamps; unparsable ones sort first.
+func modifiedAfter(a, b string) bool {
+	ta, errA := time.Parse(time.RFC3339Nano, a)
+	tb, errB := time.Parse(time.RFC3339Nano, b)
+	switch {
+	case errA != nil:
+		return false
+	case errB != nil:
+		return true
+	}
+	return ta.After(tb)
+}
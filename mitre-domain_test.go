@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAttackIndex = `{"collections": [
+  {"name": "Enterprise ATT&CK", "versions": [
+    {"version": "19.0", "url": "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/enterprise-attack/enterprise-attack-19.0.json"},
+    {"version": "18.1", "url": "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/enterprise-attack/enterprise-attack-18.1.json"},
+    {"version": "18.0", "url": "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/enterprise-attack/enterprise-attack-18.0.json"}
+  ]},
+  {"name": "ICS ATT&CK", "versions": [
+    {"version": "18.2", "url": "https://raw.githubusercontent.com/mitre-attack/attack-stix-data/master/ics-attack/ics-attack-18.2.json"}
+  ]}
+]}`
+
+func TestUnknownVersionError(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(testAttackIndex))
+	}))
+	defer srv.Close()
+	swap(t, &attackIndexURL, srv.URL+"/index.json")
+	swap(t, &bundleURL, "")
+	swap(t, &attackVersion, "19.5")
+	swap(t, &verbosity, levelError)
+	dom := attackDomains[0]
+
+	for _, tc := range []struct {
+		name      string
+		status    int
+		bundleURL string
+		want      string
+	}{
+		// Releases after knownAttackVersions, and only the domain's own
+		{"index", http.StatusOK, "", "nearby releases: 18.0, 18.1, 19.0"},
+		{"index unavailable", http.StatusNotFound, "", "nearby releases: 17.0, 17.1, 18.0, 18.1"},
+		{"mirror", http.StatusOK, "https://mirror.example/{collection}-{version}.json", "nearby releases: 17.0, 17.1, 18.0, 18.1"},
+	} {
+		status = tc.status
+		swap(t, &bundleURL, tc.bundleURL)
+		err := unknownVersionError(dom, "https://example/enterprise-attack-19.5.json")
+		if !strings.HasSuffix(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want it to end with %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestNearbyAttackVersions(t *testing.T) {
+	for _, tc := range []struct {
+		v    string
+		want string
+	}{
+		{"16.5", "16.0, 16.1, 17.0, 17.1"},
+		{"0.5", "1.0, 2.0, 3.0, 4.0"},
+		{"99.0", "17.0, 17.1, 18.0, 18.1"},
+	} {
+		if got := strings.Join(nearbyAttackVersions(tc.v, 4, knownAttackVersions), ", "); got != tc.want {
+			t.Errorf("nearbyAttackVersions(%s) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
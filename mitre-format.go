@@ -0,0 +1,62 @@
+// mitre-format.go
+//
+// -format selects what goes to stdout. The boolean flags it replaces (-json,
+// -csv, -ngql, ...) keep working with a deprecation note naming the -format
+// value; -ngql-file and -importer-dir still imply "ngql". Asking for two
+// different formats is an error rather than a silent first-match.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var outputFormats = []string{"table", "json", "jsonl", "csv", "tsv", "md", "html", "ngql", "sql", "cypher", "gremlin"}
+
+// formatFlag is a flag that picks an output format on its own.
+type formatFlag struct {
+	Name       string
+	Set        bool
+	Format     string
+	Deprecated bool
+}
+
+// resolveFormat combines -format with the flags that imply a format. It
+// returns the format, the flag that chose it (for messages) and the
+// deprecation notes to print.
+func resolveFormat(format string, implied []formatFlag) (string, string, []string, error) {
+	source := ""
+	if format != "" {
+		valid := false
+		for _, f := range outputFormats {
+			valid = valid || f == format
+		}
+		if !valid {
+			return "", "", nil, fmt.Errorf("invalid -format %q (use %s)", format, strings.Join(outputFormats, ", "))
+		}
+		source = "-format " + format
+	}
+
+	var notes []string
+	for _, f := range implied {
+		if !f.Set {
+			continue
+		}
+		if f.Deprecated {
+			notes = append(notes, fmt.Sprintf("%s is deprecated; use -format %s", f.Name, f.Format))
+		}
+		switch {
+		case source == "":
+			format, source = f.Format, f.Name
+		case format != f.Format:
+			return "", "", nil, fmt.Errorf("conflicting output flags %s, %s: pick one", source, f.Name)
+		}
+	}
+
+	if format == "" {
+		format = "table"
+	}
+	return format, source, notes, nil
+}
@@ -0,0 +1,117 @@
+// mitre-gaps.go
+//
+// -gaps: for every tactic the mitigation touches, the techniques of that
+// tactic it does not mitigate – the coverage holes a second mitigation would
+// have to close. Revoked and deprecated techniques are not gaps, and
+// -only-domain applies as it does to the results. Tactics come in matrix
+// order, gaps by technique ID.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// gapTechnique is one technique the mitigation leaves uncovered.
+type gapTechnique struct {
+	ExternalID string `json:"external_id"`
+	Name       string `json:"name"`
+	URL        string `json:"url,omitempty"`
+}
+
+// tacticGaps is the coverage of one tactic.
+type tacticGaps struct {
+	Tactic   string         `json:"tactic"` // phase name
+	TacticID string         `json:"tactic_id,omitempty"`
+	Name     string         `json:"tactic_name"`
+	Covered  int            `json:"covered"`
+	Total    int            `json:"total"`
+	Gaps     []gapTechnique `json:"gaps"`
+}
+
+// techniquesByTactic indexes the live techniques of techMap by tactic phase
+// name, each list sorted by ID. onlyDomain, if set, is an x_mitre_domains
+// value the techniques must list.
+func techniquesByTactic(techMap map[string]attackPattern, onlyDomain string) map[string][]gapTechnique {
+	idx := make(map[string][]gapTechnique)
+	for _, tp := range techMap {
+		if tp.Revoked || tp.Deprecated {
+			continue
+		}
+		if onlyDomain != "" && !inDomain(tp.Domains, onlyDomain) {
+			continue
+		}
+		ext, ok := externalID(tp.ExternalRefs)
+		if !ok {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, kc := range tp.KillChain {
+			if !isAttackKillChain(kc.KillChainName) || seen[kc.PhaseName] {
+				continue
+			}
+			seen[kc.PhaseName] = true
+			idx[kc.PhaseName] = append(idx[kc.PhaseName], gapTechnique{ExternalID: ext, Name: tp.Name, URL: techniqueURL(ext, tp.ExternalRefs)})
+		}
+	}
+	for _, ts := range idx {
+		sort.Slice(ts, func(i, j int) bool { return ts[i].ExternalID < ts[j].ExternalID })
+	}
+	return idx
+}
+
+// findGaps lists, per tactic of results, the indexed techniques missing
+// from results.
+func findGaps(results []techniqueInfo, byTactic map[string][]gapTechnique) []tacticGaps {
+	covered := make(map[string]bool, len(results))
+	for _, t := range results {
+		covered[t.ExternalID] = true
+	}
+	var out []tacticGaps
+	for _, g := range groupByTactic(results) {
+		if g.Tactic == uncategorized {
+			continue
+		}
+		tg := tacticGaps{Tactic: g.Tactic, TacticID: tacticPhaseToID[g.Tactic], Name: tacticName(g.Tactic), Gaps: []gapTechnique{}}
+		for _, t := range byTactic[g.Tactic] {
+			tg.Total++
+			if covered[t.ExternalID] {
+				tg.Covered++
+			} else {
+				tg.Gaps = append(tg.Gaps, t)
+			}
+		}
+		out = append(out, tg)
+	}
+	return out
+}
+
+// printGaps renders one section per tactic: coverage, then the gaps.
+func printGaps(out io.Writer, mitExt, mitName string, gaps []tacticGaps, pal palette) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MITIGATION\t%s\n", pal.bold(fmt.Sprintf("%s (%s)", mitName, mitExt)))
+	fmt.Fprintln(w, "---------------------------------------------------------------")
+	for i, g := range gaps {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		title := strings.ToUpper(g.Name)
+		if g.TacticID != "" {
+			title += " (" + g.TacticID + ")"
+		}
+		fmt.Fprintf(w, "%s – %d of %d technique(s) covered, %d gap(s)\n", pal.bold(title), g.Covered, g.Total, len(g.Gaps))
+		for _, t := range g.Gaps {
+			id := pal.cyan(t.ExternalID)
+			if isSubtechnique(t.ExternalID) {
+				id = pal.dim(t.ExternalID)
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", id, t.Name)
+		}
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,195 @@
+// mitre-graph.go
+//
+// -dot FILE / -graphml FILE: the mitigation as a picture. The mitigation is
+// the central node, with edges to its techniques, from techniques to their
+// tactics and from parents to sub-techniques. Techniques found missing by a
+// database check (-ngql without -no-db) get a dashed border.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// graphView is everything the DOT and GraphML writers draw.
+type graphView struct {
+	MitigationID   string
+	MitigationName string
+	Techniques     []techniqueInfo
+	Missing        map[string]bool // nil when no database check ran
+}
+
+type graphNode struct {
+	ID, Label, Kind string // Kind: mitigation, technique, subtechnique, tactic
+	Missing         bool
+}
+
+type graphEdge struct {
+	From, To, Kind string // Kind: mitigates, has_subtechnique, part_of
+}
+
+// build turns the view into nodes and edges in a stable order. Parents of
+// sub-techniques that aren't in the result are added so the edge has an end.
+func (v graphView) build() ([]graphNode, []graphEdge) {
+	nodes := []graphNode{{ID: v.MitigationID, Label: v.MitigationID + " " + v.MitigationName, Kind: "mitigation"}}
+	seen := map[string]bool{v.MitigationID: true}
+	var edges []graphEdge
+	var tactics []graphNode
+
+	for _, t := range v.Techniques {
+		if seen[t.ExternalID] {
+			continue
+		}
+		seen[t.ExternalID] = true
+		kind := "technique"
+		if isSubtechnique(t.ExternalID) {
+			kind = "subtechnique"
+		}
+		nodes = append(nodes, graphNode{ID: t.ExternalID, Label: t.ExternalID + " " + t.Name, Kind: kind, Missing: v.Missing[t.ExternalID]})
+		edges = append(edges, graphEdge{From: v.MitigationID, To: t.ExternalID, Kind: "mitigates"})
+	}
+
+	for _, t := range v.Techniques {
+		if isSubtechnique(t.ExternalID) {
+			parent := getParentTechniqueID(t.ExternalID)
+			if !seen[parent] {
+				seen[parent] = true
+				nodes = append(nodes, graphNode{ID: parent, Label: parent, Kind: "technique"})
+			}
+			edges = append(edges, graphEdge{From: parent, To: t.ExternalID, Kind: "has_subtechnique"})
+		}
+		for _, phase := range t.Tactics {
+			tacticID, ok := tacticPhaseToID[phase]
+			if !ok {
+				continue
+			}
+			if !seen[tacticID] {
+				seen[tacticID] = true
+				tactics = append(tactics, graphNode{ID: tacticID, Label: tacticID + " " + phase, Kind: "tactic"})
+			}
+			edges = append(edges, graphEdge{From: t.ExternalID, To: tacticID, Kind: "part_of"})
+		}
+	}
+
+	sort.Slice(tactics, func(i, j int) bool { return tactics[i].ID < tactics[j].ID })
+	return append(nodes, tactics...), edges
+}
+
+// wrapLabel breaks s into lines of at most width runes at spaces.
+func wrapLabel(s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+/*
+-------------------------------------------------------------
+Graphviz DOT
+-------------------------------------------------------------
+*/
+
+var dotReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", " ")
+
+var dotStyle = map[string]string{
+	"mitigation":       `shape=box, style="filled,bold", fillcolor="#4e79a7", fontcolor="white"`,
+	"technique":        `shape=ellipse, style="filled", fillcolor="#f28e2b"`,
+	"subtechnique":     `shape=ellipse, style="filled", fillcolor="#ffbe7d"`,
+	"tactic":           `shape=hexagon, style="filled", fillcolor="#59a14f", fontcolor="white"`,
+	"mitigates":        `color="#4e79a7"`,
+	"has_subtechnique": `style=dotted`,
+	"part_of":          `color="#59a14f"`,
+}
+
+// dotLabel escapes s for a quoted DOT string and wraps it with \n.
+func dotLabel(s string) string {
+	lines := wrapLabel(s, 24)
+	for i, l := range lines {
+		lines[i] = dotReplacer.Replace(l)
+	}
+	return `"` + strings.Join(lines, `\n`) + `"`
+}
+
+func writeDOT(w io.Writer, v graphView) error {
+	nodes, edges := v.build()
+	var b strings.Builder
+
+	b.WriteString("digraph mitigation {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString(`  node [fontname="Helvetica", fontsize=10];` + "\n")
+	b.WriteString(`  edge [fontname="Helvetica", fontsize=8];` + "\n\n")
+
+	for _, n := range nodes {
+		style := dotStyle[n.Kind]
+		if n.Missing {
+			style = strings.Replace(style, `style="filled"`, `style="filled,dashed"`, 1)
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, %s];\n", dotLabel(n.ID), dotLabel(n.Label), style)
+	}
+	b.WriteString("\n")
+	for _, e := range edges {
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", dotLabel(e.From), dotLabel(e.To), dotStyle[e.Kind])
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+/*
+-------------------------------------------------------------
+GraphML
+-------------------------------------------------------------
+*/
+
+func xmlText(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeGraphML(w io.Writer, v graphView) error {
+	nodes, edges := v.build()
+	var b strings.Builder
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="label" for="node" attr.name="label" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="kind" for="all" attr.name="kind" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="missing" for="node" attr.name="missing_in_db" attr.type="boolean"><default>false</default></key>` + "\n")
+	fmt.Fprintf(&b, `  <graph id="%s" edgedefault="directed">`+"\n", xmlText(v.MitigationID))
+
+	for _, n := range nodes {
+		fmt.Fprintf(&b, `    <node id="%s"><data key="label">%s</data><data key="kind">%s</data>`, xmlText(n.ID), xmlText(n.Label), n.Kind)
+		if n.Missing {
+			b.WriteString(`<data key="missing">true</data>`)
+		}
+		b.WriteString("</node>\n")
+	}
+	for i, e := range edges {
+		fmt.Fprintf(&b, `    <edge id="e%d" source="%s" target="%s"><data key="kind">%s</data></edge>`+"\n", i, xmlText(e.From), xmlText(e.To), e.Kind)
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,92 @@
+// mitre-gremlin.go
+//
+// -gremlin: the -ngql script as Gremlin upserts for TinkerPop graphs
+// (JanusGraph, Neptune, ...), one traversal per line. Vertices use the
+// fold/coalesce/addV idiom and edges are only added when missing, so the
+// script can be replayed. -gremlin-graph-label-prefix namespaces every
+// vertex and edge label.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var gremlinPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+
+var gremlinReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// gremlinLiteral quotes s as a single-quoted Groovy/Gremlin string.
+func gremlinLiteral(s string) string {
+	return "'" + gremlinReplacer.Replace(s) + "'"
+}
+
+// generateGremlin mirrors generateNGQL: technique vertices, sub-technique
+// and tactic edges, and the mitigates edges.
+func generateGremlin(prefix, mitigationID, mitigationName string, techniques []techniqueInfo) string {
+	var b strings.Builder
+	label := func(name string) string { return gremlinLiteral(prefix + name) }
+	vertex := func(lbl, id string) string {
+		return fmt.Sprintf("has(%s,'id',%s)", label(lbl), gremlinLiteral(id))
+	}
+	upsertV := func(lbl, id, name string) {
+		b.WriteString(fmt.Sprintf("g.V().%s.fold().coalesce(unfold(),addV(%s).property('id',%s)).property('name',%s).iterate()\n",
+			vertex(lbl, id), label(lbl), gremlinLiteral(id), gremlinLiteral(name)))
+	}
+	upsertE := func(edge, fromLbl, fromID, toLbl, toID string) {
+		b.WriteString(fmt.Sprintf("g.V().%s.as('a').V().%s.coalesce(inE(%s).where(outV().as('a')),addE(%s).from('a')).iterate()\n",
+			vertex(fromLbl, fromID), vertex(toLbl, toID), label(edge), label(edge)))
+	}
+
+	b.WriteString("// ============================================================\n")
+	b.WriteString(fmt.Sprintf("// Gremlin script for mitigation %s (%s)\n", mitigationID, mitigationName))
+	b.WriteString(fmt.Sprintf("// Data: %s\n", bundleRelease))
+	b.WriteString("// ============================================================\n\n")
+
+	b.WriteString("// Vertices\n")
+	upsertV("mitigation", mitigationID, mitigationName)
+	for _, t := range techniques {
+		upsertV("technique", t.ExternalID, t.Name)
+	}
+
+	b.WriteString("\n// has_subtechnique edges (parent to sub-technique)\n")
+	for _, t := range techniques {
+		if isSubtechnique(t.ExternalID) {
+			parentID := getParentTechniqueID(t.ExternalID)
+			b.WriteString(fmt.Sprintf("g.V().%s.fold().coalesce(unfold(),addV(%s).property('id',%s)).iterate()\n",
+				vertex("technique", parentID), label("technique"), gremlinLiteral(parentID)))
+			upsertE("has_subtechnique", "technique", parentID, "technique", t.ExternalID)
+		}
+	}
+
+	b.WriteString("\n// part_of edges (technique to tactic)\n")
+	for _, t := range techniques {
+		for _, phase := range t.Tactics {
+			tacticID, ok := tacticPhaseToID[phase]
+			if !ok {
+				b.WriteString(fmt.Sprintf("// WARNING: %s tactic phase %q has no tactic ID; part_of edge skipped\n", t.ExternalID, phase))
+				continue
+			}
+			upsertV("tactic", tacticID, phase)
+			upsertE("part_of", "technique", t.ExternalID, "tactic", tacticID)
+		}
+	}
+
+	b.WriteString("\n// mitigates edges (mitigation to techniques)\n")
+	for _, t := range techniques {
+		upsertE("mitigates", "mitigation", mitigationID, "technique", t.ExternalID)
+	}
+
+	b.WriteString(fmt.Sprintf("\n// Verify (expected %d): g.V().%s.outE(%s).count()\n",
+		len(techniques), vertex("mitigation", mitigationID), label("mitigates")))
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// swap sets *p to v for the rest of the test.
+func swap[T any](t testing.TB, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// fixture is the path of a bundle under testdata.
+func fixture(name string) string {
+	return filepath.Join("testdata", name)
+}
+
+// parseFixture parses a bundle under testdata.
+func parseFixture(t testing.TB, name string) *attackData {
+	t.Helper()
+	f, err := os.Open(fixture(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := parseBundle(f, false, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return data
+}
+
+// bundleServer serves one bundle as every {collection}.json and counts the
+// GETs.
+type bundleServer struct {
+	URL  string // -bundle-url for it
+	gets atomic.Int32
+}
+
+func serveBundle(t testing.TB, body []byte) *bundleServer {
+	t.Helper()
+	s := &bundleServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.gets.Add(1)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	s.URL = srv.URL + "/{collection}.json"
+	return s
+}
+
+// useBundleServer points the cache at a fresh directory and downloads at
+// s, and quiets the log; it returns the enterprise domain.
+func useBundleServer(t testing.TB, s *bundleServer) attackDomain {
+	t.Helper()
+	swap(t, &cacheDir, t.TempDir())
+	swap(t, &bundleURL, s.URL)
+	swap(t, &attackVersion, "")
+	swap(t, &verbosity, levelError)
+	return attackDomains[0]
+}
+
+// readFixture returns the bytes of a bundle under testdata.
+func readFixture(t testing.TB, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(fixture(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// bigBundle is the 2.1 fixture with its objects repeated copies times, a
+// few MB for benchmarks.
+func bigBundle(t testing.TB, copies int) []byte {
+	t.Helper()
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	start, end := bytes.Index(raw, []byte("[")), bytes.LastIndex(raw, []byte("]"))
+	var big bytes.Buffer
+	big.Write(raw[:start+1])
+	for i := 0; i < copies; i++ {
+		if i > 0 {
+			big.WriteString(",")
+		}
+		big.Write(raw[start+1 : end])
+	}
+	big.Write(raw[end:])
+	return big.Bytes()
+}
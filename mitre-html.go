@@ -0,0 +1,90 @@
+// mitre-html.go
+//
+// -format html (or -html): a self-contained HTML page for people who don't
+// live in a terminal. Styles are inline in the page, so the file can be
+// mailed or attached as-is. Everything goes through html/template, which
+// escapes names and descriptions for their context.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+type htmlReport struct {
+	Mitigation  templateMitigation
+	Techniques  []techniqueInfo
+	Describe    bool
+	MultiDomain bool
+	Release     string // bundleRelease.String()
+	Generated   string
+}
+
+var htmlPage = template.Must(template.New("html").Funcs(template.FuncMap{
+	"join":    templateFuncs["join"],
+	"tactics": tacticLabels,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Mitigation.ID}} – {{.Mitigation.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+p.desc { max-width: 60em; color: #444; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.35em 0.7em; text-align: left; vertical-align: top; }
+th { background: #4e79a7; color: #fff; }
+tr:nth-child(even) td { background: #f4f6f9; }
+td.id { white-space: nowrap; font-family: monospace; }
+a { color: #2a5d8f; }
+footer { margin-top: 2em; font-size: 0.85em; color: #777; }
+</style>
+</head>
+<body>
+<h1>{{if .Mitigation.URL}}<a href="{{.Mitigation.URL}}">{{.Mitigation.ID}}</a>{{else}}{{.Mitigation.ID}}{{end}} – {{.Mitigation.Name}}</h1>
+{{with .Mitigation.Description}}<p class="desc">{{.}}</p>{{end}}
+<p>{{len .Techniques}} technique(s)</p>
+<table>
+<thead><tr><th>Technique ID</th><th>Technique name</th><th>Tactics</th><th>Platforms</th>{{if .MultiDomain}}<th>Domain</th>{{end}}{{if .Describe}}<th>Description</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Techniques}}
+<tr><td class="id">{{if .URL}}<a href="{{.URL}}">{{.ExternalID}}</a>{{else}}{{.ExternalID}}{{end}}</td><td>{{.Name}}</td><td>{{tactics .Tactics}}</td><td>{{join .Platforms ", "}}</td>{{if $.MultiDomain}}<td>{{.Domain}}</td>{{end}}{{if $.Describe}}<td>{{.Description}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<footer>{{.Release}} · generated {{.Generated}} by mitremit</footer>
+</body>
+</html>
+`))
+
+// printHTML writes the report. Descriptions are shown without citations;
+// describe adds the technique description column.
+func printHTML(out io.Writer, mit courseOfAction, data []techniqueInfo, describe bool) error {
+	mitExt, _ := externalID(mit.ExternalRefs)
+	mitURL := externalURL(mit.ExternalRefs)
+	if mitURL == "" {
+		mitURL = attackURL(mitExt)
+	}
+	techniques := make([]techniqueInfo, len(data))
+	for i, t := range data {
+		t.Description = displayDescription(t.Description)
+		techniques[i] = t
+	}
+	return htmlPage.Execute(out, htmlReport{
+		Mitigation: templateMitigation{
+			ID:          mitExt,
+			Name:        mit.Name,
+			Description: displayDescription(mit.Description),
+			URL:         mitURL,
+		},
+		Techniques:  techniques,
+		Describe:    describe,
+		MultiDomain: multiDomain(),
+		Release:     bundleRelease.String(),
+		Generated:   time.Now().UTC().Format("2006-01-02 15:04 UTC"),
+	})
+}
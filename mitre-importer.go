@@ -0,0 +1,289 @@
+// mitre-importer.go
+//
+// -importer-dir DIR: the -ngql data as CSV files plus an importer.yaml for
+// nebula-importer (v4 config format), for bulk loads. The files mirror the
+// script: with a database check only missing techniques (and their
+// has_subtechnique/part_of edges) are written, while every mitigates edge
+// is. CSV quoting is encoding/csv's, which is what the importer reads.
+// mitigates edges carry the -mitigates-props values as CSV columns; the
+// importer needs their names and types, which come from the edge type when
+// the database is checked and from name=value otherwise. importer.yaml holds
+// the password and is written 0600.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// importerFile is one CSV file and the importer.yaml source entry for it.
+type importerFile struct {
+	Name   string
+	Header []string
+	Rows   [][]string
+	Source string
+}
+
+// importerPropType maps a -technique-schema default to an importer type.
+func importerPropType(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return "BOOL"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "DOUBLE"
+		}
+		return "INT"
+	case float64:
+		return "DOUBLE"
+	}
+	return "STRING"
+}
+
+// importerValue renders a default as a raw CSV cell.
+func importerValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// importerProp is one mitigates edge property as the importer loads it.
+type importerProp struct {
+	Name     string
+	Type     string // importer type, e.g. "STRING"
+	Nullable bool
+	Value    string // as in mitigatesProps.Values
+}
+
+// importerEdgeProps names and types the -mitigates-props values. fields is
+// the edge type from DESCRIBE EDGE, nil without a database: then the values
+// must be named, and NULL ones can't be typed.
+func importerEdgeProps(p mitigatesProps, fields []edgeField) ([]importerProp, error) {
+	if len(p.Values) == 0 {
+		return nil, nil
+	}
+	if p.Names == nil && fields == nil {
+		return nil, fmt.Errorf("-importer-dir needs the names of the mitigates edge properties: give -mitigates-props as name=value, or drop -no-db so they are read from the database")
+	}
+	props := make([]importerProp, len(p.Values))
+	for i, v := range p.Values {
+		var field *edgeField
+		if p.Names != nil {
+			props[i].Name = p.Names[i]
+			field = fieldByName(fields, p.Names[i])
+		} else {
+			field = &fields[i]
+			props[i].Name = field.Name
+		}
+		props[i].Value = v
+		props[i].Nullable = v == "NULL"
+		if field != nil {
+			props[i].Type = importerFieldType(field.Type)
+		} else if props[i].Type = importerLiteralType(v); props[i].Type == "" {
+			return nil, fmt.Errorf("-importer-dir can't tell the type of %s=NULL without the database", props[i].Name)
+		}
+	}
+	return props, nil
+}
+
+// importerFieldType maps a DESCRIBE EDGE type to an importer type.
+func importerFieldType(t string) string {
+	t = strings.ToLower(t)
+	switch {
+	case strings.HasPrefix(t, "int"):
+		return "INT"
+	case t == "bool", t == "float", t == "double", t == "date", t == "time", t == "datetime", t == "timestamp":
+		return strings.ToUpper(t)
+	}
+	return "STRING"
+}
+
+// importerLiteralType is the importer type of a -mitigates-props value, ""
+// for NULL.
+func importerLiteralType(v string) string {
+	switch {
+	case v == "NULL":
+		return ""
+	case v == "true" || v == "false":
+		return "BOOL"
+	case v == domainPlaceholder || strings.HasPrefix(v, `"`):
+		return "STRING"
+	case strings.ContainsAny(v, ".eE"):
+		return "DOUBLE"
+	}
+	return "INT"
+}
+
+// cell renders the property for the edge to t as a raw CSV cell.
+func (p importerProp) cell(t techniqueInfo) string {
+	switch {
+	case p.Value == "NULL":
+		return ""
+	case p.Value == domainPlaceholder:
+		return t.Domain
+	case strings.HasPrefix(p.Value, `"`):
+		s, _ := strconv.Unquote(p.Value)
+		return s
+	}
+	return p.Value
+}
+
+func importerEdgeSource(file, edge string, props []importerProp) string {
+	var list strings.Builder
+	if len(props) == 0 {
+		list.WriteString(" []\n")
+	} else {
+		list.WriteString("\n")
+	}
+	for i, p := range props {
+		fmt.Fprintf(&list, "          - name: %q\n            type: %q\n            index: %d\n", p.Name, p.Type, i+2)
+		if p.Nullable {
+			list.WriteString("            nullable: true\n            nullValue: \"\"\n")
+		}
+	}
+	return fmt.Sprintf(`  - path: ./%s
+    csv:
+      delimiter: ","
+      withHeader: true
+    edges:
+      - name: %s
+        src:
+          id:
+            type: "STRING"
+            index: 0
+        dst:
+          id:
+            type: "STRING"
+            index: 1
+        props:%s`, file, edge, list.String())
+}
+
+// importerFiles builds the four CSV files. fields is the mitigates edge
+// type, nil without a database.
+func importerFiles(g graphNames, mitigationID string, techniques []techniqueInfo, missingTechniques []string, fields []edgeField) ([]importerFile, error) {
+	mitProps, err := importerEdgeProps(edgeProps, fields)
+	if err != nil {
+		return nil, err
+	}
+	missingMap := make(map[string]bool)
+	for _, id := range missingTechniques {
+		missingMap[id] = true
+	}
+
+	// techniques.csv: VID, then the technique columns in schema order
+	tech := importerFile{Name: "techniques.csv", Header: []string{"vid", techSchema.IDColumn, techSchema.NameColumn}}
+	var props strings.Builder
+	fmt.Fprintf(&props, "          - name: %q\n            type: \"STRING\"\n            index: 1\n", techSchema.IDColumn)
+	fmt.Fprintf(&props, "          - name: %q\n            type: \"STRING\"\n            index: 2\n", techSchema.NameColumn)
+	for i, d := range techSchema.values(techniqueInfo{}) {
+		tech.Header = append(tech.Header, d.Column)
+		fmt.Fprintf(&props, "          - name: %q\n            type: %q\n            index: %d\n", d.Column, importerPropType(d.Value), i+3)
+	}
+	tech.Source = fmt.Sprintf(`  - path: ./%s
+    csv:
+      delimiter: ","
+      withHeader: true
+    tags:
+      - name: %s
+        id:
+          type: "STRING"
+          index: 0
+        props:
+%s`, tech.Name, g.TechniqueTag, props.String())
+
+	sub := importerFile{Name: "has_subtechnique_edges.csv", Header: []string{"src", "dst"}, Source: importerEdgeSource("has_subtechnique_edges.csv", g.SubtechniqueEdge, nil)}
+	partOf := importerFile{Name: "part_of_edges.csv", Header: []string{"src", "dst"}, Source: importerEdgeSource("part_of_edges.csv", g.PartOfEdge, nil)}
+	mitigates := importerFile{Name: "mitigates_edges.csv", Header: []string{"src", "dst"}, Source: importerEdgeSource("mitigates_edges.csv", g.MitigatesEdge, mitProps)}
+	for _, p := range mitProps {
+		mitigates.Header = append(mitigates.Header, p.Name)
+	}
+
+	for _, t := range techniques {
+		edge := []string{mitigationID, t.ExternalID}
+		for _, p := range mitProps {
+			edge = append(edge, p.cell(t))
+		}
+		mitigates.Rows = append(mitigates.Rows, edge)
+		if !missingMap[t.ExternalID] {
+			continue
+		}
+
+		row := []string{t.ExternalID, t.ExternalID, t.Name}
+		for _, d := range techSchema.values(t) {
+			row = append(row, importerValue(d.Value))
+		}
+		tech.Rows = append(tech.Rows, row)
+
+		if isSubtechnique(t.ExternalID) {
+			sub.Rows = append(sub.Rows, []string{getParentTechniqueID(t.ExternalID), t.ExternalID})
+		}
+		for _, phase := range t.Tactics {
+			if tacticID, ok := tacticPhaseToID[phase]; ok {
+				partOf.Rows = append(partOf.Rows, []string{t.ExternalID, tacticID})
+			}
+		}
+	}
+	return []importerFile{tech, sub, partOf, mitigates}, nil
+}
+
+// importerConfig is importer.yaml for the files, using the NEBULA_* settings.
+func importerConfig(cfg nebulaConfig, files []importerFile) string {
+	var b strings.Builder
+	b.WriteString("# nebula-importer config generated by mitremit; run: nebula-importer --config importer.yaml\n")
+	b.WriteString("client:\n")
+	b.WriteString("  version: v3\n")
+	fmt.Fprintf(&b, "  address: %q\n", fmt.Sprintf("%s:%d", cfg.Host, cfg.Port))
+	fmt.Fprintf(&b, "  user: %q\n", cfg.User)
+	fmt.Fprintf(&b, "  password: %q\n", cfg.Pass)
+	b.WriteString("manager:\n")
+	fmt.Fprintf(&b, "  spaceName: %q\n", cfg.Space)
+	b.WriteString("  batch: 128\n")
+	b.WriteString("log:\n")
+	b.WriteString("  level: INFO\n")
+	b.WriteString("  console: true\n")
+	b.WriteString("sources:\n")
+	for _, f := range files {
+		b.WriteString(f.Source)
+	}
+	return b.String()
+}
+
+// writeImporterDir writes the CSV files and importer.yaml into dir.
+func writeImporterDir(dir string, cfg nebulaConfig, g graphNames, mitigationID string, techniques []techniqueInfo, missingTechniques []string, fields []edgeField) error {
+	files, err := importerFiles(g, mitigationID, techniques, missingTechniques, fields)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		err := writeFileAtomic(filepath.Join(dir, f.Name), func(w io.Writer) error {
+			cw := csv.NewWriter(w)
+			_ = cw.Write(f.Header)
+			_ = cw.WriteAll(f.Rows)
+			return cw.Error()
+		})
+		if err != nil {
+			return err
+		}
+		infof("wrote %d rows to %s\n", len(f.Rows), filepath.Join(dir, f.Name))
+	}
+	// The config holds NEBULA_PASS
+	return writeFileAtomicMode(filepath.Join(dir, "importer.yaml"), 0o600, func(w io.Writer) error {
+		_, err := io.WriteString(w, importerConfig(cfg, files))
+		return err
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestImporterEdgeProps(t *testing.T) {
+	fields := []edgeField{{"note", "string"}, {"domain", "fixed_string(16)"}, {"weight", "int64"}}
+	props := func(t *testing.T, value string) mitigatesProps {
+		p, err := parseMitigatesProps(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		fields  []edgeField
+		want    []importerProp
+		wantErr string
+	}{
+		{"no properties", "", nil, nil, ""},
+		{"positional from the database", "NULL,{domain},3", fields, []importerProp{
+			{Name: "note", Type: "STRING", Nullable: true, Value: "NULL"},
+			{Name: "domain", Type: "STRING", Value: "{domain}"},
+			{Name: "weight", Type: "INT", Value: "3"},
+		}, ""},
+		{"named, typed by the database", "weight=NULL", fields, []importerProp{
+			{Name: "weight", Type: "INT", Nullable: true, Value: "NULL"},
+		}, ""},
+		{"named, typed by value", `note="x",score=0.5,ok=true`, nil, []importerProp{
+			{Name: "note", Type: "STRING", Value: `"x"`},
+			{Name: "score", Type: "DOUBLE", Value: "0.5"},
+			{Name: "ok", Type: "BOOL", Value: "true"},
+		}, ""},
+		{"positional without database", "NULL,{domain}", nil, nil, "needs the names"},
+		{"NULL without database", "note=NULL", nil, nil, "type of note=NULL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := importerEdgeProps(props(t, tt.value), tt.fields)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteImporterDir(t *testing.T) {
+	p, err := parseMitigatesProps(`note="a, b",domain={domain}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap(t, &edgeProps, p)
+	swap(t, &verbosity, levelWarn)
+
+	dir := t.TempDir()
+	cfg := nebulaConfig{Host: "127.0.0.1", Port: 9669, User: "root", Pass: "s3cret", Space: "mitre"}
+	techniques := []techniqueInfo{{ExternalID: "T1059.001", Name: "PowerShell", Tactics: []string{"execution"}, Domain: "Enterprise"}}
+	if err := writeImporterDir(dir, cfg, defaultGraphNames, "M1038", techniques, []string{"T1059.001"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	edges, err := os.ReadFile(filepath.Join(dir, "mitigates_edges.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "src,dst,note,domain\nM1038,T1059.001,\"a, b\",Enterprise\n"; string(edges) != want {
+		t.Errorf("mitigates_edges.csv\n got %q\nwant %q", edges, want)
+	}
+
+	config := filepath.Join(dir, "importer.yaml")
+	raw, err := os.ReadFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "- name: \"domain\"\n            type: \"STRING\"\n            index: 3\n") {
+		t.Errorf("importer.yaml lacks the mitigates properties:\n%s", raw)
+	}
+	if info, err := os.Stat(config); err != nil {
+		t.Fatal(err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("importer.yaml has mode %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,103 @@
+// mitre-index.go
+//
+// The parsed-bundle index: after a bundle is parsed its lookup maps are
+// stored as gob in <cache-dir>/<collection>.index.gob, keyed by the SHA-256
+// of the bundle, and later runs on the same bundle load them instead of
+// parsing the JSON again. A new download (or any other change to the bundle
+// bytes) changes the key, so a stale index is simply ignored and rewritten.
+// indexFormat is bumped whenever attackData or the structs it holds change.
+// A cached bundle with an index has been validated and parsed before, so
+// readCachedBundle skips validating it again.
+//
+// -stix (which keeps the verbatim objects) and -bundle-path (which never
+// touches the cache) always parse; -no-index-cache turns the index off.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const indexFormat = 2
+
+// indexHeader precedes the attackData in the index file.
+type indexHeader struct {
+	Format   int
+	Checksum string // bundleChecksum of the bundle the index was built from
+}
+
+func indexPath(dom attackDomain) string {
+	return filepath.Join(cacheDir, dom.cacheName()+".index.gob")
+}
+
+// readIndex returns the stored parse of the bundle with checksum sum, or
+// nil when there is none, it belongs to another bundle or can't be read.
+func readIndex(dom attackDomain, sum string) *attackData {
+	f, err := os.Open(indexPath(dom))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	var hdr indexHeader
+	if err := dec.Decode(&hdr); err != nil {
+		debugf("ignoring %s: %v\n", indexPath(dom), err)
+		return nil
+	}
+	if hdr.Format != indexFormat || hdr.Checksum != sum {
+		debugf("ignoring %s: built from another bundle or version\n", indexPath(dom))
+		return nil
+	}
+	d := newAttackData(false)
+	if err := dec.Decode(d); err != nil {
+		debugf("ignoring %s: %v\n", indexPath(dom), err)
+		return nil
+	}
+	debugf("loaded parsed %s bundle from %s\n", dom.Name, indexPath(dom))
+	return d
+}
+
+// indexed reports whether the index of dom was built from the bundle with
+// checksum sum. Only the header is read.
+func indexed(dom attackDomain, sum string) bool {
+	if *flagNoIndexCache {
+		return false
+	}
+	f, err := os.Open(indexPath(dom))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var hdr indexHeader
+	err = gob.NewDecoder(bufio.NewReader(f)).Decode(&hdr)
+	return err == nil && hdr.Format == indexFormat && hdr.Checksum == sum
+}
+
+// writeIndex stores d as the parse of the bundle with checksum sum.
+func writeIndex(dom attackDomain, sum string, d *attackData) error {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return err
+	}
+	err := writeFileAtomic(indexPath(dom), func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		enc := gob.NewEncoder(bw)
+		if err := enc.Encode(indexHeader{Format: indexFormat, Checksum: sum}); err != nil {
+			return err
+		}
+		if err := enc.Encode(d); err != nil {
+			return fmt.Errorf("encoding index: %w", err)
+		}
+		return bw.Flush()
+	})
+	if err == nil {
+		debugf("stored parsed %s bundle in %s\n", dom.Name, indexPath(dom))
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestIndexedCacheSkipsValidation(t *testing.T) {
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	srv := serveBundle(t, raw)
+	dom := useBundleServer(t, srv)
+
+	// Too few objects to pass validation, but parsed and indexed before
+	var bundle Bundle
+	if err := json.Unmarshal(raw, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	objects := bundle.Objects[:0]
+	for _, o := range bundle.Objects {
+		if probeType(o) != "intrusion-set" {
+			objects = append(objects, o)
+		}
+	}
+	small, err := json.Marshal(Bundle{Type: "bundle", ID: "bundle--2", Objects: objects})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validateBundle(small, "small") == nil {
+		t.Fatal("the small bundle passes validation")
+	}
+	parsed, err := parseBundle(bytes.NewReader(small), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCachedBundle(dom, small); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIndex(dom, bundleChecksum(small), parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := fetchBundle(dom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, small) || srv.gets.Load() != 0 {
+		t.Errorf("indexed cache not used (%d downloads)", srv.gets.Load())
+	}
+
+	// Without the index the cache is validated, fails and is downloaded again
+	if err := os.Remove(indexPath(dom)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = fetchBundle(dom); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, raw) || srv.gets.Load() != 1 {
+		t.Errorf("invalid cache used (%d downloads)", srv.gets.Load())
+	}
+}
+
+// BenchmarkLoadAttackData compares a run on a cached bundle with and
+// without the parsed index.
+func BenchmarkLoadAttackData(b *testing.B) {
+	raw := bigBundle(b, 50)
+	dom := useBundleServer(b, serveBundle(b, raw))
+	swap(b, &loadedDomains, []attackDomain{dom})
+	if err := writeCachedBundle(dom, raw); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, useIndex := range []bool{true, false} {
+		name := "index"
+		if !useIndex {
+			name = "parse"
+		}
+		b.Run(name, func(b *testing.B) {
+			swap(b, flagNoIndexCache, !useIndex)
+			if _, err := loadAttackData(false, useIndex, false); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := loadAttackData(false, useIndex, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
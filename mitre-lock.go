@@ -0,0 +1,149 @@
+// mitre-lock.go
+//
+// One download per cache file at a time. Before downloading, a run takes an
+// exclusive lock on <cache-dir>/<name>.lock (flock on Unix, LockFileEx on
+// Windows); a second run for the same bundle waits, then uses the copy the
+// first one wrote instead of downloading it again. The lock file holds the
+// PID, host and start time of its owner. The OS drops the lock of a process
+// that dies, but a lock that is held by a PID no longer running on this host,
+// or for longer than any download can take, is stale: it is broken by
+// removing the file, and the waiter locks a new one. Breaking a live lock at
+// worst downloads twice; cache writes are atomic either way.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockPoll is how often a waiting run retries the lock.
+const lockPoll = 250 * time.Millisecond
+
+// lockStaleAfter is how long a lock may be held: every download attempt
+// timing out after the longest retry wait, a Retry-After one included, with
+// a margin.
+func lockStaleAfter() time.Duration {
+	attempts := time.Duration(max(*flagDownloadRetries, 1))
+	return max(10*time.Minute, attempts*(*flagHTTPTimeout+max(retryMaxWait, retryAfterMax))+time.Minute)
+}
+
+func lockPath(dom attackDomain) string {
+	return filepath.Join(cacheDir, dom.cacheName()+".lock")
+}
+
+// lockOwner is the content of a lock file.
+type lockOwner struct {
+	PID   int
+	Host  string
+	Since time.Time
+}
+
+func (o lockOwner) String() string {
+	return fmt.Sprintf("%d %s %d\n", o.PID, o.Host, o.Since.Unix())
+}
+
+func parseLockOwner(s string) (lockOwner, bool) {
+	f := strings.Fields(s)
+	if len(f) != 3 {
+		return lockOwner{}, false
+	}
+	pid, err1 := strconv.Atoi(f[0])
+	since, err2 := strconv.ParseInt(f[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return lockOwner{}, false
+	}
+	return lockOwner{PID: pid, Host: f[1], Since: time.Unix(since, 0)}, true
+}
+
+// stale reports why the lock of o can be broken, or "" if it can't.
+func (o lockOwner) stale() string {
+	host, _ := os.Hostname()
+	switch {
+	case o.Host == host && o.PID != os.Getpid() && !processAlive(o.PID):
+		return fmt.Sprintf("process %d is gone", o.PID)
+	case time.Since(o.Since) > lockStaleAfter():
+		return fmt.Sprintf("held since %s", o.Since.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// lockCache takes the download lock of dom, waiting for another run that
+// holds it. waited is how long that took (0 if the lock was free); the
+// caller releases the lock with unlock.
+func lockCache(dom attackDomain) (unlock func(), waited time.Duration, err error) {
+	path := lockPath(dom)
+	start := time.Now()
+	announced := false
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			// A read-only cache can't be written either: download unlocked
+			debugf("no download lock: %v\n", err)
+			return func() {}, 0, nil
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			// e.g. ENOLCK on a network file system without lock support
+			f.Close()
+			debugf("no download lock on %s: %v\n", path, err)
+			return func() {}, 0, nil
+		}
+		// A lock on a file that was broken (removed) meanwhile is no lock
+		if locked && sameFile(f, path) {
+			host, _ := os.Hostname()
+			if err := f.Truncate(0); err == nil {
+				f.WriteAt([]byte(lockOwner{os.Getpid(), host, time.Now()}.String()), 0)
+			}
+			if announced {
+				waited = time.Since(start)
+			}
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, waited, nil
+		}
+		if locked {
+			unlockFile(f)
+			f.Close()
+			continue
+		}
+
+		raw, _ := os.ReadFile(path)
+		f.Close()
+		owner, ok := parseLockOwner(string(raw))
+		if ok {
+			if why := owner.stale(); why != "" {
+				warnf("breaking stale lock %s (%s)\n", path, why)
+				if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return nil, 0, fmt.Errorf("breaking stale lock: %w", err)
+				}
+				continue
+			}
+		}
+		if !announced {
+			who := "another mitremit run"
+			if ok {
+				who += fmt.Sprintf(" (pid %d on %s)", owner.PID, owner.Host)
+			}
+			infof("waiting for %s downloading the %s bundle\n", who, dom.Name)
+			announced = true
+		}
+		if err := sleepInterruptible(lockPoll, "for the download lock "+path); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// sameFile reports whether f is still the file at path.
+func sameFile(f *os.File, path string) bool {
+	a, err1 := f.Stat()
+	b, err2 := os.Stat(path)
+	return err1 == nil && err2 == nil && os.SameFile(a, b)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentFetchDownloadsOnce(t *testing.T) {
+	raw := readFixture(t, "enterprise-attack-2.1.json")
+	// Slow enough that the second run finds the lock held
+	s := &bundleServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.gets.Add(1)
+		time.Sleep(2 * lockPoll)
+		w.Write(raw)
+	}))
+	defer srv.Close()
+	s.URL = srv.URL + "/{collection}.json"
+	dom := useBundleServer(t, s)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var data []byte
+			data, errs[i] = fetchBundle(dom)
+			if errs[i] == nil && len(data) != len(raw) {
+				t.Errorf("run %d got %d bytes, want %d", i, len(data), len(raw))
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("run %d: %v", i, err)
+		}
+	}
+	if n := s.gets.Load(); n != 1 {
+		t.Errorf("%d downloads, want 1", n)
+	}
+}
+
+func TestLockStaleAfterRetryAfter(t *testing.T) {
+	swap(t, flagDownloadRetries, 3)
+	swap(t, flagHTTPTimeout, 5*time.Minute)
+	// Three attempts that each time out and then wait out a Retry-After
+	busiest := 3 * (5*time.Minute + retryAfterMax)
+	if got := lockStaleAfter(); got <= busiest {
+		t.Errorf("lockStaleAfter() = %s; a live download can take %s", got, busiest)
+	}
+}
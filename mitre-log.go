@@ -0,0 +1,83 @@
+// mitre-log.go
+//
+// Leveled diagnostics: error, warn, info and debug, all on stderr. stdout
+// carries only the requested data, so piped output never picks up a status
+// line. -log-level picks the level (default info); -quiet is short for
+// -log-level warn and -debug for -log-level debug. Errors always show, and
+// so does the -execute summary the user is asked to confirm.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+)
+
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+// verbosity is set in main from -log-level, -quiet and -debug.
+var verbosity = levelInfo
+
+// parseLogLevel parses a -log-level value; "warning" is accepted for warn.
+func parseLogLevel(s string) (logLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		s = "warn"
+	}
+	for i, name := range logLevelNames {
+		if s == name {
+			return logLevel(i), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("invalid -log-level %q (use %s)", s, strings.Join(logLevelNames, ", "))
+}
+
+// logEnabled reports whether messages of level l are shown.
+func logEnabled(l logLevel) bool {
+	return verbosity >= l
+}
+
+// errorf reports why the run is about to fail; callers exit afterwards.
+func errorf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// warnf prints a "WARNING: " line unless -log-level is error.
+func warnf(format string, args ...any) {
+	if logEnabled(levelWarn) {
+		fmt.Fprintf(os.Stderr, "WARNING: "+format, args...)
+	}
+}
+
+// infof prints a status line unless -quiet (or -log-level warn/error).
+func infof(format string, args ...any) {
+	if logEnabled(levelInfo) {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// planf prints an -execute summary or progress line. Someone answering the
+// prompt must see what they confirm, so -quiet hides these only under -yes.
+func planf(format string, args ...any) {
+	if logEnabled(levelInfo) || !*flagYes {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// debugf prints a ">>> " line under -debug (-log-level debug).
+func debugf(format string, args ...any) {
+	if logEnabled(levelDebug) {
+		fmt.Fprintf(os.Stderr, ">>> "+format, args...)
+	}
+}
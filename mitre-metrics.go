@@ -0,0 +1,205 @@
+// mitre-metrics.go
+//
+// Opt-in, local-only run metrics (-metrics-out) and their summary
+// (-history-stats). Nothing here ever talks to the network: each run appends
+// a single JSON line to a file the operator chose. Failed and cancelled runs
+// are recorded too (exitRun), with their exit status, so the averages
+// aren't those of successes only.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+-------------------------------------------------------------
+One metrics record per run
+-------------------------------------------------------------
+*/
+
+type runMetrics struct {
+	Time          string           `json:"time"`
+	Mode          string           `json:"mode"`
+	Mitigations   int              `json:"mitigations"`
+	Techniques    int              `json:"techniques"`
+	Statements    map[string]int   `json:"statements,omitempty"`
+	Orphans       int              `json:"orphaned_relationships,omitempty"`
+	PhasesMS      map[string]int64 `json:"phases_ms"`
+	TotalMS       int64            `json:"total_ms"`
+	BatchSize     int              `json:"batch_size"`
+	Workers       int              `json:"workers"`
+	ServerVersion string           `json:"server_version,omitempty"`
+	Host          string           `json:"host,omitempty"` // only with -metrics-include-host
+	Exit          int              `json:"exit"`
+
+	path  string
+	start time.Time
+}
+
+// metrics is nil unless -metrics-out was given; every method is a no-op on a
+// nil receiver so call sites don't need to check.
+var metrics *runMetrics
+
+func startMetrics(path, mode string) *runMetrics {
+	return &runMetrics{
+		Mode:       mode,
+		Statements: make(map[string]int),
+		PhasesMS:   make(map[string]int64),
+		BatchSize:  1, // one statement per Execute call
+		Workers:    1,
+		path:       path,
+		start:      time.Now(),
+	}
+}
+
+// phase records the wall time spent since `since` under the given name.
+func (m *runMetrics) phase(name string, since time.Time) {
+	if m == nil {
+		return
+	}
+	m.PhasesMS[name] += time.Since(since).Milliseconds()
+}
+
+// count adds n statements of the given kind.
+func (m *runMetrics) count(kind string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.Statements[kind] += n
+}
+
+// countAll adds the statement counts of a generated script.
+func (m *runMetrics) countAll(counts map[string]int) {
+	for kind, n := range counts {
+		m.count(kind, n)
+	}
+}
+
+// write appends the record of a run ending with exit status code as one
+// compact JSON line.
+func (m *runMetrics) write(code int) {
+	if m == nil {
+		return
+	}
+	m.Exit = code
+	m.Time = m.start.UTC().Format(time.RFC3339)
+	m.TotalMS = time.Since(m.start).Milliseconds()
+
+	line, err := json.Marshal(m)
+	if err != nil {
+		warnf("metrics: %v\n", err)
+		return
+	}
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		warnf("metrics: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		warnf("metrics: %v\n", err)
+	}
+}
+
+// exitRun ends a run that fails or is cancelled, writing its metrics
+// record first: os.Exit skips the deferred write in main.
+func exitRun(code int) {
+	metrics.write(code)
+	os.Exit(code)
+}
+
+/*
+-------------------------------------------------------------
+-history-stats – averages and p95s per mode
+-------------------------------------------------------------
+*/
+
+func printHistoryStats(path string, out io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// mode -> series name ("total" or a phase) -> samples
+	samples := make(map[string]map[string][]int64)
+	runs := make(map[string]int)
+	failed := make(map[string]int) // runs with a non-zero exit status
+
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var m runMetrics
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			warnf("%s:%d: skipping malformed line: %v\n", path, lineNo, err)
+			continue
+		}
+		if samples[m.Mode] == nil {
+			samples[m.Mode] = make(map[string][]int64)
+		}
+		runs[m.Mode]++
+		if m.Exit != 0 {
+			failed[m.Mode]++
+		}
+		samples[m.Mode]["total"] = append(samples[m.Mode]["total"], m.TotalMS)
+		for phase, ms := range m.PhasesMS {
+			samples[m.Mode][phase] = append(samples[m.Mode][phase], ms)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	modes := make([]string, 0, len(samples))
+	for mode := range samples {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODE\tRUNS\tFAILED\tPHASE\tAVG ms\tP95 ms")
+	for _, mode := range modes {
+		names := make([]string, 0, len(samples[mode]))
+		for name := range samples[mode] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			avg, p95 := avgP95(samples[mode][name])
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.0f\t%d\n", mode, runs[mode], failed[mode], name, avg, p95)
+		}
+	}
+	return w.Flush()
+}
+
+// avgP95 returns the mean and the nearest-rank 95th percentile.
+func avgP95(vals []int64) (float64, int64) {
+	if len(vals) == 0 {
+		return 0, 0
+	}
+	sorted := append([]int64(nil), vals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+	rank := (95*len(sorted) + 99) / 100 // ceil(0.95 * n)
+	return float64(sum) / float64(len(sorted)), sorted[rank-1]
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readMetrics returns the records of a -metrics-out file.
+func readMetrics(t *testing.T, path string) []runMetrics {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []runMetrics
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var m runMetrics
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("%s: %v", sc.Text(), err)
+		}
+		records = append(records, m)
+	}
+	return records
+}
+
+func TestMetricsRecordFailedRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	bundle := fixture("enterprise-attack-2.1.json")
+
+	stdout, _ := runMain(t, "-ngql", "-no-db", "-bundle-path", bundle, "-mitigation", "M1026", "-metrics-out", path)
+	if _, stderr, code := runMainExit(t, "-ngql", "-no-db", "-bundle-path", bundle, "-mitigation", "M9999", "-metrics-out", path); code == 0 {
+		t.Fatalf("unknown mitigation succeeded:\n%s", stderr)
+	}
+
+	records := readMetrics(t, path)
+	if len(records) != 2 {
+		t.Fatalf("%d records, want one per run", len(records))
+	}
+	if ok, failed := records[0], records[1]; ok.Exit != 0 || failed.Exit == 0 {
+		t.Errorf("exit statuses %d and %d, want 0 and non-zero", ok.Exit, failed.Exit)
+	}
+
+	// Counted as generated, matching the script
+	want := map[string]int{}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		switch {
+		case strings.HasPrefix(line, "INSERT VERTEX IF NOT EXISTS "+defaultGraphNames.TechniqueTag):
+			want["technique_vertex"]++
+		case strings.HasPrefix(line, "INSERT EDGE IF NOT EXISTS "+defaultGraphNames.SubtechniqueEdge+" "):
+			want["has_subtechnique_edge"]++
+		case strings.HasPrefix(line, "INSERT EDGE IF NOT EXISTS "+defaultGraphNames.PartOfEdge+" "):
+			want["part_of_edge"]++
+		case strings.HasPrefix(line, "INSERT EDGE IF NOT EXISTS "+defaultGraphNames.MitigatesEdge):
+			want["mitigates_edge"]++
+		}
+	}
+	if want["mitigates_edge"] == 0 {
+		t.Fatalf("no mitigates edges in the script:\n%s", stdout)
+	}
+	for kind, n := range want {
+		if got := records[0].Statements[kind]; got != n {
+			t.Errorf("%s: recorded %d, script has %d", kind, got, n)
+		}
+	}
+
+	var stats bytes.Buffer
+	if err := printHistoryStats(path, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stats.String(), "ngql  2     1") {
+		t.Errorf("history stats don't show 2 runs, 1 failed:\n%s", stats.String())
+	}
+}
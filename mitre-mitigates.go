@@ -11,7 +11,7 @@
 //
 //   go mod init mitremit
 //   go get github.com/vesoft-inc/nebula-go/v3
-//   go build -o mitremit mitre-mitigates-enhanced.go
+//   go build -o mitremit .
 //   export NEBULA_HOST="192.168.1.100"
 //   export NEBULA_PORT="9669"
 //   export NEBULA_USER="root"
@@ -25,18 +25,28 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 
 	nebula "github.com/vesoft-inc/nebula-go/v3"
 )
@@ -50,6 +60,84 @@ var (
 	// `-debug` can be placed anywhere on the command line.
 	// It defaults to false and is parsed in `main` before any work.
 	flagDbg = flag.Bool("debug", false, "extra diagnostic output")
+
+	// `-follow-revoked` switches a revoked mitigation to the object
+	// named by its `revoked-by` relationship instead of stopping.
+	flagFollowRevoked = flag.Bool("follow-revoked", false, "follow revoked-by relationships to the replacement object")
+
+	// `-diff-confirm` makes -execute show what will change in the
+	// database instead of the full script before asking to proceed.
+	flagDiffConfirm = flag.Bool("diff-confirm", false, "show a DB-vs-ATT&CK diff instead of the full script before executing")
+
+	// `-quiet` leaves only the requested data on stdout and errors and
+	// warnings on stderr: banners, summaries, progress and per-step
+	// chatter are dropped. It is -log-level warn; -debug wins over it.
+	// An -execute run that prompts still shows its summary and steps.
+	flagQuiet = flag.Bool("quiet", false, "print only the requested data, warnings and errors")
+
+	// `-log-level` sets the stderr verbosity (see mitre-log.go) and
+	// overrides -quiet and -debug.
+	flagLogLevel = flag.String("log-level", "", "stderr verbosity: error, warn, info (default) or debug")
+
+	// `-yes` answers every confirmation prompt with "yes" (for CI).
+	flagYes = flag.Bool("yes", false, "assume yes for confirmation prompts (non-interactive)")
+
+	// `-strict` turns data-quality warnings (unmapped tactics, skipped
+	// bundle objects) into fatal errors.
+	flagStrict = flag.Bool("strict", false, "treat data-quality warnings as errors")
+
+	// `-bundle-path` reads the STIX bundle from a local file, a directory
+	// of domain bundles or stdin ("-"); the cache and the network are
+	// never touched (air-gapped environments). `-bundle-file` is its old
+	// name.
+	flagBundlePath = flag.String("bundle-path", "", "read the ATT&CK bundle from this file, directory or - (stdin) instead of the cache or network")
+	flagBundleFile = flag.String("bundle-file", "", "Deprecated: -bundle-path.")
+
+	// `-proxy` overrides HTTPS_PROXY/HTTP_PROXY for the bundle download;
+	// `-http-timeout` bounds the whole request so a black-holed proxy
+	// can't hang the tool.
+	flagProxy       = flag.String("proxy", "", "HTTP(S) proxy URL for downloads (default: HTTPS_PROXY/HTTP_PROXY)")
+	flagHTTPTimeout = flag.Duration("http-timeout", 60*time.Second, "timeout for the bundle download")
+
+	// `-download-retries` is how often a failed download is tried in all;
+	// see mitre-retry.go for what counts as transient.
+	flagDownloadRetries = flag.Int("download-retries", 3, "download attempts before giving up on network errors, 5xx and 429 (1 = no retry)")
+
+	// `-bundle-url` (or MITRE_BUNDLE_URL) downloads from a mirror instead
+	// of GitHub; see bundleURL in mitre-domain.go.
+	flagBundleURL = flag.String("bundle-url", "", "download the bundle from this URL instead of GitHub (default: MITRE_BUNDLE_URL)")
+
+	// `-attack-version` pins the ATT&CK release; see attackVersion in
+	// mitre-domain.go.
+	flagAttackVersion = flag.String("attack-version", "", "use this ATT&CK release (e.g. 15.1) instead of the latest on mitre/cti master")
+
+	// `-checksum` pins the SHA-256 of the bundle (see mitre-checksum.go).
+	flagChecksum = flag.String("checksum", "", "expected SHA-256 (hex) of the ATT&CK bundle")
+
+	// `-skip-validation` accepts bundles that fail the sanity checks in
+	// mitre-validate.go (custom or trimmed bundles).
+	flagSkipValidation = flag.Bool("skip-validation", false, "use the bundle even if it fails the sanity checks")
+
+	// `-cache-compress` stores cached bundles gzipped (see mitre-cache.go);
+	// `-compress-cache` is its old, opt-in name.
+	flagCompressCache = flag.Bool("cache-compress", true, "store cached bundles as .json.gz (false: plain .json)")
+
+	// `-cache-ttl` expires the cached bundle; `-refresh` always downloads,
+	// `-cache-only` never does.
+	flagCacheTTL  = flag.Duration("cache-ttl", 7*24*time.Hour, "re-download a cached bundle older than this (0: never)")
+	flagRefresh   = flag.Bool("refresh", false, "download the bundle even if the cache is fresh")
+	flagCacheOnly = flag.Bool("cache-only", false, "never download; use the cached bundle whatever its age")
+
+	// `-offline` (or MITRE_OFFLINE=1) is -cache-only for disconnected
+	// hosts: no HTTP request at all, and a missing cache fails at once
+	// with instructions for seeding it. Nebula connections are unaffected.
+	flagOffline = flag.Bool("offline", false, "make no HTTP requests: use only the cache or -bundle-path (default: MITRE_OFFLINE)")
+
+	// `-no-index-cache` always parses the bundle (see mitre-index.go).
+	flagNoIndexCache = flag.Bool("no-index-cache", false, "Always parse the bundle; don't read or write the parsed index in the cache.")
+
+	// `-cache-dir` (or MITRE_CACHE_DIR) moves the cache; see setupCacheDir.
+	flagCacheDir = flag.String("cache-dir", "", "directory for cached bundles (default: MITRE_CACHE_DIR or the user cache directory)")
 )
 
 /*
@@ -60,23 +148,28 @@ Minimal STIX structures we need
 
 type Bundle struct {
 	Type        string            `json:"type"`
-	SpecVersion string            `json:"spec_version"`
+	ID          string            `json:"id,omitempty"`
+	SpecVersion string            `json:"spec_version,omitempty"`
 	Objects     []json.RawMessage `json:"objects"`
 }
 
-// envelope – only type and id are required for the first pass
-type baseObject struct {
-	Type string `json:"type"`
-	ID   string `json:"id"`
-}
-
 // Technique / sub-technique
 type attackPattern struct {
 	Type         string              `json:"type"`
 	ID           string              `json:"id"`
 	Name         string              `json:"name"`
+	Description  string              `json:"description,omitempty"`
 	ExternalRefs []externalReference `json:"external_references,omitempty"`
 	KillChain    []killChainPhase    `json:"kill_chain_phases,omitempty"`
+	Platforms    []string            `json:"x_mitre_platforms,omitempty"`
+	Detection    string              `json:"x_mitre_detection,omitempty"`
+	DataSources  []string            `json:"x_mitre_data_sources,omitempty"`
+	Domains      []string            `json:"x_mitre_domains,omitempty"` // e.g. enterprise-attack
+	Version      string              `json:"x_mitre_version,omitempty"`
+	Modified     string              `json:"modified,omitempty"`
+	Revoked      bool                `json:"revoked,omitempty"`
+	Deprecated   bool                `json:"x_mitre_deprecated,omitempty"`
+	Domain       string              `json:"-"` // label of the bundle it came from
 }
 
 // Kill chain phase (contains tactic info)
@@ -90,16 +183,48 @@ type courseOfAction struct {
 	Type         string              `json:"type"`
 	ID           string              `json:"id"`
 	Name         string              `json:"name"`
+	Description  string              `json:"description,omitempty"`
 	ExternalRefs []externalReference `json:"external_references,omitempty"`
+	Version      string              `json:"x_mitre_version,omitempty"`
+	Modified     string              `json:"modified,omitempty"`
+	Revoked      bool                `json:"revoked,omitempty"`
+	Deprecated   bool                `json:"x_mitre_deprecated,omitempty"`
+	Domain       string              `json:"-"` // label of the bundle it came from
 }
 
-// Relationship – we only care about relationship_type == "mitigates"
+// Relationship – we care about relationship_type == "mitigates" and "revoked-by"
 type relationship struct {
 	Type             string `json:"type"`
 	ID               string `json:"id"`
 	RelationshipType string `json:"relationship_type"`
 	SourceRef        string `json:"source_ref"` // mitigation
 	TargetRef        string `json:"target_ref"` // technique
+	Modified         string `json:"modified,omitempty"`
+	Revoked          bool   `json:"revoked,omitempty"`
+	Deprecated       bool   `json:"x_mitre_deprecated,omitempty"`
+	Domain           string `json:"-"` // label of the bundle it came from
+}
+
+// Tactic – phase_name in kill chains matches x_mitre_shortname
+type xMitreTactic struct {
+	Type         string              `json:"type"`
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	ShortName    string              `json:"x_mitre_shortname"`
+	ExternalRefs []externalReference `json:"external_references,omitempty"`
+}
+
+// Data source and data component – components detect techniques through
+// "detects" relationships and name their source by STIX ID
+type xMitreDataSource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type xMitreDataComponent struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	SourceRef string `json:"x_mitre_data_source_ref"`
 }
 
 // External reference (the place where ATT&CK stores the human-readable ID)
@@ -123,22 +248,186 @@ func externalID(refs []externalReference) (string, bool) {
 	return "", false
 }
 
+// techniqueURL is the technique's attack.mitre.org page: the URL on its
+// ATT&CK reference, or one built from the ID when the reference has none.
+func techniqueURL(id string, refs []externalReference) string {
+	if u := externalURL(refs); u != "" {
+		return u
+	}
+	return attackURL(id)
+}
+
+// externalURL returns the attack.mitre.org URL stored next to the ATT&CK ID.
+func externalURL(refs []externalReference) string {
+	for _, r := range refs {
+		if strings.EqualFold(r.SourceName, "mitre-attack") && r.URL != "" {
+			return r.URL
+		}
+	}
+	return ""
+}
+
 /*
 -------------------------------------------------------------
-Download & cache the ATT&CK bundle
+Revocation helpers – follow `revoked-by` relationships
 -------------------------------------------------------------
 */
-const (
-	bundleURL = "https://raw.githubusercontent.com/mitre/cti/master/enterprise-attack/enterprise-attack.json"
-	cacheDir  = ".mitre-cache"
-)
 
-func fetchBundle() ([]byte, error) {
+// resolveRevoked follows the revoked-by chain starting at stixID and returns
+// the last object in it. The second result is false when stixID has no
+// recorded replacement. Cycles are cut off at the first repeated ID.
+func resolveRevoked(stixID string, revokedBy map[string]string) (string, bool) {
+	seen := map[string]bool{stixID: true}
+	cur := stixID
+	for {
+		next, ok := revokedBy[cur]
+		if !ok || seen[next] {
+			break
+		}
+		seen[next] = true
+		cur = next
+	}
+	return cur, cur != stixID
+}
+
+// revokedNote renders the "revoked, replaced by X" message for a STIX object,
+// using the ATT&CK external ID of the replacement when it is known.
+func revokedNote(stixID string, revokedBy map[string]string, mitMap map[string]courseOfAction, techMap map[string]attackPattern) string {
+	repl, ok := resolveRevoked(stixID, revokedBy)
+	if !ok {
+		return "revoked, no replacement recorded"
+	}
+
+	label := repl
+	if co, found := mitMap[repl]; found {
+		if ext, ok := externalID(co.ExternalRefs); ok {
+			label = fmt.Sprintf("%s (%s)", ext, co.Name)
+		}
+	} else if ap, found := techMap[repl]; found {
+		if ext, ok := externalID(ap.ExternalRefs); ok {
+			label = fmt.Sprintf("%s (%s)", ext, ap.Name)
+		}
+	}
+	return "revoked, replaced by " + label
+}
+
+/*
+-------------------------------------------------------------
+Mitigation name matching – partial and "did you mean"
+-------------------------------------------------------------
+*/
+
+// matchMitigationName returns the STIX IDs of non-revoked mitigations whose
+// name contains query (case-insensitive), sorted by external ID.
+func matchMitigationName(mitMap map[string]courseOfAction, query string) []string {
+	q := strings.ToLower(query)
+	var ids []string
+	for id, co := range mitMap {
+		if !co.Revoked && strings.Contains(strings.ToLower(co.Name), q) {
+			ids = append(ids, id)
+		}
+	}
+	sortByExternalID(ids, mitMap)
+	return ids
+}
+
+// closestMitigationNames returns up to n mitigations whose names are within a
+// small edit distance of query – enough to catch typos.
+func closestMitigationNames(mitMap map[string]courseOfAction, query string, n int) []string {
+	q := strings.ToLower(query)
+	maxDist := len(q)/4 + 1
+
+	type scored struct {
+		id   string
+		dist int
+	}
+	var hits []scored
+	for id, co := range mitMap {
+		if co.Revoked {
+			continue
+		}
+		if d := levenshtein(q, strings.ToLower(co.Name)); d <= maxDist {
+			hits = append(hits, scored{id, d})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].dist != hits[j].dist {
+			return hits[i].dist < hits[j].dist
+		}
+		return hits[i].id < hits[j].id
+	})
+
+	var ids []string
+	for i := 0; i < len(hits) && i < n; i++ {
+		ids = append(ids, hits[i].id)
+	}
+	return ids
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func sortByExternalID(ids []string, mitMap map[string]courseOfAction) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := externalID(mitMap[ids[i]].ExternalRefs)
+		b, _ := externalID(mitMap[ids[j]].ExternalRefs)
+		return a < b
+	})
+}
+
+func printMitigationCandidates(out io.Writer, mitMap map[string]courseOfAction, ids []string) {
+	for _, id := range ids {
+		co := mitMap[id]
+		ext, _ := externalID(co.ExternalRefs)
+		fmt.Fprintf(out, "  %-6s %s\n", ext, co.Name)
+	}
+}
+
+/*
+-------------------------------------------------------------
+Download & cache the ATT&CK bundle
+-------------------------------------------------------------
+*/
+// fetchBundle returns the bundle of one ATT&CK domain: -bundle-path, the
+// cached copy or a fresh download.
+func fetchBundle(dom attackDomain) ([]byte, error) {
 	// -----------------------------------------------------------------
 	// DEBUG: tell us we entered the function
 	// -----------------------------------------------------------------
-	if *flagDbg {
-		fmt.Fprintln(os.Stdout, ">>> fetchBundle() – entry point")
+	debugf("fetchBundle() – entry point\n")
+
+	// -----------------------------------------------------------------
+	// 0️⃣ A local -bundle-path bypasses cache and download entirely
+	// -----------------------------------------------------------------
+	if *flagBundlePath != "" {
+		path, err := localBundlePath(*flagBundlePath, dom)
+		if err != nil {
+			return nil, err
+		}
+		debugf("reading bundle from %s\n", path)
+		data, err := readBundleFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return data, verifyChecksum(data, path)
 	}
 
 	// -----------------------------------------------------------------
@@ -148,51 +437,304 @@ func fetchBundle() ([]byte, error) {
 		return nil, err
 	}
 
-	bundlePath := filepath.Join(cacheDir, "enterprise-attack.json")
-
 	// -----------------------------------------------------------------
-	// 2️⃣ Use cached bundle if it exists
+	// 2️⃣ Use cached bundle if it exists (.json.gz or .json) and is
+	//    fresh enough
 	// -----------------------------------------------------------------
-	if cached, err := os.ReadFile(bundlePath); err == nil {
-		if *flagDbg {
-			fmt.Fprintln(os.Stdout, ">>> cached bundle found – returning cached data")
+	cached, err := readCachedBundle(dom)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		// A copy -checksum doesn't accept is a miss, unless it's all we may use
+		var mismatch *checksumMismatchError
+		if err := verifyChecksum(cached.Data, "cached bundle"); errors.As(err, &mismatch) && !*flagCacheOnly && !*flagOffline {
+			infof("%v; downloading it again\n", err)
+			cached = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	var cond httpValidators // empty: unconditional download
+	if cached != nil {
+		age := cached.Age
+		// A pinned release never changes, so its copy doesn't go stale
+		stale := cacheStale(age) && attackVersion == ""
+		switch {
+		case *flagOffline:
+			if stale {
+				warnf("cached %s bundle is %s old (-cache-ttl %s); using it because of -offline\n",
+					dom.Name, formatAge(age), formatAge(*flagCacheTTL))
+			}
+		case *flagCacheOnly:
+			if stale {
+				warnf("cached %s bundle is %s old (-cache-ttl %s); using it because of -cache-only\n",
+					dom.Name, formatAge(age), formatAge(*flagCacheTTL))
+			}
+		case *flagRefresh:
+			infof("cached %s bundle is %s old; -refresh downloads it again\n", dom.Name, formatAge(age))
+		case stale:
+			infof("cached %s bundle is %s old (-cache-ttl %s); checking for a newer one\n", dom.Name, formatAge(age), formatAge(*flagCacheTTL))
+		}
+		if *flagCacheOnly || *flagOffline || (!stale && !*flagRefresh) {
+			infof("using cached %s bundle (%s old)\n", dom.Name, formatAge(age))
+			return cached.Data, nil // fast path – return cache
 		}
-		return cached, nil // fast path – return cache
+		// A stale copy is revalidated; -refresh always downloads
+		if !*flagRefresh {
+			cond = readValidators(dom, dom.url())
+		}
+	} else if *flagCacheOnly || *flagOffline {
+		return nil, missingCacheError(dom)
 	}
 
 	// -----------------------------------------------------------------
-	// 3️⃣ Download bundle
+	// 3️⃣ Download bundle – one run per cache file at a time
+	//    (mitre-lock.go)
 	// -----------------------------------------------------------------
-	if *flagDbg {
-		fmt.Fprintln(os.Stdout, ">>> downloading ATT&CK bundle")
+	unlock, waited, err := lockCache(dom)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if waited > 0 {
+		// The run we waited for has most likely just written the cache
+		if fresh, err := readCachedBundle(dom); err == nil && fresh != nil && fresh.Age < waited && verifyChecksum(fresh.Data, "cached bundle") == nil {
+			infof("using the %s bundle the other run just downloaded\n", dom.Name)
+			return fresh.Data, nil
+		}
 	}
 
-	data, err := downloadBundle()
+	debugf("downloading ATT&CK bundle\n")
+
+	data, got, err := downloadValidBundle(dom, cond)
+	if errors.Is(err, errNotModified) {
+		infof("cached %s bundle is current (HTTP 304)\n", dom.Name)
+		touchCache(cached)
+		return cached.Data, nil
+	}
 	if err != nil {
-		return nil, err
+		// Ctrl-C means stop, not "use what you have"
+		if cached == nil || errors.Is(err, context.Canceled) {
+			var se *httpStatusError
+			if attackVersion != "" && errors.As(err, &se) && se.Status == http.StatusNotFound {
+				return nil, unknownVersionError(dom, se.URL)
+			}
+			return nil, err
+		}
+		// An old bundle beats no bundle
+		warnf("%v; using the cached %s bundle (%s old)\n", err, dom.Name, formatAge(cached.Age))
+		return cached.Data, nil
 	}
 
-	if *flagDbg {
-		fmt.Fprintf(os.Stdout, ">>> downloaded bundle (%d bytes) – caching\n", len(data))
+	debugf("downloaded bundle (%d bytes) – caching\n", len(data))
+
+	// A mismatch means the download is neither cached nor used
+	if err := verifyChecksum(data, "downloaded bundle"); err != nil {
+		return nil, err
 	}
 
-	_ = os.WriteFile(bundlePath, data, 0o644)
+	if err := writeCachedBundle(dom, data); err != nil {
+		debugf("caching the bundle failed: %v\n", err)
+	} else if err := writeValidators(dom, got); err != nil {
+		debugf("storing ETag/Last-Modified failed: %v\n", err)
+	}
 	return data, nil
 }
 
-/* ---------- helper used by fetchBundle ---------- */
-func downloadBundle() ([]byte, error) {
-	resp, err := http.Get(bundleURL)
+/* ---------- helpers used by fetchBundle ---------- */
+
+// downloadValidBundle downloads the bundle of dom and validates it. One
+// retry covers a connection cut mid-transfer. cond makes the request
+// conditional; errNotModified means the cached copy is current.
+func downloadValidBundle(dom attackDomain, cond httpValidators) ([]byte, httpValidators, error) {
+	data, got, err := downloadWithRetry(dom.url(), cond)
+	if err != nil {
+		return nil, got, err
+	}
+	if err := validateBundle(data, "downloaded bundle"); err != nil {
+		warnf("%v; retrying the download once\n", err)
+		if data, got, err = downloadWithRetry(dom.url(), httpValidators{}); err != nil {
+			return nil, got, err
+		}
+		if err := validateBundle(data, "downloaded bundle"); err != nil {
+			return nil, got, err
+		}
+	}
+	return data, got, nil
+}
+
+// errNotModified is a 304 answer to a conditional download.
+var errNotModified = errors.New("bundle not modified")
+
+// localBundlePath resolves -bundle-path for dom: a directory holds one
+// <collection>.json (or .json.gz) per domain; a file or "-" is used as-is.
+func localBundlePath(value string, dom attackDomain) (string, error) {
+	if value == "-" {
+		return value, nil
+	}
+	info, err := os.Stat(value)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("-bundle-path %s: file not found", value)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return value, nil
+	}
+	for _, name := range []string{dom.Collection + ".json", dom.Collection + ".json.gz"} {
+		path := filepath.Join(value, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("-bundle-path %s: file not found: the directory has no %s.json for -domain %s", value, dom.Collection, dom.Name)
+}
+
+// readBundleFile reads a user-supplied bundle ("-" is stdin, *.gz is
+// decompressed) and checks that it is one.
+func readBundleFile(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		path = "bundle on stdin"
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		if data, err = gunzip(data); err != nil {
+			return nil, fmt.Errorf("%s is not valid gzip: %w", path, err)
+		}
+	}
+	return data, validateBundle(data, path)
+}
+
+// httpClient honours -proxy (falling back to HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY) and -http-timeout.
+func httpClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if *flagProxy != "" {
+		proxyURL, err := url.Parse(*flagProxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid -proxy %q", *flagProxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Transport: transport, Timeout: *flagHTTPTimeout}, nil
+}
+
+// userAgent names the tool, its version and platform for proxy logs.
+func userAgent() string {
+	return fmt.Sprintf("mitremit/%s (%s/%s; %s)", version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
+
+// downloadBundle fetches bundleURL, conditionally when cond has an ETag or
+// Last-Modified, and returns the validators of the response. Ctrl-C aborts
+// the transfer with an error wrapping context.Canceled. Failures name the
+// URL and how long the attempt took. Progress is shown as described in
+// mitre-progress.go.
+func downloadBundle(bundleURL string, cond httpValidators) ([]byte, httpValidators, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, cond, err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bundleURL, nil)
+	if err != nil {
+		return nil, cond, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if cond.ETag != "" {
+		req.Header.Set("If-None-Match", cond.ETag)
+	}
+	if cond.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cond.LastModified)
+	}
+
+	start := time.Now()
+	failed := func(err error) error {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("interrupted: %w", ctx.Err())
+		}
+		return &transportError{fmt.Errorf("download %s failed after %s: %w", bundleURL, time.Since(start).Round(time.Millisecond), err)}
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("download bundle: %w", err)
+		return nil, cond, failed(err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && (cond.ETag != "" || cond.LastModified != "") {
+		return nil, cond, errNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bundle HTTP %d", resp.StatusCode)
+		// Proxies explain themselves in the body; show the start of it
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, cond, &httpStatusError{
+			URL:        bundleURL,
+			Status:     resp.StatusCode,
+			Msg:        singleLine(string(snippet)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	got := httpValidators{URL: bundleURL, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	var body io.Reader = resp.Body
+	progress := newDownloadProgress(resp.Body, bundleURL, resp.ContentLength)
+	if progress != nil {
+		body = progress
+	}
+	data, err := io.ReadAll(body)
+	progress.done(err)
+	if err != nil {
+		return nil, got, failed(fmt.Errorf("reading body after %d bytes: %w", len(data), err))
+	}
+	return data, got, nil
+}
+
+/*
+-------------------------------------------------------------
+Atomic file writes – temp file in the same directory, then rename
+-------------------------------------------------------------
+*/
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	// Reports are meant to be shared
+	return writeFileAtomicMode(path, 0o644, write)
+}
+
+// writeFileAtomicMode is writeFileAtomic for a file with permissions perm.
+func writeFileAtomicMode(path string, perm os.FileMode, write func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
 	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
 
-	return io.ReadAll(resp.Body)
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
 }
 
 /*
@@ -204,7 +746,80 @@ Core extraction logic
 type techniqueInfo struct {
 	ExternalID string   `json:"external_id"`
 	Name       string   `json:"name"`
-	Tactics    []string `json:"tactics,omitempty"` // Tactic phase names
+	Tactics    []string `json:"tactics,omitempty"`   // Tactic phase names
+	Platforms  []string `json:"platforms,omitempty"` // sorted, case duplicates removed
+	URL        string   `json:"url,omitempty"`       // attack.mitre.org page
+	Domain     string   `json:"domain,omitempty"`    // domain of the mitigates relationship, e.g. "Enterprise"
+	ParentID   string   `json:"parent_id,omitempty"` // sub-techniques only
+	ParentName string   `json:"parent_name,omitempty"`
+
+	// The revoked technique the mitigates relationship actually names,
+	// when it was resolved to this one through revoked-by
+	RevokedFrom string `json:"revoked_from,omitempty"`
+
+	// Enrichment – only emitted with -full (see brief); Description also
+	// with -describe-techniques. JSON keeps the raw text, citations and all
+	Description string   `json:"description,omitempty"`
+	Detection   string   `json:"detection,omitempty"`
+	DataSources []string `json:"data_sources,omitempty"` // x_mitre_data_sources plus detecting components
+	Version     string   `json:"version,omitempty"`      // x_mitre_version of the technique
+	Domains     []string `json:"domains,omitempty"`      // x_mitre_domains, e.g. enterprise-attack
+}
+
+// brief drops the enrichment fields so default JSON stays small; describe
+// keeps the description (-describe-techniques).
+func (t techniqueInfo) brief(describe bool) techniqueInfo {
+	b := techniqueInfo{ExternalID: t.ExternalID, Name: t.Name, Tactics: t.Tactics, Platforms: t.Platforms, URL: t.URL, Domain: t.Domain,
+		ParentID: t.ParentID, ParentName: t.ParentName, RevokedFrom: t.RevokedFrom}
+	if describe {
+		b.Description = t.Description
+	}
+	return b
+}
+
+// displayName is the name as the ATT&CK site shows it: sub-techniques are
+// prefixed with their parent ("Command and Scripting Interpreter: PowerShell").
+func (t techniqueInfo) displayName() string {
+	if t.ParentName == "" {
+		return t.Name
+	}
+	return t.ParentName + ": " + t.Name
+}
+
+// normalizeLabels sorts platforms, data sources and the like
+// case-insensitively and drops case variants of one already seen ("macos"
+// after "macOS").
+func normalizeLabels(labels []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range labels {
+		key := strings.ToLower(strings.TrimSpace(p))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, strings.TrimSpace(p))
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i]) < strings.ToLower(out[j]) })
+	return out
+}
+
+// citationPattern matches ATT&CK's inline "(Citation: Source)" markers.
+var citationPattern = regexp.MustCompile(`\s*\(Citation:[^)]*\)`)
+
+// displayDescription is a description for people: citations removed and
+// whitespace collapsed.
+func displayDescription(s string) string {
+	return singleLine(citationPattern.ReplaceAllString(s, ""))
+}
+
+// firstSentence returns the display description up to its first full stop.
+func firstSentence(s string) string {
+	s = displayDescription(s)
+	if i := strings.Index(s, ". "); i >= 0 {
+		return s[:i+1]
+	}
+	return s
 }
 
 /*
@@ -239,6 +854,15 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 func getEnvInt(key string, defaultVal int) int {
 	if val := os.Getenv(key); val != "" {
 		if i, err := strconv.Atoi(val); err == nil {
@@ -248,6 +872,10 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// errSpaceUnusable is wrapped by connectNebula when the connection works but
+// the configured space cannot be selected.
+var errSpaceUnusable = errors.New("space not usable")
+
 func connectNebula(cfg nebulaConfig) (*nebula.Session, func(), error) {
 	hostAddress := nebula.HostAddress{Host: cfg.Host, Port: cfg.Port}
 	poolConfig := nebula.GetDefaultConf()
@@ -265,11 +893,17 @@ func connectNebula(cfg nebulaConfig) (*nebula.Session, func(), error) {
 
 	// Switch to space
 	useSpaceQuery := fmt.Sprintf("USE %s;", cfg.Space)
-	if _, err := session.Execute(useSpaceQuery); err != nil {
+	result, err := session.Execute(useSpaceQuery)
+	if err != nil {
 		session.Release()
 		pool.Close()
 		return nil, nil, fmt.Errorf("failed to USE space %s: %w", cfg.Space, err)
 	}
+	if !result.IsSucceed() {
+		session.Release()
+		pool.Close()
+		return nil, nil, fmt.Errorf("failed to USE space %s: %s: %w", cfg.Space, result.GetErrorMsg(), errSpaceUnusable)
+	}
 
 	cleanup := func() {
 		session.Release()
@@ -279,18 +913,36 @@ func connectNebula(cfg nebulaConfig) (*nebula.Session, func(), error) {
 	return session, cleanup, nil
 }
 
+// nebulaServerVersion is the version of the graphd behind session (from
+// SHOW HOSTS GRAPH), or "" when it can't be read.
+func nebulaServerVersion(session *nebula.Session) string {
+	result, err := session.Execute("SHOW HOSTS GRAPH;")
+	if err != nil || !result.IsSucceed() || result.GetRowSize() == 0 {
+		debugf("SHOW HOSTS GRAPH: no server version (%v)\n", err)
+		return ""
+	}
+	record, err := result.GetRowValuesByIndex(0)
+	if err != nil {
+		return ""
+	}
+	val, err := record.GetValueByColName("Version")
+	if err != nil {
+		return ""
+	}
+	v, _ := val.AsString()
+	return v
+}
+
 /*
 -------------------------------------------------------------
 Database query functions
 -------------------------------------------------------------
 */
 
-func checkMitigationExists(session *nebula.Session, mitigationID string) (bool, error) {
-	query := fmt.Sprintf(`MATCH (m:tMitreMitigation) WHERE id(m) == "%s" RETURN id(m) AS mitigation;`, mitigationID)
+func checkMitigationExists(session *nebula.Session, g graphNames, mitigationID string) (bool, error) {
+	query := fmt.Sprintf(`MATCH (m:%s) WHERE id(m) == "%s" RETURN id(m) AS mitigation;`, g.MitigationTag, mitigationID)
 
-	if *flagDbg {
-		fmt.Fprintf(os.Stderr, ">>> Query: %s\n", query)
-	}
+	debugf("Query: %s\n", query)
 
 	result, err := session.Execute(query)
 	if err != nil {
@@ -300,7 +952,89 @@ func checkMitigationExists(session *nebula.Session, mitigationID string) (bool,
 	return result.GetRowSize() > 0, nil
 }
 
-func findMissingTechniques(session *nebula.Session, techniqueIDs []string) ([]string, error) {
+// insertMitigationStmt builds the INSERT for a missing mitigation vertex from
+// its STIX object. String values are cut to the tag's FIXED_STRING sizes
+// when limits is non-nil, or with strict set (-no-truncate) make an error,
+// as in fitTechniques. The ID is never cut.
+func insertMitigationStmt(g graphNames, mitigationID string, co courseOfAction, limits map[string]int, strict bool) (string, []truncation, error) {
+	values := []struct{ col, val string }{
+		{"Mitigation_ID", mitigationID},
+		{"Mitigation_Name", co.Name},
+		{"Matrix", co.Domain},
+		{"Description", singleLine(co.Description)},
+		{"Mitigation_Version", co.Version},
+	}
+
+	var truncs []truncation
+	var overlong []string
+	literals := make([]string, len(values))
+	for i, v := range values {
+		n, ok := limits[v.col]
+		switch {
+		case !ok || len(v.val) <= n:
+		case v.col == "Mitigation_ID":
+			return "", nil, fmt.Errorf("mitigation ID %s is %d bytes, %s holds %d", mitigationID, len(v.val), v.col, n)
+		case strict:
+			overlong = append(overlong, fmt.Sprintf("%s %s (%d bytes > %d)", mitigationID, v.col, len(v.val), n))
+		default:
+			short := truncateUTF8(v.val, n)
+			truncs = append(truncs, truncation{Object: mitigationID, Field: v.col, Limit: n, Original: len(v.val), Kept: len(short)})
+			v.val = short
+		}
+		literals[i] = quoteLiteral(v.val)
+	}
+	if len(overlong) > 0 {
+		return "", nil, fmt.Errorf("values exceed column sizes (-no-truncate):\n  %s", strings.Join(overlong, "\n  "))
+	}
+
+	stmt := fmt.Sprintf("INSERT VERTEX IF NOT EXISTS %s(Mitigation_ID, Mitigation_Name, Matrix, Description, Mitigation_Version) VALUES %s:(%s);",
+		g.MitigationTag, quoteID(mitigationID), strings.Join(literals, ", "))
+	return stmt, truncs, nil
+}
+
+// singleLine collapses runs of whitespace, newlines included, into single
+// spaces so a value fits on one statement line.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// createMitigation inserts the mitigation vertex (-auto-create-mitigation)
+// after showing the statement and asking for confirmation. strict is
+// -no-truncate: overlong values fail before the prompt.
+func createMitigation(session *nebula.Session, g graphNames, mitigationID string, co courseOfAction, strict bool) error {
+	limits, err := describeStringLimits(session, g.MitigationTag)
+	if err != nil {
+		return fmt.Errorf("reading %s schema: %w", g.MitigationTag, err)
+	}
+	stmt, truncs, err := insertMitigationStmt(g, mitigationID, co, limits, strict)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Mitigation %s does not exist in the database; it will be created with:\n%s\n\n", mitigationID, stmt)
+	printTruncations(os.Stderr, truncs)
+	ok, err := confirm("Create the mitigation vertex?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
+	}
+
+	debugf("Executing: %s\n", stmt)
+	result, err := session.Execute(stmt)
+	if err != nil {
+		return fmt.Errorf("failed to insert mitigation %s: %w", mitigationID, err)
+	}
+	if !result.IsSucceed() {
+		return fmt.Errorf("failed to insert mitigation %s: %s", mitigationID, result.GetErrorMsg())
+	}
+	infof("✓ Created mitigation vertex %s\n", mitigationID)
+	metrics.count("mitigation_vertex", 1)
+	return nil
+}
+
+func findMissingTechniques(session *nebula.Session, g graphNames, techniqueIDs []string) ([]string, error) {
 	if len(techniqueIDs) == 0 {
 		return nil, nil
 	}
@@ -312,48 +1046,18 @@ func findMissingTechniques(session *nebula.Session, techniqueIDs []string) ([]st
 	}
 	inClause := strings.Join(quotedIDs, ", ")
 
-	query := fmt.Sprintf(`MATCH (t:tMitreTechnique) WHERE id(t) IN [%s] RETURN collect(id(t)) AS techniques;`, inClause)
+	query := fmt.Sprintf(`MATCH (t:%s) WHERE id(t) IN [%s] RETURN collect(id(t)) AS techniques;`, g.TechniqueTag, inClause)
 
-	if *flagDbg {
-		fmt.Fprintf(os.Stderr, ">>> Query: %s\n", query)
-	}
+	debugf("Query: %s\n", query)
 
 	result, err := session.Execute(query)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
 
-	var foundTechniques []string
-	if result.GetRowSize() > 0 {
-		// Get first row
-		record, err := result.GetRowValuesByIndex(0)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get row: %w", err)
-		}
-
-		// Get first column value (index 0)
-		val, err := record.GetValueByIndex(0)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get value: %w", err)
-		}
-
-		// Check if it's a list
-		if val.IsList() {
-			list, err := val.AsList()
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert to list: %w", err)
-			}
-
-			// Extract string values from list
-			for _, item := range list {
-				if item.IsString() {
-					str, err := item.AsString()
-					if err == nil {
-						foundTechniques = append(foundTechniques, str)
-					}
-				}
-			}
-		}
+	foundTechniques, err := collectedStrings(result)
+	if err != nil {
+		return nil, err
 	}
 
 	// Find missing
@@ -372,17 +1076,73 @@ func findMissingTechniques(session *nebula.Session, techniqueIDs []string) ([]st
 	return missing, nil
 }
 
-/*
--------------------------------------------------------------
-nGQL generation functions
--------------------------------------------------------------
-*/
+// findMitigatedTechniques returns the IDs of the techniques the mitigation
+// vertex already has a mitigates edge to.
+func findMitigatedTechniques(session *nebula.Session, g graphNames, mitigationID string) ([]string, error) {
+	query := fmt.Sprintf(`MATCH (m:%s)-[e:%s]->(t) WHERE id(m) == "%s" RETURN collect(id(t)) AS techniques;`, g.MitigationTag, g.MitigatesEdge, mitigationID)
 
-// quoteID wraps an ID in double quotes for nGQL
-func quoteID(s string) string {
-	// Escape any double quotes in the string by doubling them
-	escaped := strings.ReplaceAll(s, `"`, `""`)
-	return `"` + escaped + `"`
+	debugf("Query: %s\n", query)
+
+	result, err := session.Execute(query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return collectedStrings(result)
+}
+
+// collectedStrings reads a single-row, single-column result holding a
+// `collect(...)` list and returns its string items.
+func collectedStrings(result *nebula.ResultSet) ([]string, error) {
+	var items []string
+	if result.GetRowSize() == 0 {
+		return items, nil
+	}
+
+	// Get first row
+	record, err := result.GetRowValuesByIndex(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get row: %w", err)
+	}
+
+	// Get first column value (index 0)
+	val, err := record.GetValueByIndex(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value: %w", err)
+	}
+
+	// Check if it's a list
+	if val.IsList() {
+		list, err := val.AsList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert to list: %w", err)
+		}
+
+		// Extract string values from list
+		for _, item := range list {
+			if item.IsString() {
+				str, err := item.AsString()
+				if err == nil {
+					items = append(items, str)
+				}
+			}
+		}
+	}
+
+	return items, nil
+}
+
+/*
+-------------------------------------------------------------
+nGQL generation functions
+-------------------------------------------------------------
+*/
+
+// quoteID wraps an ID in double quotes for nGQL
+func quoteID(s string) string {
+	// Escape any double quotes in the string by doubling them
+	escaped := strings.ReplaceAll(s, `"`, `""`)
+	return `"` + escaped + `"`
 }
 
 func quoteLiteral(s string) string {
@@ -402,8 +1162,13 @@ func getParentTechniqueID(techID string) string {
 	return techID
 }
 
+// tacticPhaseToID maps a kill-chain phase name to its tactic ID. It starts out
+// as the static Enterprise table and is replaced by the bundle's own
+// x-mitre-tactic objects once they are parsed (see tacticMapFromBundle).
+var tacticPhaseToID = staticTacticPhaseToID
+
 // Map tactic phase name to tactic ID (based on MITRE ATT&CK Enterprise matrix)
-var tacticPhaseToID = map[string]string{
+var staticTacticPhaseToID = map[string]string{
 	"reconnaissance":       "TA0043",
 	"resource-development": "TA0042",
 	"initial-access":       "TA0001",
@@ -420,11 +1185,180 @@ var tacticPhaseToID = map[string]string{
 	"impact":               "TA0040",
 }
 
-func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInfo, missingTechniques []string) string {
+// tacticMapFromBundle builds shortname -> TAxxxx from x-mitre-tactic objects.
+func tacticMapFromBundle(tactics []xMitreTactic) map[string]string {
+	m := make(map[string]string)
+	for _, t := range tactics {
+		if ext, ok := externalID(t.ExternalRefs); ok && t.ShortName != "" {
+			m[t.ShortName] = ext
+		}
+	}
+	return m
+}
+
+// tacticPhaseToName maps a phase name to the tactic's display name
+// ("defense-evasion" -> "Defense Evasion"), from the bundle's x-mitre-tactic
+// objects.
+var tacticPhaseToName = map[string]string{}
+
+// tacticNamesFromBundle builds shortname -> name from x-mitre-tactic objects.
+func tacticNamesFromBundle(tactics []xMitreTactic) map[string]string {
+	m := make(map[string]string)
+	for _, t := range tactics {
+		if t.ShortName != "" && t.Name != "" {
+			m[t.ShortName] = t.Name
+		}
+	}
+	return m
+}
+
+// tacticName returns the display name of a phase; without one from the
+// bundle the phase is title-cased ("command-and-control" -> "Command And
+// Control").
+func tacticName(phase string) string {
+	if name, ok := tacticPhaseToName[phase]; ok {
+		return name
+	}
+	words := strings.Split(phase, "-")
+	for i, w := range words {
+		if w != "" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// tacticLabel is "Defense Evasion (TA0005)", or just the name when the phase
+// has no tactic ID.
+func tacticLabel(phase string) string {
+	if id, ok := tacticPhaseToID[phase]; ok {
+		return tacticName(phase) + " (" + id + ")"
+	}
+	return tacticName(phase)
+}
+
+// tacticLabels joins tacticLabel of each phase.
+func tacticLabels(phases []string) string {
+	labels := make([]string, len(phases))
+	for i, p := range phases {
+		labels[i] = tacticLabel(p)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// unmappedTactics lists "T1234: phase" for every kill-chain phase of the given
+// techniques that has no tactic ID – those part_of edges cannot be created.
+func unmappedTactics(techniques []techniqueInfo, missingMap map[string]bool) []string {
+	var out []string
+	for _, t := range techniques {
+		if !missingMap[t.ExternalID] {
+			continue
+		}
+		for _, tacticPhase := range t.Tactics {
+			if _, ok := tacticPhaseToID[tacticPhase]; !ok {
+				out = append(out, fmt.Sprintf("%s: %s", t.ExternalID, tacticPhase))
+			}
+		}
+	}
+	return out
+}
+
+// checkTacticMapping warns about unmapped tactic phases and, under -strict,
+// returns an error so nothing is generated or executed.
+func checkTacticMapping(techniques []techniqueInfo, missingTechniques []string) error {
+	missingMap := make(map[string]bool)
+	for _, id := range missingTechniques {
+		missingMap[id] = true
+	}
+
+	unmapped := unmappedTactics(techniques, missingMap)
+	if len(unmapped) == 0 {
+		return nil
+	}
+
+	warnf("%d tactic phase(s) have no tactic ID; their part_of edges will be skipped:\n  %s\n", len(unmapped), strings.Join(unmapped, "\n  "))
+	if *flagStrict {
+		return fmt.Errorf("unmapped tactic phases (-strict)")
+	}
+	return nil
+}
+
+// tacticOrder is the left-to-right column order of the Enterprise matrix.
+var tacticOrder = []string{
+	"reconnaissance",
+	"resource-development",
+	"initial-access",
+	"execution",
+	"persistence",
+	"privilege-escalation",
+	"defense-evasion",
+	"credential-access",
+	"discovery",
+	"lateral-movement",
+	"collection",
+	"command-and-control",
+	"exfiltration",
+	"impact",
+}
+
+// tacticRank returns the matrix position of a phase name; unknown phases
+// sort after every known one.
+func tacticRank(phase string) int {
+	for i, p := range tacticOrder {
+		if p == phase {
+			return i
+		}
+	}
+	return len(tacticOrder)
+}
+
+// sortTechniques orders data by "id", "name" or "tactic" (first tactic in
+// matrix order, then ID). A leading "-" (e.g. "-name") reverses the primary
+// key; ties always fall back to ascending ID.
+func sortTechniques(data []techniqueInfo, by string) {
+	desc := strings.HasPrefix(by, "-")
+	by = strings.TrimPrefix(by, "-")
+
+	sort.SliceStable(data, func(i, j int) bool {
+		a, b := data[i], data[j]
+		if desc {
+			a, b = b, a
+		}
+		switch by {
+		case "name":
+			if !strings.EqualFold(a.Name, b.Name) {
+				return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+			}
+		case "tactic":
+			ra, rb := len(tacticOrder)+1, len(tacticOrder)+1
+			if len(a.Tactics) > 0 {
+				ra = tacticRank(a.Tactics[0])
+			}
+			if len(b.Tactics) > 0 {
+				rb = tacticRank(b.Tactics[0])
+			}
+			if ra != rb {
+				return ra < rb
+			}
+		case "id":
+			if a.ExternalID != b.ExternalID {
+				return a.ExternalID < b.ExternalID
+			}
+		}
+		return data[i].ExternalID < data[j].ExternalID
+	})
+}
+
+// generateNGQL returns the script and how many statements of each kind it
+// holds, under the names -execute counts them by (metrics.count).
+func generateNGQL(g graphNames, mitigationID, mitigationName string, techniques []techniqueInfo, missingTechniques []string) (string, map[string]int) {
 	var b strings.Builder
+	counts := make(map[string]int)
 
 	b.WriteString("-- ============================================================\n")
 	b.WriteString(fmt.Sprintf("-- nGQL script for mitigation %s (%s)\n", mitigationID, mitigationName))
+	b.WriteString(fmt.Sprintf("-- Data: %s\n", bundleRelease))
+	b.WriteString(fmt.Sprintf("-- Generated by mitremit %s\n", version))
 	b.WriteString("-- ============================================================\n\n")
 
 	// Create map of missing techniques for quick lookup
@@ -443,14 +1377,12 @@ func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInf
 				continue
 			}
 
-			b.WriteString(fmt.Sprintf("INSERT VERTEX IF NOT EXISTS tMitreTechnique(Technique_ID, Technique_Name, Mitre_Attack_Version, rcelpe, priority, execution_min, execution_max) VALUES %s:(%s, %s, \"18.0\", false, 4, 0.1667, 120);\n",
-				quoteID(t.ExternalID),
-				quoteLiteral(t.ExternalID),
-				quoteLiteral(t.Name)))
+			b.WriteString(techSchema.insertVertex(g.TechniqueTag, t) + "\n")
+			counts["technique_vertex"]++
 		}
 
 		b.WriteString("\n-- ============================================================\n")
-		b.WriteString("-- STEP 2: Insert has_subtechnique edges (parent to subtechnique)\n")
+		b.WriteString(fmt.Sprintf("-- STEP 2: Insert %s edges (parent to subtechnique)\n", g.SubtechniqueEdge))
 		b.WriteString("-- ============================================================\n\n")
 
 		for _, t := range techniques {
@@ -460,14 +1392,16 @@ func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInf
 
 			if isSubtechnique(t.ExternalID) {
 				parentID := getParentTechniqueID(t.ExternalID)
-				b.WriteString(fmt.Sprintf("INSERT EDGE IF NOT EXISTS has_subtechnique VALUES %s->%s@0:();\n",
+				b.WriteString(fmt.Sprintf("INSERT EDGE IF NOT EXISTS %s VALUES %s->%s@0:();\n",
+					g.SubtechniqueEdge,
 					quoteID(parentID),
 					quoteID(t.ExternalID)))
+				counts["has_subtechnique_edge"]++
 			}
 		}
 
 		b.WriteString("\n-- ============================================================\n")
-		b.WriteString("-- STEP 3: Insert part_of edges (technique/subtechnique to tactic)\n")
+		b.WriteString(fmt.Sprintf("-- STEP 3: Insert %s edges (technique/subtechnique to tactic)\n", g.PartOfEdge))
 		b.WriteString("-- ============================================================\n\n")
 
 		for _, t := range techniques {
@@ -477,9 +1411,14 @@ func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInf
 
 			for _, tacticPhase := range t.Tactics {
 				if tacticID, ok := tacticPhaseToID[tacticPhase]; ok {
-					b.WriteString(fmt.Sprintf("INSERT EDGE IF NOT EXISTS part_of VALUES %s->%s@0:();\n",
+					b.WriteString(fmt.Sprintf("INSERT EDGE IF NOT EXISTS %s VALUES %s->%s@0:();\n",
+						g.PartOfEdge,
 						quoteID(t.ExternalID),
 						quoteID(tacticID)))
+					counts["part_of_edge"]++
+				} else {
+					b.WriteString(fmt.Sprintf("-- WARNING: %s tactic phase %q has no tactic ID; %s edge skipped\n",
+						t.ExternalID, tacticPhase, g.PartOfEdge))
 				}
 			}
 		}
@@ -488,13 +1427,12 @@ func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInf
 	}
 
 	b.WriteString("-- ============================================================\n")
-	b.WriteString("-- STEP 4: Insert mitigates edges (mitigation to techniques)\n")
+	b.WriteString(fmt.Sprintf("-- STEP 4: Insert %s edges (mitigation to techniques)\n", g.MitigatesEdge))
 	b.WriteString("-- ============================================================\n\n")
 
 	for _, t := range techniques {
-		b.WriteString(fmt.Sprintf("INSERT EDGE IF NOT EXISTS mitigates VALUES %s->%s@0:(NULL, \"Enterprise\");\n",
-			quoteID(mitigationID),
-			quoteID(t.ExternalID)))
+		b.WriteString(edgeProps.insertEdge(g.MitigatesEdge, mitigationID, t) + "\n")
+		counts["mitigates_edge"]++
 	}
 
 	b.WriteString("\n-- ============================================================\n")
@@ -502,10 +1440,72 @@ func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInf
 	b.WriteString("-- ============================================================\n\n")
 
 	b.WriteString(fmt.Sprintf("-- Run this to verify the mitigation has correct edge count:\n"))
-	b.WriteString(fmt.Sprintf("-- MATCH (m:tMitreMitigation)-[e:mitigates]->(t) WHERE id(m) == \"%s\" RETURN COUNT(e);\n", mitigationID))
+	b.WriteString(fmt.Sprintf("-- %s\n", verifyCountQuery(g, mitigationID)))
 	b.WriteString(fmt.Sprintf("-- Expected count: %d\n\n", len(techniques)))
 
-	return b.String()
+	return b.String(), counts
+}
+
+// consoleScript reshapes a generated script for nebula-console -f: comment
+// lines are dropped unless comments is set, runs of blank lines collapse to
+// one, and the file ends on a statement rather than a comment-only line
+// (the console's loader trips over a trailing comment).
+func consoleScript(script string, comments bool) string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		isComment := strings.HasPrefix(strings.TrimSpace(line), "--")
+		if isComment && !comments {
+			continue
+		}
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 {
+		last := strings.TrimSpace(lines[len(lines)-1])
+		if last != "" && !strings.HasPrefix(last, "--") {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+/*
+-------------------------------------------------------------
+Interactive confirmation
+-------------------------------------------------------------
+*/
+
+// isTerminal reports whether f is attached to a character device (a TTY).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question on stderr. -yes answers it without reading
+// stdin; without -yes a non-interactive stdin is an error rather than a hang.
+func confirm(question string) (bool, error) {
+	if *flagYes {
+		fmt.Fprintf(os.Stderr, "%s (yes/no): yes (-yes)\n", question)
+		return true, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("stdin is not a terminal; pass -yes to confirm non-interactively")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s (yes/no): ", question)
+	var response string
+	fmt.Scanln(&response)
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "yes" || response == "y", nil
 }
 
 /*
@@ -513,7 +1513,7 @@ func generateNGQL(mitigationID, mitigationName string, techniques []techniqueInf
 Execute nGQL statements against database
 -------------------------------------------------------------
 */
-func executeNGQL(session *nebula.Session, mitigationID, mitigationName string, techniques []techniqueInfo, missingTechniques []string) error {
+func executeNGQL(session *nebula.Session, g graphNames, mitigationID, mitigationName string, techniques []techniqueInfo, missingTechniques []string, truncs []truncation) error {
 	// Create map of missing techniques for quick lookup
 	missingMap := make(map[string]bool)
 	for _, id := range missingTechniques {
@@ -537,60 +1537,67 @@ func executeNGQL(session *nebula.Session, mitigationID, mitigationName string, t
 	}
 	mitigatesEdges = len(techniques)
 
-	// Display planned nGQL statements
-	script := generateNGQL(mitigationID, mitigationName, techniques, missingTechniques)
-	fmt.Fprintf(os.Stderr, "%s", script)
+	// Display planned changes: either a compact diff or the full script
+	if *flagDiffConfirm {
+		mitigated, err := findMitigatedTechniques(session, g, mitigationID)
+		if err != nil {
+			return fmt.Errorf("failed to read existing mitigates edges: %w", err)
+		}
+		printPlanDiff(os.Stderr, g, mitigationID, mitigationName, techniques, missingMap, mitigated)
+	} else if logEnabled(levelInfo) {
+		script, _ := generateNGQL(g, mitigationID, mitigationName, techniques, missingTechniques)
+		fmt.Fprintf(os.Stderr, "%s", script)
+	}
 
 	// Display summary
-	fmt.Fprintf(os.Stderr, "=============================================================\n")
-	fmt.Fprintf(os.Stderr, "EXECUTION SUMMARY for %s (%s)\n", mitigationName, mitigationID)
-	fmt.Fprintf(os.Stderr, "=============================================================\n")
-	fmt.Fprintf(os.Stderr, "Missing techniques to insert:        %d\n", techInserts)
-	fmt.Fprintf(os.Stderr, "has_subtechnique edges to create:    %d\n", subtechEdges)
-	fmt.Fprintf(os.Stderr, "part_of edges to create:             %d\n", tacticEdges)
-	fmt.Fprintf(os.Stderr, "mitigates edges to create:           %d\n", mitigatesEdges)
-	fmt.Fprintf(os.Stderr, "=============================================================\n\n")
+	infof("=============================================================\n")
+	planf("EXECUTION SUMMARY for %s (%s)\n", mitigationName, mitigationID)
+	infof("=============================================================\n")
+	planf("Missing techniques to insert:        %d\n", techInserts)
+	planf("%-37s%d\n", g.SubtechniqueEdge+" edges to create:", subtechEdges)
+	planf("%-37s%d\n", g.PartOfEdge+" edges to create:", tacticEdges)
+	planf("%-37s%d\n", g.MitigatesEdge+" edges to create:", mitigatesEdges)
+	if logEnabled(levelInfo) {
+		printTechniqueStatus(os.Stderr, colorErr, techniques, missingMap)
+	}
+	infof("=============================================================\n\n")
+	printTruncations(os.Stderr, truncs)
 
 	// Ask for confirmation
-	fmt.Fprintf(os.Stderr, "Proceed with execution? (yes/no): ")
-	var response string
-	fmt.Scanln(&response)
-	response = strings.ToLower(strings.TrimSpace(response))
-
-	if response != "yes" && response != "y" {
-		fmt.Fprintf(os.Stderr, "Execution cancelled by user.\n")
-		return nil
+	ok, err := confirm("Proceed with execution?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCancelled
 	}
 
-	fmt.Fprintf(os.Stderr, "\nExecuting statements...\n")
+	infof("\nExecuting statements...\n")
+	execStart := time.Now()
 
 	// STEP 1: Insert missing techniques
 	if techInserts > 0 {
-		fmt.Fprintf(os.Stderr, "\nSTEP 1: Inserting %d missing techniques...\n", techInserts)
+		planf("\nSTEP 1: Inserting %d missing techniques...\n", techInserts)
 		for _, t := range techniques {
 			if !missingMap[t.ExternalID] {
 				continue
 			}
 
-			stmt := fmt.Sprintf("INSERT VERTEX IF NOT EXISTS tMitreTechnique(Technique_ID, Technique_Name, Mitre_Attack_Version, rcelpe, priority, execution_min, execution_max) VALUES %s:(%s, %s, \"18.0\", false, 4, 0.1667, 120);",
-				quoteID(t.ExternalID),
-				quoteLiteral(t.ExternalID),
-				quoteLiteral(t.Name))
+			stmt := techSchema.insertVertex(g.TechniqueTag, t)
 
-			if *flagDbg {
-				fmt.Fprintf(os.Stderr, ">>> Executing: %s\n", stmt)
-			}
+			debugf("Executing: %s\n", stmt)
 
 			if _, err := session.Execute(stmt); err != nil {
 				return fmt.Errorf("failed to insert technique %s: %w", t.ExternalID, err)
 			}
 		}
-		fmt.Fprintf(os.Stderr, "✓ Inserted %d techniques\n", techInserts)
+		planf("✓ Inserted %d techniques\n", techInserts)
+		metrics.count("technique_vertex", techInserts)
 	}
 
 	// STEP 2: Insert has_subtechnique edges
 	if subtechEdges > 0 {
-		fmt.Fprintf(os.Stderr, "\nSTEP 2: Creating %d has_subtechnique edges...\n", subtechEdges)
+		planf("\nSTEP 2: Creating %d %s edges...\n", subtechEdges, g.SubtechniqueEdge)
 		for _, t := range techniques {
 			if !missingMap[t.ExternalID] {
 				continue
@@ -598,25 +1605,25 @@ func executeNGQL(session *nebula.Session, mitigationID, mitigationName string, t
 
 			if isSubtechnique(t.ExternalID) {
 				parentID := getParentTechniqueID(t.ExternalID)
-				stmt := fmt.Sprintf("INSERT EDGE IF NOT EXISTS has_subtechnique VALUES %s->%s@0:();",
+				stmt := fmt.Sprintf("INSERT EDGE IF NOT EXISTS %s VALUES %s->%s@0:();",
+					g.SubtechniqueEdge,
 					quoteID(parentID),
 					quoteID(t.ExternalID))
 
-				if *flagDbg {
-					fmt.Fprintf(os.Stderr, ">>> Executing: %s\n", stmt)
-				}
+				debugf("Executing: %s\n", stmt)
 
 				if _, err := session.Execute(stmt); err != nil {
-					return fmt.Errorf("failed to insert has_subtechnique edge %s->%s: %w", parentID, t.ExternalID, err)
+					return fmt.Errorf("failed to insert %s edge %s->%s: %w", g.SubtechniqueEdge, parentID, t.ExternalID, err)
 				}
 			}
 		}
-		fmt.Fprintf(os.Stderr, "✓ Created %d has_subtechnique edges\n", subtechEdges)
+		planf("✓ Created %d %s edges\n", subtechEdges, g.SubtechniqueEdge)
+		metrics.count("has_subtechnique_edge", subtechEdges)
 	}
 
 	// STEP 3: Insert part_of edges
 	if tacticEdges > 0 {
-		fmt.Fprintf(os.Stderr, "\nSTEP 3: Creating %d part_of edges...\n", tacticEdges)
+		planf("\nSTEP 3: Creating %d %s edges...\n", tacticEdges, g.PartOfEdge)
 		for _, t := range techniques {
 			if !missingMap[t.ExternalID] {
 				continue
@@ -624,47 +1631,44 @@ func executeNGQL(session *nebula.Session, mitigationID, mitigationName string, t
 
 			for _, tacticPhase := range t.Tactics {
 				if tacticID, ok := tacticPhaseToID[tacticPhase]; ok {
-					stmt := fmt.Sprintf("INSERT EDGE IF NOT EXISTS part_of VALUES %s->%s@0:();",
+					stmt := fmt.Sprintf("INSERT EDGE IF NOT EXISTS %s VALUES %s->%s@0:();",
+						g.PartOfEdge,
 						quoteID(t.ExternalID),
 						quoteID(tacticID))
 
-					if *flagDbg {
-						fmt.Fprintf(os.Stderr, ">>> Executing: %s\n", stmt)
-					}
+					debugf("Executing: %s\n", stmt)
 
 					if _, err := session.Execute(stmt); err != nil {
-						return fmt.Errorf("failed to insert part_of edge %s->%s: %w", t.ExternalID, tacticID, err)
+						return fmt.Errorf("failed to insert %s edge %s->%s: %w", g.PartOfEdge, t.ExternalID, tacticID, err)
 					}
 				}
 			}
 		}
-		fmt.Fprintf(os.Stderr, "✓ Created %d part_of edges\n", tacticEdges)
+		planf("✓ Created %d %s edges\n", tacticEdges, g.PartOfEdge)
+		metrics.count("part_of_edge", tacticEdges)
 	}
 
 	// STEP 4: Insert mitigates edges
-	fmt.Fprintf(os.Stderr, "\nSTEP 4: Creating %d mitigates edges...\n", mitigatesEdges)
+	planf("\nSTEP 4: Creating %d %s edges...\n", mitigatesEdges, g.MitigatesEdge)
 	for _, t := range techniques {
-		stmt := fmt.Sprintf("INSERT EDGE IF NOT EXISTS mitigates VALUES %s->%s@0:(NULL, \"Enterprise\");",
-			quoteID(mitigationID),
-			quoteID(t.ExternalID))
+		stmt := edgeProps.insertEdge(g.MitigatesEdge, mitigationID, t)
 
-		if *flagDbg {
-			fmt.Fprintf(os.Stderr, ">>> Executing: %s\n", stmt)
-		}
+		debugf("Executing: %s\n", stmt)
 
 		if _, err := session.Execute(stmt); err != nil {
-			return fmt.Errorf("failed to insert mitigates edge %s->%s: %w", mitigationID, t.ExternalID, err)
+			return fmt.Errorf("failed to insert %s edge %s->%s: %w", g.MitigatesEdge, mitigationID, t.ExternalID, err)
 		}
 	}
-	fmt.Fprintf(os.Stderr, "✓ Created %d mitigates edges\n", mitigatesEdges)
+	planf("✓ Created %d %s edges\n", mitigatesEdges, g.MitigatesEdge)
+	metrics.count("mitigates_edge", mitigatesEdges)
+	metrics.phase("execute", execStart)
 
 	// STEP 5: Verification
-	fmt.Fprintf(os.Stderr, "\nSTEP 5: Verification...\n")
-	verifyQuery := fmt.Sprintf(`MATCH (m:tMitreMitigation)-[e:mitigates]->(t) WHERE id(m) == "%s" RETURN COUNT(e);`, mitigationID)
+	verifyStart := time.Now()
+	planf("\nSTEP 5: Verification...\n")
+	verifyQuery := verifyCountQuery(g, mitigationID)
 
-	if *flagDbg {
-		fmt.Fprintf(os.Stderr, ">>> Executing: %s\n", verifyQuery)
-	}
+	debugf("Executing: %s\n", verifyQuery)
 
 	result, err := session.Execute(verifyQuery)
 	if err != nil {
@@ -688,365 +1692,2524 @@ func executeNGQL(session *nebula.Session, mitigationID, mitigationName string, t
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "\n=============================================================\n")
-	fmt.Fprintf(os.Stderr, "VERIFICATION RESULTS\n")
-	fmt.Fprintf(os.Stderr, "=============================================================\n")
-	fmt.Fprintf(os.Stderr, "Expected mitigates edges: %d\n", len(techniques))
-	fmt.Fprintf(os.Stderr, "Actual mitigates edges:   %d\n", actualCount)
+	// Re-read what this run was meant to create: vertices, the edges of
+	// inserted techniques, and the mitigates count
+	allIDs := make([]string, len(techniques))
+	var expectSub, expectPartOf []string
+	for i, t := range techniques {
+		allIDs[i] = t.ExternalID
+		if !missingMap[t.ExternalID] {
+			continue
+		}
+		if isSubtechnique(t.ExternalID) {
+			expectSub = append(expectSub, getParentTechniqueID(t.ExternalID)+"->"+t.ExternalID)
+		}
+		for _, tacticPhase := range t.Tactics {
+			if tacticID, ok := tacticPhaseToID[tacticPhase]; ok {
+				expectPartOf = append(expectPartOf, t.ExternalID+"->"+tacticID)
+			}
+		}
+	}
 
-	if int(actualCount) == len(techniques) {
-		fmt.Fprintf(os.Stderr, "Status:                   ✓ SUCCESS\n")
-	} else {
-		fmt.Fprintf(os.Stderr, "Status:                   ✗ MISMATCH\n")
+	stillMissing, err := findMissingTechniques(session, g, allIDs)
+	if err != nil {
+		return fmt.Errorf("verification query failed: %w", err)
+	}
+	subPairs, err := existingEdgePairs(session, g.SubtechniqueEdge, allIDs, true)
+	if err != nil {
+		return fmt.Errorf("verification query failed: %w", err)
+	}
+	partOfPairs, err := existingEdgePairs(session, g.PartOfEdge, allIDs, false)
+	if err != nil {
+		return fmt.Errorf("verification query failed: %w", err)
+	}
+
+	mitigated, err := findMitigatedTechniques(session, g, mitigationID)
+	if err != nil {
+		return fmt.Errorf("verification query failed: %w", err)
+	}
+	_, notMitigated, _ := diffMitigates(techniques, mitigated)
+
+	checks := []verifyResult{
+		{Name: g.TechniqueTag + " vertices", Expected: len(allIDs), Missing: stillMissing},
+		{Name: g.SubtechniqueEdge + " edges", Expected: len(expectSub), Missing: absentPairs(expectSub, subPairs)},
+		{Name: g.PartOfEdge + " edges", Expected: len(expectPartOf), Missing: absentPairs(expectPartOf, partOfPairs)},
+		{Name: g.MitigatesEdge + " edges", Expected: len(techniques), Missing: notMitigated},
+	}
+	if int(actualCount) != len(techniques) {
+		// Extra edges (stale, not pruned) don't fail the run
+		infof("note: %d %s edges in total for %s, %d expected from ATT&CK\n", actualCount, g.MitigatesEdge, mitigationID, len(techniques))
+	}
+
+	infof("\n=============================================================\n")
+	infof("VERIFICATION RESULTS\n")
+	infof("=============================================================\n")
+	var failed []string
+	for _, c := range checks {
+		if c.ok() {
+			infof("[PASS] %-28s %s\n", c.Name, c.detail())
+			continue
+		}
+		failed = append(failed, c.Name)
+		errorf("[FAIL] %-28s %s\n", c.Name, c.detail())
 	}
-	fmt.Fprintf(os.Stderr, "=============================================================\n")
+	infof("=============================================================\n")
+	metrics.phase("verify", verifyStart)
 
+	if len(failed) > 0 {
+		return fmt.Errorf("verification failed: %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
-/*
--------------------------------------------------------------
-Main function
--------------------------------------------------------------
-*/
+// verifyResult is one category of the post-execute verification: how many
+// objects were expected and which of them weren't found.
+type verifyResult struct {
+	Name     string
+	Expected int
+	Missing  []string
+}
 
-func main() {
-	/* ---------------------------------------------------------
-	   Define command-line flags
-	   --------------------------------------------------------- */
-	mitID := flag.String("mitigation", "", "Mitigation external ID (e.g. M1037).")
-	mitName := flag.String("mitigation-name", "", "Full mitigation name (case-insensitive).")
-	flagJSON := flag.Bool("json", false, "Emit JSON array.")
-	flagCSV := flag.Bool("csv", false, "Emit CSV.")
-	flagNGQL := flag.Bool("ngql", false, "Emit Nebula Graph INSERT statements.")
-	flagExecute := flag.Bool("execute", false, "Execute INSERT statements against database (interactive).")
-	flagNoDB := flag.Bool("no-db", false, "Skip database connection (show techniques only).")
-	flagHelp := flag.Bool("h", false, "Show help.")
-	// flagDbg is already declared globally
+func (v verifyResult) ok() bool { return len(v.Missing) == 0 }
 
-	/* ---------------------------------------------------------
-	   IMPORTANT: parse flags *before* any work that uses them
-	   --------------------------------------------------------- */
-	flag.Parse()
+func (v verifyResult) detail() string {
+	d := fmt.Sprintf("%d/%d", v.Expected-len(v.Missing), v.Expected)
+	if len(v.Missing) > 0 {
+		d += "  missing: " + strings.Join(v.Missing, " ")
+	}
+	return d
+}
 
-	if *flagHelp || (*mitID == "" && *mitName == "") {
-		fmt.Fprintf(os.Stderr,
-			`Usage: %s -mitigation Mxxxx [options]
+// absentPairs returns the expected "src->dst" pairs that aren't in found.
+func absentPairs(expected []string, found map[string]bool) []string {
+	var absent []string
+	for _, p := range expected {
+		if !found[p] {
+			absent = append(absent, p)
+		}
+	}
+	return absent
+}
 
-Options:
-  -mitigation       ATT&CK mitigation external ID (Mxxxx)
-  -mitigation-name  Full mitigation name (case-insensitive)
-  -json             Output JSON
-  -csv              Output CSV
-  -ngql             Output Nebula Graph INSERT statements (with DB check)
-  -execute          Execute INSERT statements against database (interactive)
-  -no-db            Skip database connection (show techniques only)
-  -debug            Extra diagnostic output
-  -h                Show this help
+// existingEdgePairs returns "src->dst" for every edge of the given type whose
+// source (or destination, with byDst) is one of ids.
+func existingEdgePairs(session *nebula.Session, edge string, ids []string, byDst bool) (map[string]bool, error) {
+	pairs := make(map[string]bool)
+	if len(ids) == 0 {
+		return pairs, nil
+	}
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = quoteID(id)
+	}
+	end := "a"
+	if byDst {
+		end = "b"
+	}
+	query := fmt.Sprintf(`MATCH (a)-[e:%s]->(b) WHERE id(%s) IN [%s] RETURN collect(id(a) + "->" + id(b)) AS pairs;`,
+		edge, end, strings.Join(quoted, ", "))
 
-Environment Variables (for -ngql and -execute modes):
-  NEBULA_HOST       Database hostname/IP (default: 127.0.0.1)
-  NEBULA_PORT       Database port (default: 9669)
-  NEBULA_USER       Username (default: root)
-  NEBULA_PASS       Password (default: nebula)
-  NEBULA_SPACE      Space name (default: ESP01)
+	debugf("Query: %s\n", query)
+
+	result, err := session.Execute(query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	if !result.IsSucceed() {
+		return nil, fmt.Errorf("%s: %s", edge, result.GetErrorMsg())
+	}
+	list, err := collectedStrings(result)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		pairs[p] = true
+	}
+	return pairs, nil
+}
 
-`, os.Args[0])
-		os.Exit(1)
+// diffMitigates compares the techniques ATT&CK lists for a mitigation with
+// the targets of its existing mitigates edges.
+func diffMitigates(techniques []techniqueInfo, mitigated []string) (present, toAdd, stale []string) {
+	inDB := make(map[string]bool)
+	for _, id := range mitigated {
+		inDB[id] = true
+	}
+	wanted := make(map[string]bool)
+	for _, t := range techniques {
+		wanted[t.ExternalID] = true
+		if inDB[t.ExternalID] {
+			present = append(present, t.ExternalID)
+		} else {
+			toAdd = append(toAdd, t.ExternalID)
+		}
+	}
+	for _, id := range mitigated {
+		if !wanted[id] {
+			stale = append(stale, id)
+		}
 	}
+	sort.Strings(stale)
+	return present, toAdd, stale
+}
 
-	/* ---------------------------------------------------------
-	   Load the ATT&CK bundle
-	   --------------------------------------------------------- */
-	raw, err := fetchBundle()
+// pruneStatements returns the DELETE EDGE statement for each stale technique.
+func pruneStatements(g graphNames, mitigationID string, stale []string) []string {
+	stmts := make([]string, len(stale))
+	for i, id := range stale {
+		stmts[i] = fmt.Sprintf("DELETE EDGE %s %s->%s@0;", g.MitigatesEdge, quoteID(mitigationID), quoteID(id))
+	}
+	return stmts
+}
+
+// pruneMitigates deletes the mitigates edges from the mitigation to the stale
+// technique IDs after confirmation. Declining skips the prune but not the run.
+func pruneMitigates(session *nebula.Session, g graphNames, mitigationID string, stale []string) error {
+	fmt.Fprintf(os.Stderr, "Stale %s edges to delete (%d):\n", g.MitigatesEdge, len(stale))
+	for _, id := range stale {
+		fmt.Fprintf(os.Stderr, "  %s -> %s\n", mitigationID, id)
+	}
+	ok, err := confirm(fmt.Sprintf("Delete %d stale edge(s)?", len(stale)))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error fetching ATT&CK bundle: %v\n", err)
-		os.Exit(1)
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Pruning skipped.")
+		return nil
 	}
 
-	var bundle Bundle
-	if err = json.Unmarshal(raw, &bundle); err != nil {
-		fmt.Fprintf(os.Stderr, "error parsing bundle JSON: %v\n", err)
-		os.Exit(1)
+	for i, stmt := range pruneStatements(g, mitigationID, stale) {
+		id := stale[i]
+		debugf("Executing: %s\n", stmt)
+		result, err := session.Execute(stmt)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s edge %s->%s: %w", g.MitigatesEdge, mitigationID, id, err)
+		}
+		if !result.IsSucceed() {
+			return fmt.Errorf("failed to delete %s edge %s->%s: %s", g.MitigatesEdge, mitigationID, id, result.GetErrorMsg())
+		}
 	}
+	infof("✓ Pruned %d %s edges\n", len(stale), g.MitigatesEdge)
+	metrics.count("pruned_edge", len(stale))
+	return nil
+}
 
-	/* ---------------------------------------------------------
-	   Build lookup maps (mitigations, techniques, relationships)
-	   --------------------------------------------------------- */
-	mitMap := make(map[string]courseOfAction) // key = STIX ID
-	techMap := make(map[string]attackPattern) // key = STIX ID
-	var rels []relationship
+// errCancelled is returned by executeNGQL when the user declines the prompt.
+var errCancelled = errors.New("execution cancelled by user")
 
-	for _, rawObj := range bundle.Objects {
-		var bo baseObject
-		if err = json.Unmarshal(rawObj, &bo); err != nil {
-			continue // ignore malformed entries
+// printTechniqueStatus lists which techniques are already in the database
+// (green) and which are missing (red).
+func printTechniqueStatus(out io.Writer, pal palette, techniques []techniqueInfo, missingMap map[string]bool) {
+	var present, missing []string
+	for _, t := range techniques {
+		if missingMap[t.ExternalID] {
+			missing = append(missing, pal.red(t.ExternalID))
+		} else {
+			present = append(present, pal.green(t.ExternalID))
 		}
+	}
+	fmt.Fprintf(out, "Already in database (%d): %s\n", len(present), strings.Join(present, " "))
+	fmt.Fprintf(out, "Missing from database (%d): %s\n", len(missing), strings.Join(missing, " "))
+}
 
-		switch bo.Type {
-		case "course-of-action":
-			var co courseOfAction
-			if err = json.Unmarshal(rawObj, &co); err == nil {
-				mitMap[co.ID] = co
-			}
-		case "attack-pattern":
-			var ap attackPattern
-			if err = json.Unmarshal(rawObj, &ap); err == nil {
-				techMap[ap.ID] = ap
+// printPlanDiff lists only what -execute will add, compared against what is
+// already in the database.
+func printPlanDiff(out io.Writer, g graphNames, mitigationID, mitigationName string, techniques []techniqueInfo, missingMap map[string]bool, mitigated []string) {
+	present := make(map[string]bool)
+	for _, id := range mitigated {
+		present[id] = true
+	}
+
+	var addTech, addSub, addPartOf, addMitigates []string
+	for _, t := range techniques {
+		if missingMap[t.ExternalID] {
+			addTech = append(addTech, fmt.Sprintf("%s  %s", t.ExternalID, t.Name))
+			if isSubtechnique(t.ExternalID) {
+				addSub = append(addSub, fmt.Sprintf("%s -> %s", getParentTechniqueID(t.ExternalID), t.ExternalID))
 			}
-		case "relationship":
-			var r relationship
-			if err = json.Unmarshal(rawObj, &r); err == nil {
-				rels = append(rels, r)
+			for _, tacticPhase := range t.Tactics {
+				if tacticID, ok := tacticPhaseToID[tacticPhase]; ok {
+					addPartOf = append(addPartOf, fmt.Sprintf("%s -> %s", t.ExternalID, tacticID))
+				}
 			}
 		}
+		if !present[t.ExternalID] {
+			addMitigates = append(addMitigates, fmt.Sprintf("%s -> %s", mitigationID, t.ExternalID))
+		}
 	}
 
-	/* ---------------------------------------------------------
-	   Find the mitigation requested by the user
-	   --------------------------------------------------------- */
-	var chosenMitSTIXID string // STIX ID we will match on source_ref
+	fmt.Fprintf(out, "=============================================================\n")
+	fmt.Fprintf(out, "PLANNED CHANGES for %s (%s)\n", mitigationName, mitigationID)
+	fmt.Fprintf(out, "=============================================================\n")
 
-	if *mitID != "" {
-		// lookup by external ID (Mxxxx)
-		for id, co := range mitMap {
-			if ext, ok := externalID(co.ExternalRefs); ok && strings.EqualFold(ext, *mitID) {
-				chosenMitSTIXID = id
-				break
-			}
+	section := func(title string, lines []string) {
+		fmt.Fprintf(out, "%s (%d):\n", title, len(lines))
+		for _, l := range lines {
+			fmt.Fprintf(out, "  + %s\n", l)
 		}
-		if chosenMitSTIXID == "" {
-			fmt.Fprintf(os.Stderr, "mitigation %s not found in ATT&CK data\n", *mitID)
-			os.Exit(1)
+	}
+	section("Techniques to add", addTech)
+	section(g.SubtechniqueEdge+" edges to add", addSub)
+	section(g.PartOfEdge+" edges to add", addPartOf)
+	section(g.MitigatesEdge+" edges to add", addMitigates)
+	fmt.Fprintf(out, "%s edges already present: %d\n\n", g.MitigatesEdge, len(techniques)-len(addMitigates))
+}
+
+// collectTechniques returns the techniques the mitigation with STIX ID
+// mitSTIXID mitigates according to the mitigates relationships (see
+// resolveMitigates), the relationships whose target isn't a technique in the
+// bundle, and how many techniques -only-domain dropped. Revoked techniques
+// are followed to their replacement; notef reports those.
+func collectTechniques(data *attackData, mitigates []relationship, mitSTIXID, onlyDomain string, detectedBy map[string][]string, notef func(string, ...any)) (results []techniqueInfo, orphans []relationship, outsideDomain int) {
+	seenTechniques := make(map[string]bool) // deduplicate techniques
+	for _, r := range mitigates {
+		if r.RelationshipType != "mitigates" {
+			continue
 		}
-	} else {
-		// lookup by name (case-insensitive)
-		target := strings.TrimSpace(*mitName)
-		for id, co := range mitMap {
-			if strings.EqualFold(co.Name, target) {
-				chosenMitSTIXID = id
-				break
-			}
+		if r.SourceRef != mitSTIXID {
+			continue
 		}
-		if chosenMitSTIXID == "" {
-			fmt.Fprintf(os.Stderr, "mitigation name %q not found (check spelling)\n", target)
-			os.Exit(1)
+		tp, ok := data.Techniques[r.TargetRef]
+		if !ok {
+			orphans = append(orphans, r)
+			continue
 		}
-	}
 
-	/* ---------------------------------------------------------
-	   Collect all techniques that this mitigation mitigates
-	   --------------------------------------------------------- */
-	var results []techniqueInfo
-	seenTechniques := make(map[string]bool) // deduplicate techniques
+		ext, _ := externalID(tp.ExternalRefs)
+		if ext == "" {
+			ext = strings.TrimPrefix(tp.ID, "attack-pattern--")
+		}
 
-	for _, r := range rels {
-		if r.RelationshipType != "mitigates" {
+		// Revoked techniques are reported under their replacement so no
+		// dead vertex reaches the graph; without one they are skipped
+		revokedFrom := ""
+		if tp.Revoked {
+			repl, ok := resolveRevoked(tp.ID, data.RevokedBy)
+			replTP, found := data.Techniques[repl]
+			replExt, hasExt := externalID(replTP.ExternalRefs)
+			if !ok || !found || replTP.Revoked || !hasExt {
+				notef("skipping technique %s: %s\n", ext, revokedNote(tp.ID, data.RevokedBy, data.Mitigations, data.Techniques))
+				continue
+			}
+			notef("technique %s → %s (revoked)\n", ext, replExt)
+			revokedFrom, tp, ext = ext, replTP, replExt
+		}
+
+		// -only-domain goes by the technique's own x_mitre_domains, not by
+		// the bundle it was loaded from
+		if onlyDomain != "" && !inDomain(tp.Domains, onlyDomain) {
+			debugf("Skipping %s: x_mitre_domains %v lacks %s\n", ext, tp.Domains, onlyDomain)
+			outsideDomain++
 			continue
 		}
-		if r.SourceRef != chosenMitSTIXID {
+
+		// Skip if we've already seen this technique
+		if seenTechniques[ext] {
+			debugf("Skipping duplicate technique: %s\n", ext)
 			continue
 		}
+		seenTechniques[ext] = true
 
-		if tp, ok := techMap[r.TargetRef]; ok {
-			ext, _ := externalID(tp.ExternalRefs)
-			if ext == "" {
-				ext = strings.TrimPrefix(tp.ID, "attack-pattern--")
+		// Extract tactics from kill chain phases
+		var tactics []string
+		for _, kc := range tp.KillChain {
+			if isAttackKillChain(kc.KillChainName) {
+				tactics = append(tactics, kc.PhaseName)
 			}
+		}
+
+		parentID, parentName := "", ""
+		if isSubtechnique(ext) {
+			parentID = getParentTechniqueID(ext)
+			parent, _ := data.techniqueByExternalID(parentID)
+			parentName = parent.Name // "" if the bundle lacks it
+		}
+
+		results = append(results, techniqueInfo{
+			ExternalID: ext,
+			Name:       tp.Name,
+			Tactics:    tactics,
+			Platforms:  normalizeLabels(tp.Platforms),
+			URL:        techniqueURL(ext, tp.ExternalRefs),
+			Domain:     r.Domain,
+			ParentID:   parentID,
+			ParentName: parentName,
+
+			RevokedFrom: revokedFrom,
+
+			Description: tp.Description,
+			Detection:   tp.Detection,
+			DataSources: normalizeLabels(append(append([]string(nil), tp.DataSources...), detectedBy[tp.ID]...)),
+			Version:     tp.Version,
+			Domains:     tp.Domains,
+		})
+	}
+	return results, orphans, outsideDomain
+}
 
-			// Skip if we've already seen this technique
-			if seenTechniques[ext] {
-				if *flagDbg {
-					fmt.Fprintf(os.Stderr, ">>> Skipping duplicate technique: %s\n", ext)
+// loadAttackData fetches the bundle of every -domain (see fetchBundle) and
+// merges them into one attackData. keepRaw keeps the verbatim objects for
+// -stix; useIndex reads and writes the parsed index (mitre-index.go).
+func loadAttackData(keepRaw, useIndex, showProgress bool) (*attackData, error) {
+	data := newAttackData(keepRaw)
+	for _, dom := range loadedDomains {
+		raw, err := fetchBundle(dom)
+		if err != nil {
+			return nil, fmt.Errorf("fetching ATT&CK %s bundle: %w", dom.Label, err)
+		}
+
+		var sum string
+		if useIndex {
+			sum = bundleSum(raw)
+			if parsed := readIndex(dom, sum); parsed != nil {
+				indexHits.Add(1)
+				if err := checkPinnedRelease(dom, parsed.Release); err != nil {
+					return nil, err
 				}
+				data.merge(parsed, dom.Label)
 				continue
 			}
-			seenTechniques[ext] = true
+			indexMisses.Add(1)
+		}
 
-			// Extract tactics from kill chain phases
-			var tactics []string
-			for _, kc := range tp.KillChain {
-				if kc.KillChainName == "mitre-attack" {
-					tactics = append(tactics, kc.PhaseName)
+		var progress func(int, int64)
+		if showProgress {
+			lastPct := int64(-1)
+			progress = func(n int, offset int64) {
+				if pct := offset * 100 / int64(len(raw)); pct != lastPct {
+					lastPct = pct
+					fmt.Fprintf(os.Stderr, "\rparsing %s bundle: %3d%% (%d objects)", dom.Name, pct, n)
 				}
 			}
+		}
 
-			results = append(results, techniqueInfo{
-				ExternalID: ext,
-				Name:       tp.Name,
-				Tactics:    tactics,
-			})
+		parsed, err := parseBundle(bytes.NewReader(raw), keepRaw, progress)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s bundle JSON: %w", dom.Label, err)
+		}
+		if showProgress {
+			fmt.Fprintf(os.Stderr, "\rparsing %s bundle: 100%% (%d objects)\n", dom.Name, parsed.Objects)
+		}
+		debugf("%s bundle is STIX %s\n", dom.Name, parsed.stixVersion())
+		if err := checkPinnedRelease(dom, parsed.Release); err != nil {
+			return nil, err
 		}
+		if useIndex {
+			if err := writeIndex(dom, sum, parsed); err != nil {
+				debugf("storing the parsed index failed: %v\n", err)
+			}
+		}
+		data.merge(parsed, dom.Label)
 	}
+	data.index()
+	return data, nil
+}
 
-	// deterministic ordering – nice for CSV/JSON diffing
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].ExternalID < results[j].ExternalID
-	})
+// useBundleTables points the release and tactic globals at data, preferring
+// the bundle's own tactic list over the static table.
+func useBundleTables(data *attackData) {
+	bundleRelease = data.release()
+	bundleRelease.Pinned = attackVersion != ""
+	techSchema.AttackVersion = bundleRelease.Version // "" keeps the schema default
+	if derived := tacticMapFromBundle(data.Tactics); len(derived) > 0 {
+		tacticPhaseToID = derived
+		tacticPhaseToName = tacticNamesFromBundle(data.Tactics)
+		debugf("%d tactics derived from bundle\n", len(derived))
+	} else {
+		tacticPhaseToID, tacticPhaseToName = staticTacticPhaseToID, map[string]string{}
+		warnf("no x-mitre-tactic objects in the bundle; using the built-in Enterprise tactic table\n")
+	}
+}
+
+/*
+-------------------------------------------------------------
+Main function
+-------------------------------------------------------------
+*/
 
+func main() {
 	/* ---------------------------------------------------------
-	   Emit the requested output format
+	   Define command-line flags
 	   --------------------------------------------------------- */
+	mitID := flag.String("mitigation", "", "Mitigation external ID (e.g. M1037).")
+	mitName := flag.String("mitigation-name", "", "Full mitigation name (case-insensitive).")
+	flagExact := flag.Bool("exact", false, "Require an exact -mitigation-name match (no partial matching).")
+	flagStixID := flag.String("stix-id", "", "Mitigation STIX ID (course-of-action--<uuid>), instead of -mitigation.")
+	flagOnlyDomain := flag.String("only-domain", "", "Keep only techniques whose x_mitre_domains include this domain (e.g. enterprise-attack).")
+	flagDomain := flag.String("domain", "enterprise", "ATT&CK domain(s) to load, comma-separated: enterprise, ics, mobile.")
+	flagFormat := flag.String("format", "", "Output format: table (default), json, jsonl, csv, tsv, md, html, ngql, sql, cypher or gremlin.")
+	flagJSON := flag.Bool("json", false, "Deprecated: -format json.")
+	flagCSV := flag.Bool("csv", false, "Deprecated: -format csv.")
+	flagJSONL := flag.Bool("jsonl", false, "Deprecated: -format jsonl.")
+	flagCSVDelim := flag.String("csv-delimiter", ",", "CSV field delimiter (single character).")
+	flagCSVBOM := flag.Bool("csv-bom", false, "Start CSV output with a UTF-8 byte order mark (for Excel).")
+	flagCSVCRLF := flag.Bool("csv-crlf", false, "End CSV lines with CRLF.")
+	flagTSV := flag.Bool("tsv", false, "Deprecated: -format tsv.")
+	flagFull := flag.Bool("full", false, "Include description, detection and data sources in JSON/CSV.")
+	flagDescribe := flag.Bool("describe-techniques", false, "Include technique descriptions (table: first sentence only).")
+	flagNoHeader := flag.Bool("no-header", false, "Omit the mitigation block (name, URL, description) above the table.")
+	flagDetections := flag.Bool("detections", false, "Add data sources (table, CSV) and detection notes (CSV) per technique.")
+	flagMD := flag.Bool("md", false, "Deprecated: -format md.")
+	flagHTML := flag.Bool("html", false, "Same as -format html: a self-contained HTML report.")
+	flagDOT := flag.String("dot", "", "Write a Graphviz DOT graph of the mitigation to this path.")
+	flagGraphML := flag.String("graphml", "", "Write a GraphML graph of the mitigation to this path.")
+	flagXLSX := flag.String("xlsx", "", "Write an Excel workbook to this path.")
+	flagOutput := flag.String("output", "", "Write the selected output format to this file instead of stdout.")
+	flag.StringVar(flagOutput, "o", "", "Shorthand for -output.")
+	flagForce := flag.Bool("force", false, "Allow -output to overwrite an existing file.")
+	flagSTIX := flag.String("stix", "", "Write the mitigation and its techniques as a STIX bundle to this path.")
+	flagIncludeRevoked := flag.Bool("include-revoked", false, "Keep revoked/deprecated objects in -stix and -list-mitigations output.")
+	flagColor := flag.String("color", "auto", "Colour terminal output: auto, always or never (NO_COLOR is honoured).")
+	flagWidth := flag.Int("width", 0, "Fit the table into N columns (default: terminal width).")
+	flagWide := flag.Bool("wide", false, "Never truncate table columns.")
+	flagSort := flag.String("sort", "id", "Result order: id, name or tactic (prefix - for descending).")
+	flagGroupBy := flag.String("group-by", "", "Group the table or -json output: tactic.")
+	flagCount := flag.Bool("count", false, "Print technique counts only (per-tactic histogram).")
+	flagPlatformsSummary := flag.Bool("platforms-summary", false, "Print how many techniques apply to each platform.")
+	flagGaps := flag.Bool("gaps", false, "List the techniques of the mitigation's tactics that it does not cover.")
+	flagWarnOrphans := flag.Bool("warn-orphans", false, "List every mitigates relationship whose target is not in the bundle.")
+	flagExclude := flag.String("exclude", "", "Technique IDs to drop from the results (comma list or @file).")
+	flagIncludeOnly := flag.String("include-only", "", "Keep only these technique IDs (comma list or @file).")
+	flagTemplate := flag.String("template", "", "Render the results with this Go text/template file.")
+	flagTemplateInline := flag.String("template-inline", "", "Render the results with this Go text/template text.")
+	flagNGQL := flag.Bool("ngql", false, "Deprecated: -format ngql.")
+	flagGremlin := flag.Bool("gremlin", false, "Deprecated: -format gremlin.")
+	flagGremlinPrefix := flag.String("gremlin-graph-label-prefix", "", "Prefix for every -gremlin vertex and edge label.")
+	flagCypher := flag.Bool("cypher", false, "Deprecated: -format cypher.")
+	flagSQL := flag.Bool("sql", false, "Deprecated: -format sql.")
+	flagSQLDialect := flag.String("sql-dialect", "postgres", "SQL dialect for -sql: postgres, sqlite or mysql.")
+	flagTechTag := flag.String("technique-tag", defaultGraphNames.TechniqueTag, "Tag name of technique vertices.")
+	flagMitTag := flag.String("mitigation-tag", defaultGraphNames.MitigationTag, "Tag name of mitigation vertices.")
+	flagMitigatesEdge := flag.String("mitigates-edge", defaultGraphNames.MitigatesEdge, "Edge type from mitigation to technique.")
+	flagSubtechEdge := flag.String("subtechnique-edge", defaultGraphNames.SubtechniqueEdge, "Edge type from technique to sub-technique.")
+	flagPartOfEdge := flag.String("part-of-edge", defaultGraphNames.PartOfEdge, "Edge type from technique to tactic.")
+	flagPrune := flag.Bool("prune", false, "With -execute, delete mitigates edges to techniques ATT&CK no longer lists.")
+	flagDryRun := flag.Bool("dry-run", false, "With -execute, run the database checks and print the -prune DELETE statements without executing anything.")
+	flagAutoCreate := flag.Bool("auto-create-mitigation", false, "With -execute, create the mitigation vertex if it is missing.")
+	flagMitigatesProps := flag.String("mitigates-props", "NULL,"+domainPlaceholder, "Property values of each mitigates edge: nGQL literals in schema order, or name=value; {domain} is the technique's domain.")
+	flagTechSchema := flag.String("technique-schema", "", "JSON file with the tMitreTechnique columns and default values for -ngql/-execute.")
+	flagNGQLFile := flag.String("ngql-file", "", "Write the nGQL script to this file for nebula-console -f (implies -ngql).")
+	flagNoComments := flag.Bool("no-comments", false, "Leave comment lines out of the nGQL script.")
+	flagImporterDir := flag.String("importer-dir", "", "Write nebula-importer CSV files and importer.yaml to this directory (implies -ngql).")
+	flagExecute := flag.Bool("execute", false, "Execute INSERT statements against database (interactive).")
+	flagNoDB := flag.Bool("no-db", false, "Skip database connection (show techniques only).")
+	flagNoTruncate := flag.Bool("no-truncate", false, "Fail instead of truncating values longer than their FIXED_STRING column.")
+	flagMetricsOut := flag.String("metrics-out", "", "Append a JSON line of run timings to this local file.")
+	flagMetricsHost := flag.Bool("metrics-include-host", false, "Include the Nebula host in -metrics-out records.")
+	flagHistoryStats := flag.String("history-stats", "", "Summarize a -metrics-out file (averages and p95 per mode).")
+	flagProgress := flag.Bool("progress", false, "Show bundle parsing progress on stderr (automatic on a terminal).")
+	flagSearch := flag.String("search", "", "Find techniques and mitigations whose name contains QUERY, then exit.")
+	flagSearchDesc := flag.Bool("search-descriptions", false, "Make -search also match descriptions.")
+	flagListMit := flag.Bool("list-mitigations", false, "List every mitigation (ID and name) and exit.")
+	flagDoctor := flag.Bool("doctor", false, "Run pre-flight checks (cache, bundle, config, Nebula) and exit.")
+	flagServe := flag.String("serve", "", "Serve a JSON API on this address (e.g. :8080) instead of printing.")
+	flagHelp := flag.Bool("h", false, "Show help.")
+	flagVersion := flag.Bool("version", false, "Print version, commit and build date, then exit.")
+	flag.BoolVar(flagCompressCache, "compress-cache", true, "Deprecated: -cache-compress (now the default).")
+	flagCompletion := flag.String("completion", "", "") // hidden, see mitre-completion.go
+	// flagDbg and flagQuiet are declared globally; they feed verbosity
 
-	// Get mitigation external ID and name
-	chosenMit := mitMap[chosenMitSTIXID]
-	mitExt, _ := externalID(chosenMit.ExternalRefs)
+	/* ---------------------------------------------------------
+	   IMPORTANT: parse flags *before* any work that uses them
+	   ("doctor" may be given as a sub-command in front of them)
+	   --------------------------------------------------------- */
+	args := os.Args[1:]
+	doctorCmd := len(args) > 0 && args[0] == "doctor"
+	if doctorCmd {
+		args = args[1:]
+	}
+	_ = flag.CommandLine.Parse(args)
 
-	if *flagExecute {
-		// Execute mode - run INSERT statements against database
-		cfg := getNebulaConfig()
-		if *flagDbg {
-			fmt.Fprintf(os.Stderr, ">>> Connecting to Nebula Graph at %s:%d\n", cfg.Host, cfg.Port)
+	switch {
+	case *flagLogLevel != "":
+		lvl, err := parseLogLevel(*flagLogLevel)
+		if err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
 		}
+		verbosity = lvl
+	case *flagDbg:
+		verbosity = levelDebug
+	case *flagQuiet:
+		verbosity = levelWarn
+	}
 
-		session, cleanup, err := connectNebula(cfg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error connecting to Nebula Graph: %v\n", err)
-			os.Exit(1)
+	if *flagVersion {
+		fmt.Println(versionLine())
+		return
+	}
+
+	if *flagCompletion != "" {
+		if err := writeCompletion(os.Stdout, *flagCompletion, filepath.Base(os.Args[0])); err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
 		}
-		defer cleanup()
+		return
+	}
 
-		// Check if mitigation exists
-		exists, err := checkMitigationExists(session, mitExt)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error checking mitigation: %v\n", err)
-			os.Exit(1)
+	if *flagHistoryStats != "" {
+		if err := printHistoryStats(*flagHistoryStats, os.Stdout); err != nil {
+			errorf("error reading metrics history: %v\n", err)
+			exitRun(1)
 		}
+		return
+	}
+
+	names := graphNames{
+		TechniqueTag:     *flagTechTag,
+		MitigationTag:    *flagMitTag,
+		MitigatesEdge:    *flagMitigatesEdge,
+		SubtechniqueEdge: *flagSubtechEdge,
+		PartOfEdge:       *flagPartOfEdge,
+	}
+	if err := names.validate(); err != nil {
+		errorf("%v\n", err)
+		exitRun(1)
+	}
+
+	format, formatSource, notes, err := resolveFormat(*flagFormat, []formatFlag{
+		{"-json", *flagJSON, "json", true},
+		{"-jsonl", *flagJSONL, "jsonl", true},
+		{"-csv", *flagCSV && !*flagTSV, "csv", true},
+		{"-tsv", *flagTSV, "tsv", true},
+		{"-md", *flagMD, "md", true},
+		{"-html", *flagHTML, "html", false},
+		{"-ngql", *flagNGQL, "ngql", true},
+		{"-ngql-file", *flagNGQLFile != "", "ngql", false},
+		{"-importer-dir", *flagImporterDir != "", "ngql", false},
+		{"-sql", *flagSQL, "sql", true},
+		{"-cypher", *flagCypher, "cypher", true},
+		{"-gremlin", *flagGremlin, "gremlin", true},
+	})
+	if err != nil {
+		errorf("%v\n", err)
+		exitRun(1)
+	}
+	for _, n := range notes {
+		infof("note: %s\n", n)
+	}
 
-		if !exists {
-			fmt.Fprintf(os.Stderr, "ERROR: Mitigation %s does not exist in database.\n", mitExt)
-			fmt.Fprintf(os.Stderr, "You must create it first with:\n")
-			fmt.Fprintf(os.Stderr, "INSERT VERTEX IF NOT EXISTS tMitreMitigation(Mitigation_ID, Mitigation_Name, Matrix, Description, Mitigation_Version) VALUES \"%s\":(\"%s\", %s, \"Enterprise\", \"...\", \"...\");\n\n",
-				mitExt, mitExt, quoteLiteral(chosenMit.Name))
-			os.Exit(1)
+	if loadedDomains, err = parseDomains(*flagDomain); err != nil {
+		errorf("%v\n", err)
+		exitRun(1)
+	}
+	if *flagStixID != "" {
+		*flagStixID = strings.ToLower(strings.TrimSpace(*flagStixID))
+		if *mitID != "" || *mitName != "" {
+			errorf("-stix-id names the mitigation already: drop -mitigation/-mitigation-name\n")
+			exitRun(1)
+		}
+		if !strings.HasPrefix(*flagStixID, "course-of-action--") {
+			errorf("invalid -stix-id %q (need a mitigation's course-of-action--<uuid>)\n", *flagStixID)
+			exitRun(1)
+		}
+	}
+	onlyDomain := ""
+	if *flagOnlyDomain != "" {
+		if onlyDomain, err = parseOnlyDomain(*flagOnlyDomain); err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
+		}
+	}
+	// A bad version or mirror URL fails here, before the cache directory
+	// is created
+	if *flagAttackVersion != "" {
+		if attackVersion, err = parseAttackVersion(*flagAttackVersion); err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
+		}
+	}
+	if bundleURL = *flagBundleURL; bundleURL == "" {
+		bundleURL = os.Getenv("MITRE_BUNDLE_URL")
+	}
+	if bundleURL != "" {
+		if err := checkBundleURL(bundleURL, loadedDomains); err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
 		}
+	}
+	if *flagBundleFile != "" {
+		if *flagBundlePath != "" {
+			errorf("-bundle-file is the old name of -bundle-path: give only one\n")
+			exitRun(1)
+		}
+		*flagBundlePath = *flagBundleFile
+		infof("note: -bundle-file is deprecated; use -bundle-path\n")
+	}
+	if len(loadedDomains) > 1 {
+		if *flagChecksum != "" {
+			errorf("-checksum applies to one bundle; give -domain a single value with it\n")
+			exitRun(1)
+		}
+		if info, err := os.Stat(*flagBundlePath); *flagBundlePath == "-" || (err == nil && !info.IsDir()) {
+			errorf("-bundle-path %s holds one bundle; with several -domain values give a directory\n", *flagBundlePath)
+			exitRun(1)
+		}
+	}
+	if *flagRefresh && *flagCacheOnly {
+		errorf("-refresh and -cache-only contradict each other: pick one\n")
+		exitRun(1)
+	}
+	if !*flagOffline {
+		*flagOffline = getEnvBool("MITRE_OFFLINE", false)
+	}
+	if *flagRefresh && *flagOffline {
+		errorf("-refresh and -offline contradict each other: pick one\n")
+		exitRun(1)
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-prune", *flagPrune},
+		{"-dry-run", *flagDryRun},
+	} {
+		if f.set && !*flagExecute {
+			errorf("%s only applies to -execute\n", f.name)
+			exitRun(1)
+		}
+	}
+	if err := setupCacheDir(); err != nil {
+		errorf("%v\n", err)
+		exitRun(1)
+	}
 
-		// Find missing techniques
-		allTechIDs := make([]string, len(results))
-		for i, t := range results {
-			allTechIDs[i] = t.ExternalID
+	if *flagDoctor || doctorCmd {
+		checks := runDoctor(names)
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(checks)
+		} else {
+			printDoctor(os.Stdout, checks)
+		}
+		if doctorFailed(checks) {
+			exitRun(1)
 		}
+		return
+	}
 
-		missingTechniques, err := findMissingTechniques(session, allTechIDs)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error checking techniques: %v\n", err)
-			os.Exit(1)
+	if *flagHelp || (*mitID == "" && *mitName == "" && *flagStixID == "" && !*flagListMit && *flagSearch == "" && *flagServe == "") {
+		fmt.Fprintf(os.Stderr,
+			`Usage: %s -mitigation Mxxxx [options]
+       %s -list-mitigations [-format json|csv]
+       %s -search QUERY [-search-descriptions] [-format json]
+       %s -doctor [-format json]
+       %s -serve :8080
+
+Options:
+  -mitigation       ATT&CK mitigation external ID (Mxxxx)
+  -mitigation-name  Mitigation name (case-insensitive); a unique partial name
+                    is accepted, several matches are listed
+  -exact            Only accept an exact -mitigation-name match
+  -stix-id ID       Mitigation STIX ID (course-of-action--<uuid>) as other
+                    STIX tools name it, instead of -mitigation
+  -format F         Output format (one per run):
+                      table    aligned table (default)
+                      json     JSON array
+                      jsonl    JSON Lines, one self-describing record per technique
+                      csv      CSV
+                      tsv      tab-separated values
+                      md       GitHub-flavored markdown table
+                      html     self-contained HTML report (inline styles, ATT&CK
+                               links; -html is short for this)
+                      ngql     Nebula Graph INSERT statements (with DB check)
+                      sql      SQL INSERT statements for tables mitre_mitigation,
+                               mitre_technique and mitre_mitigates (no DB
+                               connection; commented CREATE TABLE preamble)
+                      cypher   Neo4j Cypher MERGE statements (no DB connection;
+                               recommended constraints as comments)
+                      gremlin  Gremlin upsert traversals, one per line (no DB
+                               connection)
+  -csv-delimiter C  CSV field delimiter, e.g. ';' for European Excel (default ,)
+  -csv-bom          Prefix CSV with a UTF-8 BOM
+  -csv-crlf         Use CRLF line endings in CSV
+  -full             Add description, detection and data
+                    sources to json/csv output (csv also gets the
+                    mitigation description, json the x_mitre_domains)
+  -describe-techniques
+                    Add technique descriptions to the table (first sentence),
+                    json/jsonl (raw), csv and md (citations removed)
+  -no-header        Leave out the mitigation name, URL and description above
+                    the table (the column header stays)
+  -detections       Add a DATA SOURCES column to the table and Data Sources
+                    and Detection columns to csv ("Source: Component", as
+                    on the ATT&CK site; -full JSON always has both)
+  -template FILE    Render the results with a Go text/template; the data is
+                    .Mitigation (ID, Name, Description, URL) and .Techniques,
+                    helpers: join, upper, lower, attackURL
+  -template-inline T
+                    Same as -template with the template text on the command line
+  -o, -output FILE  Write the table/json/csv/md/ngql/count output to FILE
+                    atomically (parent directories are created; -execute is
+                    unaffected)
+  -force            Allow -o/-output to overwrite an existing file
+  -dot FILE         Write a Graphviz graph (render with dot -Tpng); with -format
+                    ngql and a DB check, missing techniques get a dashed border
+  -graphml FILE     Write the same graph as GraphML
+  -xlsx FILE        Write an Excel workbook (summary + one sheet per mitigation)
+  -stix FILE        Write a STIX bundle with the mitigation, its techniques and
+                    the mitigates relationships (objects copied verbatim)
+  -include-revoked  Keep revoked/deprecated objects in -stix and -list-mitigations
+  -list-mitigations List all mitigations (ID and name); json/csv add the
+                    description
+  -search QUERY     Case-insensitive search of technique and mitigation names
+  -search-descriptions
+                    Make -search match descriptions as well
+  -color MODE       auto (default; terminals only, honours NO_COLOR), always, never.
+                    Table colours: bold header, cyan technique IDs, dimmed
+                    sub-techniques, yellow tactics; off, the output is plain
+  -width N          Fit the table into N columns (default: terminal width;
+                    piped output is never truncated)
+  -wide             Don't truncate names or abbreviate tactics in the table
+  -sort             Result order: id (default), name, tactic (matrix order);
+                    prefix with - to reverse, e.g. -sort -name. nGQL output
+                    always stays in ID order so scripts diff cleanly
+  -group-by tactic  One section per tactic (matrix order) in the table, or an
+                    object keyed by tactic with json; techniques without a
+                    known tactic go under "uncategorized"
+  -count            Print counts only: techniques, sub-techniques, per tactic
+                    (combine with -format json for a machine-readable object); with a
+                    database, also techniques present and mitigates edges
+  -gaps             Gap analysis: for each tactic the mitigation touches, the
+                    techniques of that tactic it does NOT mitigate, with
+                    covered/total counts (-format json for an array)
+  -platforms-summary
+                    Print how many of the techniques apply to each platform
+                    (Windows, Linux, macOS, ...), largest first; with -format
+                    json a {"platform": count} object
+  -ngql-file FILE   Write the nGQL script to FILE for "nebula-console -f"
+                    (implies -format ngql; never ends on a comment line)
+  -no-comments      Strip comment lines from the nGQL script
+  -importer-dir DIR Write techniques.csv, the three edge CSVs and importer.yaml
+                    for nebula-importer (implies -format ngql; with a DB check only
+                    missing techniques are written). importer.yaml holds
+                    NEBULA_PASS and is written mode 0600; with -no-db,
+                    -mitigates-props must name its properties (name=value)
+  -technique-tag, -mitigation-tag NAME
+                    Tag names of technique/mitigation vertices (default
+                    tMitreTechnique, tMitreMitigation)
+  -mitigates-edge, -subtechnique-edge, -part-of-edge NAME
+                    Edge type names (default mitigates, has_subtechnique,
+                    part_of)
+  -mitigates-props LIST
+                    Property values of each mitigates edge (default
+                    NULL,{domain}): nGQL literals (NULL, true, false, numbers,
+                    "strings") in the edge type's order, or name=value pairs,
+                    e.g. 'confidence=0.8,domain={domain}'. {domain} becomes
+                    the technique's domain (Enterprise, ICS, Mobile). With a
+                    database connection the values are checked against
+                    DESCRIBE EDGE first
+  -technique-schema FILE
+                    JSON file naming the tMitreTechnique ID/name columns and
+                    the other columns with their default values (default:
+                    Mitre_Attack_Version "18.0", rcelpe false, priority 4,
+                    execution_min 0.1667, execution_max 120).
+                    attack_version_column gets the bundle's ATT&CK release
+                    and technique_version_column each technique's
+                    x_mitre_version
+  -gremlin-graph-label-prefix P
+                    Prefix every gremlin vertex/edge label, e.g. attack_
+  -sql-dialect D    postgres (default, ON CONFLICT DO NOTHING), sqlite
+                    (INSERT OR IGNORE) or mysql (INSERT IGNORE)
+  -execute          Execute INSERT statements against database (interactive)
+  -yes              Confirm -execute without prompting (required when stdin
+                    is not a terminal)
+  -auto-create-mitigation
+                    With -execute, insert a missing mitigation vertex (name,
+                    matrix, description and version from ATT&CK) after
+                    confirmation
+  -prune            With -execute, delete stale mitigates edges (techniques the
+                    mitigation no longer covers in ATT&CK) after confirmation
+  -dry-run          With -execute, stop after the pre-flight checks; with
+                    -prune, print the DELETE EDGE statements that would run
+  -diff-confirm     With -execute, show a diff of DB vs. target instead of the script
+  -quiet            Print only the requested data (no banners, summaries or
+                    progress); warnings and errors still go to stderr.
+                    -execute without -yes still shows the summary it asks
+                    to confirm and its steps. Same as -log-level warn
+  -no-db            Skip database connection (show techniques only)
+  -strict           Treat data-quality warnings (unmapped tactics, malformed
+                    bundle objects) as errors
+  -no-truncate      Fail instead of truncating values that exceed FIXED_STRING columns
+  -exclude          Technique IDs to drop (T1059,T1547.001 or @file)
+  -include-only     Keep only these technique IDs (T1059,T1547.001 or @file)
+  -warn-orphans     List each mitigates relationship whose target is missing
+                    from the bundle (otherwise only their number is shown)
+  -follow-revoked   Follow a revoked mitigation to its replacement
+  -metrics-out      Append a JSON line of run timings to a local file (opt-in)
+  -metrics-include-host
+                    Record the Nebula host in -metrics-out (redacted by default)
+  -history-stats    Summarize a -metrics-out file and exit
+  -progress         Show bundle parsing progress (default when run in a terminal).
+                    Downloads always report progress: in place when stderr is
+                    a terminal, else a line at start and end; -quiet hides it
+  -no-index-cache   Always parse the bundle JSON. Normally the parsed maps
+                    are kept in <cache-dir>/<collection>.index.gob and
+                    reused while the bundle's SHA-256 is unchanged
+  -proxy URL        Proxy for the bundle download (default: HTTPS_PROXY,
+                    HTTP_PROXY and NO_PROXY from the environment)
+  -http-timeout D   Give up on a download attempt after D (default 60s);
+                    Ctrl-C aborts it at any time
+  -download-retries N
+                    Try the download up to N times (default 3; 1 = once).
+                    Network errors, HTTP 5xx and 429 are retried after an
+                    exponential backoff with jitter, or the server's
+                    Retry-After
+  -attack-version V Use ATT&CK release V (e.g. 15.1) from the versioned files
+                    in mitre-attack/attack-stix-data instead of the latest on
+                    mitre/cti master. Each release is cached separately and
+                    never expires; an unknown release fails with the nearby
+                    ones, and a bundle of another release is refused. Output
+                    headers mark the data as pinned
+  -bundle-url URL   Download the bundle from URL (http or https) instead of
+                    GitHub, e.g. an internal mirror; default MITRE_BUNDLE_URL.
+                    {collection} in URL becomes enterprise-attack etc., which
+                    is required with several -domain values; {version}
+                    becomes the -attack-version and is required with it. The
+                    cache file name includes a hash of the URL
+  -checksum HEX     Refuse a bundle (downloaded, cached or -bundle-path) whose
+                    SHA-256 differs; cached bundles are also checked against
+                    their .sha256 sidecar
+  -bundle-path P    Read the ATT&CK bundle from P instead of the cache or the
+                    network (air-gapped hosts): a file, - for stdin, or a
+                    directory holding <collection>.json per -domain (e.g.
+                    enterprise-attack.json, ics-attack.json; .json.gz works
+                    too). The same validation applies; a missing file and
+                    an invalid bundle are reported differently.
+                    -bundle-file is the old name
+  -domain LIST      ATT&CK domains to load and merge: enterprise (default), ics,
+                    mobile, e.g. enterprise,ics. Objects in several bundles
+                    are kept once (newest "modified" wins); mitigates edges
+                    carry the domain of their bundle, and with more than one
+                    domain the output gains a Domain column. With
+                    a -bundle-path file it only names the file's domain
+  -only-domain D    Keep only techniques whose x_mitre_domains list D
+                    (enterprise-attack, ics-attack, mobile-attack; the short
+                    names work too), whatever bundle they came from
+  -skip-validation  Use a bundle that isn't valid STIX 2.0/2.1 JSON with at
+                    least 100 objects (otherwise a bad cached copy is
+                    downloaded again and a bad download is retried once)
+  -cache-compress=false
+                    Store cached bundles as plain <collection>.json instead
+                    of gzipped .json.gz (the default), e.g. to read them by
+                    hand. Either form is read and converted on first use
+  -cache-ttl D      Download the bundle again once the cached copy (by file
+                    mtime) is older than D (default 168h, i.e. 7 days; 0
+                    keeps it forever). The check is a conditional request
+                    (ETag/Last-Modified, kept in <collection>.http.json), so
+                    an unchanged bundle isn't downloaded again. If the
+                    download fails the old copy is used with a warning
+  -cache-dir DIR    Where bundles are cached (default MITRE_CACHE_DIR, else
+                    mitremit in the user cache directory, e.g.
+                    ~/.cache/mitremit). A ./.mitre-cache from older versions
+                    is moved there. If DIR can't be created (or there is no
+                    user cache directory) a private one under the temp dir
+                    is used with a warning. Parallel runs can
+                    share it: one downloads, the others wait for its copy
+  -refresh          Download the bundle even if the cached copy is fresh
+  -cache-only       Never touch the network: use the cached bundle whatever
+                    its age, fail if there is none
+  -offline          For disconnected hosts (or MITRE_OFFLINE=1): make no HTTP
+                    request at all and use only the cache or -bundle-path. A
+                    missing cache fails at once, naming the files it looked
+                    for and how to seed them. -execute still connects to
+                    Nebula
+  -serve ADDR       Serve a read-only JSON API on ADDR (e.g. :8080): GET
+                    /mitigations, /mitigation/{id} (the -format json output)
+                    and /technique/{id} (its mitigations). The bundle is
+                    loaded once at startup; until then requests get a 503.
+                    -full, -sort, -group-by, -only-domain etc. apply.
+                    GET /healthz reports the loaded ATT&CK release; POST
+                    /reload fetches the bundle again (cache rules as for a
+                    new run) and swaps it in without dropping requests.
+                    GET /metrics has Prometheus metrics (requests, latency,
+                    reloads, bundle age, index cache hits)
+  -doctor           Check cache, bundle, config, Nebula connectivity and schema
+                    (also: "doctor" as the first argument; -format json)
+  -debug            Extra diagnostic output (same as -log-level debug)
+  -log-level L      Diagnostics on stderr: error, warn, info (default) or
+                    debug; overrides -quiet and -debug. stdout only ever
+                    carries the requested output
+  -version          Print version, git commit and build date, then exit
+  -h                Show this help
+
+Environment Variables (for -format ngql and -execute):
+  NEBULA_HOST       Database hostname/IP (default: 127.0.0.1)
+  NEBULA_PORT       Database port (default: 9669)
+  NEBULA_USER       Username (default: root)
+  NEBULA_PASS       Password (default: nebula)
+  NEBULA_SPACE      Space name (default: ESP01)
+
+
+-json, -jsonl, -csv, -tsv, -md, -ngql, -sql, -cypher and -gremlin still work
+but are deprecated in favour of -format. Output modes (-format, -count,
+-execute, -xlsx, -stix, -template, ...) are mutually exclusive.
+All data goes to stdout (or -o FILE); diagnostics always go to stderr.
+The exit status is 0 on success and 1 on any error, including a cancelled
+or unverified -execute.
+Tab completion: -completion bash, zsh or fish prints a script to install
+(e.g. -completion bash > /etc/bash_completion.d/mitremit).
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		exitRun(1)
+	}
+
+	if *flagOutput != "" && !*flagForce {
+		if _, err := os.Stat(*flagOutput); err == nil {
+			errorf("%s already exists (use -force to overwrite)\n", *flagOutput)
+			exitRun(1)
 		}
+	}
 
-		if *flagDbg {
-			fmt.Fprintf(os.Stderr, ">>> Total techniques: %d\n", len(allTechIDs))
-			fmt.Fprintf(os.Stderr, ">>> Missing techniques: %d\n", len(missingTechniques))
+	// tsv is CSV with a tab delimiter
+	csvComma := ','
+	if format == "tsv" {
+		csvComma = '\t'
+	} else if *flagCSVDelim != "," {
+		r := []rune(*flagCSVDelim)
+		if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' {
+			errorf("invalid -csv-delimiter %q (need one character other than a quote or newline)\n", *flagCSVDelim)
+			exitRun(1)
 		}
+		csvComma = r[0]
+	}
 
-		// Execute statements
-		if err := executeNGQL(session, mitExt, chosenMit.Name, results, missingTechniques); err != nil {
-			fmt.Fprintf(os.Stderr, "execution failed: %v\n", err)
-			os.Exit(1)
+	// One output per run: without this the first branch below would
+	// win and the rest be ignored silently. -count, -platforms-summary and
+	// -gaps only take json (their encoding), and -dot/-graphml ride along
+	// with ngql.
+	var modes []string
+	if format != "table" && !((*flagCount || *flagPlatformsSummary || *flagGaps || *flagServe != "") && format == "json") {
+		modes = append(modes, formatSource)
+	}
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-count", *flagCount},
+		{"-platforms-summary", *flagPlatformsSummary},
+		{"-gaps", *flagGaps},
+		{"-execute", *flagExecute},
+		{"-xlsx", *flagXLSX != ""},
+		{"-stix", *flagSTIX != ""},
+		{"-dot/-graphml", (*flagDOT != "" || *flagGraphML != "") && format != "ngql"},
+		{"-template", *flagTemplate != "" || *flagTemplateInline != ""},
+		{"-serve", *flagServe != ""},
+		{"-list-mitigations", *flagListMit && *flagServe != ""},
+		{"-search", *flagSearch != "" && *flagServe != ""},
+	} {
+		if f.set {
+			modes = append(modes, f.name)
 		}
+	}
+	if len(modes) > 1 {
+		errorf("conflicting output flags %s: pick one\n", strings.Join(modes, ", "))
+		exitRun(1)
+	}
 
-		return
+	if err := setupColors(*flagColor); err != nil {
+		errorf("%v\n", err)
+		exitRun(1)
 	}
 
-	if *flagNGQL {
-		// Enhanced nGQL generation with database check
-		if *flagNoDB {
-			// Generate nGQL without database check (assume all missing)
-			allTechIDs := make([]string, len(results))
-			for i, t := range results {
-				allTechIDs[i] = t.ExternalID
+	switch strings.TrimPrefix(*flagSort, "-") {
+	case "id", "name", "tactic":
+	default:
+		errorf("invalid -sort %q (use id, name or tactic; prefix - to reverse)\n", *flagSort)
+		exitRun(1)
+	}
+
+	if *flagTechSchema != "" {
+		s, err := loadTechniqueSchema(*flagTechSchema)
+		if err != nil {
+			errorf("technique schema error: %v\n", err)
+			exitRun(1)
+		}
+		techSchema = s
+	}
+
+	if edgeProps, err = parseMitigatesProps(*flagMitigatesProps); err != nil {
+		errorf("%v\n", err)
+		exitRun(1)
+	}
+	if *flagImporterDir != "" && *flagNoDB {
+		// Without the database the names and types must come from -mitigates-props
+		if _, err := importerEdgeProps(edgeProps, nil); err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
+		}
+	}
+
+	if !gremlinPrefixPattern.MatchString(*flagGremlinPrefix) {
+		errorf("invalid -gremlin-graph-label-prefix %q (letters, digits and _ only)\n", *flagGremlinPrefix)
+		exitRun(1)
+	}
+
+	if !validSQLDialect(*flagSQLDialect) {
+		errorf("invalid -sql-dialect %q (use %s)\n", *flagSQLDialect, strings.Join(sqlDialects, ", "))
+		exitRun(1)
+	}
+
+	switch *flagGroupBy {
+	case "", "tactic":
+	default:
+		errorf("invalid -group-by %q (use tactic)\n", *flagGroupBy)
+		exitRun(1)
+	}
+
+	// Parse the template before any bundle work so mistakes show up fast
+	tmpl, err := loadTemplate(*flagTemplate, *flagTemplateInline)
+	if err != nil {
+		errorf("template error: %v\n", err)
+		exitRun(1)
+	}
+
+	/* ---------------------------------------------------------
+	   Opt-in local metrics (written when main returns, and by
+	   exitRun for runs that fail or are cancelled)
+	   --------------------------------------------------------- */
+	if *flagMetricsOut != "" {
+		mode := format
+		switch {
+		case *flagCount:
+			mode = "count"
+		case *flagPlatformsSummary:
+			mode = "platforms-summary"
+		case *flagGaps:
+			mode = "gaps"
+		case *flagExecute:
+			mode = "execute"
+		case *flagXLSX != "":
+			mode = "xlsx"
+		case *flagSTIX != "":
+			mode = "stix"
+		case *flagDOT != "" || *flagGraphML != "":
+			mode = "graph"
+		case tmpl != nil:
+			mode = "template"
+		}
+		metrics = startMetrics(*flagMetricsOut, mode)
+		defer metrics.write(0)
+	}
+
+	// Data goes to stdout unless -o names a file; diagnostics stay on
+	// stderr either way. The file is buffered and written atomically
+	// when main returns, so a failed run never leaves a half-written file.
+	var out io.Writer = os.Stdout
+	if *flagOutput != "" && !*flagExecute {
+		buf := &bytes.Buffer{}
+		out = buf
+		defer func() {
+			if err := os.MkdirAll(filepath.Dir(*flagOutput), 0o755); err != nil {
+				errorf("error creating output directory: %v\n", err)
+				exitRun(1)
 			}
-			script := generateNGQL(mitExt, chosenMit.Name, results, allTechIDs)
-			fmt.Print(script)
-		} else {
-			// Connect to database and check for missing techniques
-			cfg := getNebulaConfig()
-			if *flagDbg {
-				fmt.Fprintf(os.Stderr, ">>> Connecting to Nebula Graph at %s:%d\n", cfg.Host, cfg.Port)
+			n := buf.Len()
+			if err := writeFileAtomic(*flagOutput, func(w io.Writer) error {
+				_, err := buf.WriteTo(w)
+				return err
+			}); err != nil {
+				errorf("error writing %s: %v\n", *flagOutput, err)
+				exitRun(1)
 			}
+			infof("wrote %d bytes to %s\n", n, *flagOutput)
+		}()
+	}
 
-			session, cleanup, err := connectNebula(cfg)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error connecting to Nebula Graph: %v\n", err)
-				os.Exit(1)
-			}
-			defer cleanup()
+	/* ---------------------------------------------------------
+	   Load the ATT&CK bundle
+	   --------------------------------------------------------- */
+	/* ---------------------------------------------------------
+	   Load the ATT&CK bundle(s) and build the lookup maps
+	   (mitigations, techniques, relationships); several -domain
+	   bundles are merged into one set
+	   --------------------------------------------------------- */
+	loadStart := time.Now()
+
+	// Progress on stderr: explicit -progress, or automatically when both
+	// streams are terminals (never when output is piped)
+	showProgress := *flagProgress || (logEnabled(levelInfo) && isTerminal(os.Stdout) && isTerminal(os.Stderr))
+
+	// The parsed index (mitre-index.go) skips the JSON parse when the
+	// bundle hasn't changed
+	useIndex := !*flagNoIndexCache && *flagSTIX == "" && *flagBundlePath == ""
+
+	// -serve listens before the (slow) load and answers 503 meanwhile
+	var api *apiServer
+	var apiErr <-chan error
+	if *flagServe != "" {
+		api, apiErr, err = startAPIServer(*flagServe, apiOptions{
+			Full:           *flagFull,
+			Describe:       *flagDescribe,
+			Sort:           *flagSort,
+			GroupBy:        *flagGroupBy,
+			OnlyDomain:     onlyDomain,
+			FollowRevoked:  *flagFollowRevoked,
+			IncludeRevoked: *flagIncludeRevoked,
+		}, func() (*attackData, error) {
+			return loadAttackData(false, useIndex, false)
+		})
+		if err != nil {
+			errorf("%v\n", err)
+			exitRun(1)
+		}
+	}
 
-			// Check if mitigation exists
-			exists, err := checkMitigationExists(session, mitExt)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error checking mitigation: %v\n", err)
-				os.Exit(1)
-			}
+	data, err := loadAttackData(*flagSTIX != "", useIndex, showProgress)
+	if err != nil {
+		errorf("error %v\n", err)
+		exitRun(1)
+	}
 
-			if !exists {
-				fmt.Fprintf(os.Stderr, "WARNING: Mitigation %s does not exist in database.\n", mitExt)
-				fmt.Fprintf(os.Stderr, "You may need to create it first with:\n")
-				fmt.Fprintf(os.Stderr, "INSERT VERTEX IF NOT EXISTS tMitreMitigation(Mitigation_ID, Mitigation_Name, Matrix, Description, Mitigation_Version) VALUES \"%s\":(\"%s\", %s, \"Enterprise\", \"...\", \"...\");\n\n",
-					mitExt, mitExt, quoteLiteral(chosenMit.Name))
-			}
+	// Skipped objects always show: a subtly corrupt bundle can otherwise
+	// lose relationships without a trace
+	parseWarnings := data.skipWarnings()
+	for _, w := range parseWarnings {
+		warnf("%s\n", w)
+	}
+	if *flagStrict && len(parseWarnings) > 0 {
+		errorf("error: %d bundle object(s) could not be parsed (-strict)\n", data.skipCount())
+		exitRun(1)
+	}
 
-			// Find missing techniques
-			allTechIDs := make([]string, len(results))
-			for i, t := range results {
-				allTechIDs[i] = t.ExternalID
-			}
+	mitMap := data.Mitigations  // key = STIX ID
+	techMap := data.Techniques  // key = STIX ID
+	revokedBy := data.RevokedBy // revoked STIX ID -> replacement STIX ID
+	rels := data.Relationships
+	detectedBy := data.detectedBy() // technique STIX ID -> "Source: Component"
 
-			missingTechniques, err := findMissingTechniques(session, allTechIDs)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error checking techniques: %v\n", err)
-				os.Exit(1)
-			}
+	if showProgress || logEnabled(levelDebug) {
+		fmt.Fprintf(os.Stderr, "parsed %d mitigations, %d techniques, %d relationships\n", len(mitMap), len(techMap), len(rels))
+	}
 
-			if *flagDbg {
-				fmt.Fprintf(os.Stderr, ">>> Total techniques: %d\n", len(allTechIDs))
-				fmt.Fprintf(os.Stderr, ">>> Missing techniques: %d\n", len(missingTechniques))
-			}
+	useBundleTables(data)
 
-			script := generateNGQL(mitExt, chosenMit.Name, results, missingTechniques)
-			fmt.Print(script)
+	if api != nil {
+		api.ready(data)
+		infof("bundle loaded: %d mitigations, %d techniques – ready\n", len(mitMap), len(techMap))
+		if err := waitAPIServer(apiErr); err != nil {
+			errorf("-serve: %v\n", err)
+			exitRun(1)
 		}
 		return
 	}
 
-	if *flagJSON {
-		enc := json.NewEncoder(os.Stdout)
-		enc.SetIndent("", "  ")
-		_ = enc.Encode(results)
+	if *flagSearch != "" {
+		matches := searchObjects(mitMap, techMap, *flagSearch, *flagSearchDesc, *flagIncludeRevoked)
+		if format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(matches)
+		} else {
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TYPE\tID\tNAME\tMATCHED IN")
+			for _, m := range matches {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Type, m.ExternalID, m.Name, m.Field)
+			}
+			_ = w.Flush()
+		}
+		if len(matches) == 0 {
+			warnf("no matches for %q\n", *flagSearch)
+		}
 		return
 	}
 
-	if *flagCSV {
-		w := csv.NewWriter(os.Stdout)
-		_ = w.Write([]string{"Mitigation ID", "Mitigation Name", "Technique ID", "Technique Name", "Tactics"})
-		for _, t := range results {
-			_ = w.Write([]string{mitExt, chosenMit.Name, t.ExternalID, t.Name, strings.Join(t.Tactics, "; ")})
+	if *flagListMit {
+		var err error
+		switch {
+		case format == "json":
+			err = listMitigationsJSON(out, mitMap, *flagIncludeRevoked)
+		case format == "csv":
+			err = listMitigationsCSV(out, mitMap, *flagIncludeRevoked)
+		default:
+			err = listMitigationsTable(out, mitMap, *flagIncludeRevoked)
+		}
+		if err != nil {
+			errorf("error listing mitigations: %v\n", err)
+			exitRun(1)
 		}
-		w.Flush()
 		return
 	}
 
-	// default: pretty table
-	printTable(chosenMitSTIXID, chosenMit, results, len(mitMap))
-}
-
-/*
--------------------------------------------------------------
-Pretty-print table (default output)
--------------------------------------------------------------
-*/
-func printTable(mitSTIX string, mit courseOfAction, data []techniqueInfo, totalMitigations int) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	mitExt, _ := externalID(mit.ExternalRefs)
-
-	fmt.Fprintf(w, "MITIGATION\t%s (%s)\n", mit.Name, mitExt)
-	fmt.Fprintf(w, "ACTIVE MITIGATIONS\t%d Enterprise mitigations (all others filtered out)\n", totalMitigations)
-	fmt.Fprintln(w, "---------------------------------------------------------------")
-	fmt.Fprintln(w, "TECHNIQUE ID\tTECHNIQUE NAME\tTACTICS")
-
-	for _, t := range data {
-		tactics := strings.Join(t.Tactics, ", ")
-		fmt.Fprintf(w, "%s\t%s\t%s\n", t.ExternalID, t.Name, tactics)
-	}
+	/* ---------------------------------------------------------
+	   Find the mitigation requested by the user
+	   --------------------------------------------------------- */
+	var chosenMitSTIXID string // STIX ID we will match on source_ref
 
-	_ = w.Flush()
+	if *flagStixID != "" {
+		// lookup by STIX ID: a key of mitMap as it is
+		if _, ok := mitMap[*flagStixID]; !ok {
+			errorf("mitigation %s not found in ATT&CK data\n", *flagStixID)
+			exitRun(1)
+		}
+		chosenMitSTIXID = *flagStixID
+	} else if *mitID != "" {
+		// lookup by external ID (Mxxxx)
+		id, ok := data.mitigationByExternalID(*mitID)
+		if !ok {
+			errorf("mitigation %s not found in ATT&CK data\n", *mitID)
+			exitRun(1)
+		}
+		chosenMitSTIXID = id
+	} else {
+		// lookup by name (case-insensitive)
+		target := strings.TrimSpace(*mitName)
+		for id, co := range mitMap {
+			if strings.EqualFold(co.Name, target) {
+				chosenMitSTIXID = id
+				break
+			}
+		}
+		if chosenMitSTIXID == "" && !*flagExact {
+			// fall back to partial matches
+			candidates := matchMitigationName(mitMap, target)
+			switch len(candidates) {
+			case 0:
+			case 1:
+				chosenMitSTIXID = candidates[0]
+				co := mitMap[chosenMitSTIXID]
+				ext, _ := externalID(co.ExternalRefs)
+				infof("using %s (%s) – only mitigation matching %q\n", ext, co.Name, target)
+			default:
+				errorf("mitigation name %q is ambiguous; candidates:\n", target)
+				printMitigationCandidates(os.Stderr, mitMap, candidates)
+				exitRun(1)
+			}
+		}
+		if chosenMitSTIXID == "" {
+			errorf("mitigation name %q not found (check spelling)\n", target)
+			if !*flagExact {
+				if close := closestMitigationNames(mitMap, target, 3); len(close) > 0 {
+					errorf("did you mean:\n")
+					printMitigationCandidates(os.Stderr, mitMap, close)
+				}
+			}
+			exitRun(1)
+		}
+	}
+
+	// A revoked mitigation is only used when -follow-revoked lets us
+	// switch to its replacement.
+	if co := mitMap[chosenMitSTIXID]; co.Revoked {
+		ext, _ := externalID(co.ExternalRefs)
+		note := revokedNote(chosenMitSTIXID, revokedBy, mitMap, techMap)
+		repl, ok := resolveRevoked(chosenMitSTIXID, revokedBy)
+		if !*flagFollowRevoked || !ok {
+			errorf("mitigation %s is %s\n", ext, note)
+			if ok {
+				errorf("re-run with -follow-revoked to use the replacement\n")
+			}
+			exitRun(1)
+		}
+		if _, found := mitMap[repl]; !found {
+			errorf("mitigation %s is %s, which is not a mitigation in this bundle\n", ext, note)
+			exitRun(1)
+		}
+		infof("mitigation %s is %s – following\n", ext, note)
+		chosenMitSTIXID = repl
+	}
+
+	/* ---------------------------------------------------------
+	   Collect all techniques that this mitigation mitigates
+	   --------------------------------------------------------- */
+	// Relationships that can't become edges (revoked/deprecated ends or
+	// the relationship itself) are dropped up front
+	mitigatesRels, droppedRels := data.resolveMitigates()
+	var relWarnings []string // this mitigation's drops, for -count JSON
+	for _, d := range droppedRels {
+		if d.Relationship.SourceRef != chosenMitSTIXID {
+			continue
+		}
+		w := fmt.Sprintf("dropped mitigates relationship %s to %s: %s", d.Relationship.ID, d.Relationship.TargetRef, d.Reason)
+		relWarnings = append(relWarnings, w)
+		debugf("%s\n", w)
+	}
+	debugf("%d of %d mitigates relationships in the bundle dropped as revoked/deprecated/missing\n", len(droppedRels), len(droppedRels)+len(mitigatesRels))
+
+	results, orphans, outsideDomain := collectTechniques(data, mitigatesRels, chosenMitSTIXID, onlyDomain, detectedBy, infof)
+
+	if outsideDomain > 0 {
+		infof("%d technique(s) outside %s skipped (-only-domain)\n", outsideDomain, onlyDomain)
+	}
+
+	// Relationships whose target isn't an attack-pattern in the bundle
+	// are dropped; say so, since they make edge counts look wrong
+	if len(orphans) > 0 {
+		if *flagWarnOrphans || logEnabled(levelDebug) {
+			for _, r := range orphans {
+				warnf("orphaned mitigates relationship %s: target %s is not a technique in the bundle\n", r.ID, r.TargetRef)
+			}
+		} else {
+			warnf("%d mitigates relationship(s) point to objects not in the bundle (-warn-orphans lists them)\n", len(orphans))
+		}
+		if metrics != nil {
+			metrics.Orphans = len(orphans)
+		}
+	}
+
+	/* ---------------------------------------------------------
+	   Apply -exclude / -include-only
+	   --------------------------------------------------------- */
+	if *flagExclude != "" || *flagIncludeOnly != "" {
+		knownTech := make(map[string]bool, len(data.TechniqueByExt))
+		for ext := range data.TechniqueByExt {
+			knownTech[ext] = true
+		}
+
+		filters := []struct {
+			name, value string
+			keep        bool
+		}{
+			{"exclude", *flagExclude, false},
+			{"include-only", *flagIncludeOnly, true},
+		}
+		for _, f := range filters {
+			if f.value == "" {
+				continue
+			}
+			ids, err := parseTechniqueIDs(f.name, f.value, knownTech)
+			if err == nil {
+				err = ids.report()
+			}
+			if err != nil {
+				errorf("%v\n", err)
+				exitRun(1)
+			}
+
+			set := ids.set()
+			kept := results[:0]
+			for _, t := range results {
+				if set[t.ExternalID] == f.keep {
+					kept = append(kept, t)
+				}
+			}
+			results = kept
+		}
+	}
+
+	// deterministic ordering – nice for CSV/JSON diffing
+	sortTechniques(results, *flagSort)
+
+	metrics.phase("load", loadStart)
+	if metrics != nil {
+		metrics.Mitigations = 1
+		metrics.Techniques = len(results)
+	}
+
+	/* ---------------------------------------------------------
+	   Emit the requested output format
+	   --------------------------------------------------------- */
+
+	// Get mitigation external ID and name
+	chosenMit := mitMap[chosenMitSTIXID]
+	mitExt, _ := externalID(chosenMit.ExternalRefs)
+
+	if *flagCount {
+		summary := summarize(mitExt, chosenMit.Name, results)
+		summary.Orphaned = len(orphans)
+		summary.Warnings = relWarnings
+		summary.ParseWarnings = parseWarnings
+		for _, r := range orphans {
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("orphaned mitigates relationship %s: target %s is not a technique in the bundle", r.ID, r.TargetRef))
+		}
+		// The database part is informational: an unreachable server only
+		// leaves it out and never changes the exit code
+		if !*flagNoDB {
+			cfg := getNebulaConfig()
+			if session, cleanup, err := connectNebula(cfg); err != nil {
+				infof("database counts skipped: %v\n", err)
+			} else {
+				summary.Database, err = countFromDatabase(session, names, mitExt, results)
+				if err != nil {
+					infof("database counts skipped: %v\n", err)
+				}
+				cleanup()
+			}
+		}
+		if format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(summary)
+		} else {
+			printCount(out, summary)
+		}
+		return
+	}
+
+	if *flagPlatformsSummary {
+		counts := platformCounts(results)
+		if format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(counts)
+		} else {
+			printPlatformsSummary(out, mitExt, chosenMit.Name, len(results), counts)
+		}
+		return
+	}
+
+	if *flagGaps {
+		gaps := findGaps(results, techniquesByTactic(techMap, onlyDomain))
+		if format == "json" {
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(gaps)
+		} else {
+			pal := colorOut
+			if out != io.Writer(os.Stdout) {
+				pal = palette{}
+			}
+			printGaps(out, mitExt, chosenMit.Name, gaps, pal)
+		}
+		return
+	}
+
+	// -dot/-graphml files; missing is only known after a database check
+	writeGraphs := func(missing map[string]bool) {
+		view := graphView{MitigationID: mitExt, MitigationName: chosenMit.Name, Techniques: results, Missing: missing}
+		for _, g := range []struct {
+			path  string
+			write func(io.Writer, graphView) error
+		}{{*flagDOT, writeDOT}, {*flagGraphML, writeGraphML}} {
+			if g.path == "" {
+				continue
+			}
+			if err := writeFileAtomic(g.path, func(w io.Writer) error { return g.write(w, view) }); err != nil {
+				errorf("error writing %s: %v\n", g.path, err)
+				exitRun(1)
+			}
+			infof("wrote %s\n", g.path)
+		}
+	}
+
+	// Generated scripts stay in ID order regardless of -sort
+	if *flagExecute || format == "ngql" || format == "sql" || format == "cypher" || format == "gremlin" {
+		sortTechniques(results, "id")
+	}
+
+	if *flagExecute {
+		// Execute mode - run INSERT statements against database
+		cfg := getNebulaConfig()
+		debugf("Connecting to Nebula Graph at %s:%d\n", cfg.Host, cfg.Port)
+
+		dbStart := time.Now()
+		session, cleanup, err := connectNebula(cfg)
+		if err != nil {
+			errorf("error connecting to Nebula Graph: %v\n", err)
+			exitRun(1)
+		}
+		defer cleanup()
+		if metrics != nil && *flagMetricsHost {
+			metrics.Host = cfg.Host
+		}
+		if metrics != nil {
+			metrics.ServerVersion = nebulaServerVersion(session)
+		}
+
+		// Check if mitigation exists
+		exists, err := checkMitigationExists(session, names, mitExt)
+		if err != nil {
+			errorf("error checking mitigation: %v\n", err)
+			exitRun(1)
+		}
+
+		switch {
+		case exists:
+		case *flagDryRun:
+			warnf("Mitigation %s does not exist in database (dry run: not created).\n", mitExt)
+		case *flagAutoCreate:
+			if err := createMitigation(session, names, mitExt, chosenMit, *flagNoTruncate); err != nil {
+				if errors.Is(err, errCancelled) {
+					errorf("Execution cancelled by user.\n")
+				} else {
+					errorf("error creating mitigation: %v\n", err)
+				}
+				exitRun(1)
+			}
+		default:
+			stmt, _, _ := insertMitigationStmt(names, mitExt, chosenMit, nil, false)
+			errorf("ERROR: Mitigation %s does not exist in database.\n", mitExt)
+			errorf("Re-run with -auto-create-mitigation, or create it first with:\n")
+			errorf("%s\n\n", stmt)
+			exitRun(1)
+		}
+
+		// Find missing techniques
+		allTechIDs := make([]string, len(results))
+		for i, t := range results {
+			allTechIDs[i] = t.ExternalID
+		}
+
+		missingTechniques, err := findMissingTechniques(session, names, allTechIDs)
+		if err != nil {
+			errorf("error checking techniques: %v\n", err)
+			exitRun(1)
+		}
+		warnIfGraphBehind(session, names, presentTechniques(allTechIDs, missingTechniques))
+		edgeFields, err := describeEdgeFields(session, names.MitigatesEdge)
+		if err == nil {
+			err = checkMitigatesProps(edgeFields, names.MitigatesEdge, edgeProps)
+		}
+		if err != nil {
+			errorf("error: %v\n", err)
+			exitRun(1)
+		}
+
+		// Fit string values to the declared column sizes before any
+		// statement is generated
+		limits, err := describeStringLimits(session, names.TechniqueTag)
+		if err != nil {
+			errorf("error reading %s schema: %v\n", names.TechniqueTag, err)
+			exitRun(1)
+		}
+		var truncs []truncation
+		results, truncs, err = fitTechniques(results, limits, *flagNoTruncate)
+		if err != nil {
+			errorf("error: %v\n", err)
+			exitRun(1)
+		}
+
+		metrics.phase("db_check", dbStart)
+
+		debugf("Total techniques: %d\n", len(allTechIDs))
+		debugf("Missing techniques: %d\n", len(missingTechniques))
+
+		if err := checkTacticMapping(results, missingTechniques); err != nil {
+			errorf("error: %v\n", err)
+			exitRun(1)
+		}
+
+		// Idempotency pre-flight: what the graph already has vs. ATT&CK
+		mitigated, err := findMitigatedTechniques(session, names, mitExt)
+		if err != nil {
+			errorf("error reading existing %s edges: %v\n", names.MitigatesEdge, err)
+			exitRun(1)
+		}
+		present, toAdd, stale := diffMitigates(results, mitigated)
+		infof("%d edges already present, %d to add, %d stale edges in DB not in ATT&CK\n", len(present), len(toAdd), len(stale))
+
+		// -dry-run previews the prune and stops before anything is written
+		if *flagDryRun {
+			if *flagPrune {
+				for _, stmt := range pruneStatements(names, mitExt, stale) {
+					fmt.Fprintln(out, stmt)
+				}
+			}
+			infof("dry run: would prune %d and add %d %s edges; nothing executed\n", len(stale), len(toAdd), names.MitigatesEdge)
+			return
+		}
+
+		if len(stale) > 0 {
+			if *flagPrune {
+				if err := pruneMitigates(session, names, mitExt, stale); err != nil {
+					errorf("prune failed: %v\n", err)
+					exitRun(1)
+				}
+			} else {
+				infof("stale: %s (use -prune to delete)\n", strings.Join(stale, " "))
+			}
+		}
+
+		// Execute statements
+		if err := executeNGQL(session, names, mitExt, chosenMit.Name, results, missingTechniques, truncs); err != nil {
+			if errors.Is(err, errCancelled) {
+				errorf("Execution cancelled by user.\n")
+			} else {
+				errorf("execution failed: %v\n", err)
+			}
+			exitRun(1)
+		}
+
+		return
+	}
+
+	if tmpl != nil {
+		if err := renderTemplate(out, tmpl, chosenMit, results); err != nil {
+			errorf("template error: %v\n", err)
+			exitRun(1)
+		}
+		return
+	}
+
+	if *flagSTIX != "" {
+		allowed := make(map[string]bool)
+		for _, t := range results {
+			allowed[t.ExternalID] = true
+		}
+		objects := stixSlice(chosenMitSTIXID, rels, techMap, allowed, *flagIncludeRevoked, revokedBy, data.Raw)
+		err := writeFileAtomic(*flagSTIX, func(w io.Writer) error {
+			return writeSTIXBundle(w, data.SpecVersion, objects)
+		})
+		if err != nil {
+			errorf("error writing %s: %v\n", *flagSTIX, err)
+			exitRun(1)
+		}
+		return
+	}
+
+	if *flagDOT != "" || *flagGraphML != "" {
+		writeGraphs(nil)
+		return
+	}
+
+	if *flagXLSX != "" {
+		if err := writeXLSX(*flagXLSX, []xlsxMitigation{{ID: mitExt, Name: chosenMit.Name, Techniques: results}}); err != nil {
+			errorf("error writing %s: %v\n", *flagXLSX, err)
+			exitRun(1)
+		}
+		return
+	}
+
+	switch format {
+	case "sql":
+		fmt.Fprint(out, generateSQL(*flagSQLDialect, mitExt, chosenMit, results))
+	case "cypher", "gremlin":
+		// Upserts write tactic edges for every technique, so check them all
+		allTechIDs := make([]string, len(results))
+		for i, t := range results {
+			allTechIDs[i] = t.ExternalID
+		}
+		if err := checkTacticMapping(results, allTechIDs); err != nil {
+			errorf("error: %v\n", err)
+			exitRun(1)
+		}
+		if format == "gremlin" {
+			fmt.Fprint(out, generateGremlin(*flagGremlinPrefix, mitExt, chosenMit.Name, results))
+		} else {
+			fmt.Fprint(out, generateCypher(mitExt, chosenMit.Name, results))
+		}
+	case "ngql":
+		// Enhanced nGQL generation with database check
+		var script string
+		var statements map[string]int
+		var missing []string
+		var edgeFields []edgeField // from the database, for -importer-dir
+		if *flagNoDB {
+			// Generate nGQL without database check (assume all missing)
+			allTechIDs := make([]string, len(results))
+			for i, t := range results {
+				allTechIDs[i] = t.ExternalID
+			}
+			if err := checkTacticMapping(results, allTechIDs); err != nil {
+				errorf("error: %v\n", err)
+				exitRun(1)
+			}
+			script, statements = generateNGQL(names, mitExt, chosenMit.Name, results, allTechIDs)
+			missing = allTechIDs
+			writeGraphs(nil)
+		} else {
+			// Connect to database and check for missing techniques
+			cfg := getNebulaConfig()
+			debugf("Connecting to Nebula Graph at %s:%d\n", cfg.Host, cfg.Port)
+
+			dbStart := time.Now()
+			session, cleanup, err := connectNebula(cfg)
+			if err != nil {
+				errorf("error connecting to Nebula Graph: %v\n", err)
+				exitRun(1)
+			}
+			defer cleanup()
+			if metrics != nil && *flagMetricsHost {
+				metrics.Host = cfg.Host
+			}
+			if metrics != nil {
+				metrics.ServerVersion = nebulaServerVersion(session)
+			}
+
+			// Check if mitigation exists
+			exists, err := checkMitigationExists(session, names, mitExt)
+			if err != nil {
+				errorf("error checking mitigation: %v\n", err)
+				exitRun(1)
+			}
+
+			if !exists {
+				stmt, _, _ := insertMitigationStmt(names, mitExt, chosenMit, nil, false)
+				warnf("Mitigation %s does not exist in database.\nYou may need to create it first with:\n%s\n\n", mitExt, stmt)
+			}
+
+			// Find missing techniques
+			allTechIDs := make([]string, len(results))
+			for i, t := range results {
+				allTechIDs[i] = t.ExternalID
+			}
+
+			missingTechniques, err := findMissingTechniques(session, names, allTechIDs)
+			if err != nil {
+				errorf("error checking techniques: %v\n", err)
+				exitRun(1)
+			}
+			warnIfGraphBehind(session, names, presentTechniques(allTechIDs, missingTechniques))
+			edgeFields, err = describeEdgeFields(session, names.MitigatesEdge)
+			if err == nil {
+				err = checkMitigatesProps(edgeFields, names.MitigatesEdge, edgeProps)
+			}
+			if err != nil {
+				errorf("error: %v\n", err)
+				exitRun(1)
+			}
+
+			limits, err := describeStringLimits(session, names.TechniqueTag)
+			if err != nil {
+				errorf("error reading %s schema: %v\n", names.TechniqueTag, err)
+				exitRun(1)
+			}
+			var truncs []truncation
+			results, truncs, err = fitTechniques(results, limits, *flagNoTruncate)
+			if err != nil {
+				errorf("error: %v\n", err)
+				exitRun(1)
+			}
+			printTruncations(os.Stderr, truncs)
+
+			missingMap := make(map[string]bool)
+			for _, id := range missingTechniques {
+				missingMap[id] = true
+			}
+			writeGraphs(missingMap)
+			if logEnabled(levelInfo) {
+				printTechniqueStatus(os.Stderr, colorErr, results, missingMap)
+			}
+
+			metrics.phase("db_check", dbStart)
+
+			debugf("Total techniques: %d\n", len(allTechIDs))
+			debugf("Missing techniques: %d\n", len(missingTechniques))
+
+			if err := checkTacticMapping(results, missingTechniques); err != nil {
+				errorf("error: %v\n", err)
+				exitRun(1)
+			}
+			script, statements = generateNGQL(names, mitExt, chosenMit.Name, results, missingTechniques)
+			missing = missingTechniques
+		}
+
+		if *flagImporterDir != "" {
+			if err := writeImporterDir(*flagImporterDir, getNebulaConfig(), names, mitExt, results, missing, edgeFields); err != nil {
+				errorf("error writing %s: %v\n", *flagImporterDir, err)
+				exitRun(1)
+			}
+			infof("wrote importer.yaml to %s\n", *flagImporterDir)
+			return
+		}
+
+		metrics.countAll(statements)
+
+		if *flagNGQLFile != "" {
+			script = consoleScript(script, !*flagNoComments)
+			if err := writeFileAtomic(*flagNGQLFile, func(w io.Writer) error {
+				_, err := io.WriteString(w, script)
+				return err
+			}); err != nil {
+				errorf("error writing %s: %v\n", *flagNGQLFile, err)
+				exitRun(1)
+			}
+			infof("wrote %d bytes to %s\n", len(script), *flagNGQLFile)
+			return
+		}
+		if *flagNoComments {
+			script = consoleScript(script, false)
+		}
+		fmt.Fprint(out, script)
+	case "jsonl":
+		if err := printJSONL(out, mitExt, chosenMit.Name, results, *flagFull, *flagDescribe); err != nil {
+			errorf("error writing JSON Lines: %v\n", err)
+			exitRun(1)
+		}
+	case "json":
+		items := results
+		if !*flagFull {
+			items = make([]techniqueInfo, len(results))
+			for i, t := range results {
+				items[i] = t.brief(*flagDescribe)
+			}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if *flagGroupBy == "tactic" {
+			_ = enc.Encode(groupedJSON(groupByTactic(items)))
+		} else {
+			_ = enc.Encode(items)
+		}
+	case "csv", "tsv":
+		if *flagCSVBOM {
+			_, _ = io.WriteString(out, "\ufeff")
+		}
+		w := csv.NewWriter(out)
+		w.Comma = csvComma
+		w.UseCRLF = *flagCSVCRLF
+		header := []string{"Mitigation ID", "Mitigation Name", "Technique ID", "Technique Name", "Parent ID", "Parent Name", "Tactics", "Platforms", "URL"}
+		if multiDomain() {
+			header = append(header, "Domain")
+		}
+		if *flagFull {
+			header = append(header, "Description", "Detection", "Data Sources", "Mitigation Description")
+		} else {
+			if *flagDetections {
+				header = append(header, "Data Sources", "Detection")
+			}
+			if *flagDescribe {
+				header = append(header, "Description")
+			}
+		}
+		_ = w.Write(header)
+		for _, t := range results {
+			row := []string{mitExt, chosenMit.Name, t.ExternalID, t.Name, t.ParentID, t.ParentName, strings.Join(t.Tactics, "; "), strings.Join(t.Platforms, "; "), t.URL}
+			if multiDomain() {
+				row = append(row, t.Domain)
+			}
+			if *flagFull {
+				row = append(row, displayDescription(t.Description), t.Detection, strings.Join(t.DataSources, "; "), chosenMit.Description)
+			} else {
+				if *flagDetections {
+					row = append(row, strings.Join(t.DataSources, "; "), displayDescription(t.Detection))
+				}
+				if *flagDescribe {
+					row = append(row, displayDescription(t.Description))
+				}
+			}
+			_ = w.Write(row)
+		}
+		w.Flush()
+	case "md":
+		printMarkdown(out, mitExt, chosenMit.Name, results, *flagDescribe || *flagFull)
+	case "html":
+		if err := printHTML(out, chosenMit, results, *flagDescribe || *flagFull); err != nil {
+			errorf("html: %v\n", err)
+			exitRun(1)
+		}
+	default: // table
+		// Fit the table to the terminal unless -wide; pipes and files never
+		// truncate
+		tableWidth := 0
+		switch {
+		case *flagWide || out != io.Writer(os.Stdout):
+		case *flagWidth > 0:
+			tableWidth = *flagWidth
+		case isTerminal(os.Stdout):
+			tableWidth = terminalWidth(os.Stdout)
+		}
+		pal := colorOut
+		if out != io.Writer(os.Stdout) {
+			pal = palette{}
+		}
+		if *flagGroupBy == "tactic" {
+			printGroupedTable(out, chosenMit, groupByTactic(results), len(mitMap), pal, logEnabled(levelInfo) && !*flagNoHeader, *flagDetections, *flagDescribe)
+		} else {
+			printTable(out, chosenMit, results, len(mitMap), tableWidth, pal, logEnabled(levelInfo) && !*flagNoHeader, *flagDetections, *flagDescribe)
+		}
+	}
+}
+
+/*
+-------------------------------------------------------------
+Pretty-print table (default output)
+-------------------------------------------------------------
+*/
+// printTableBanner writes the mitigation block above the table: name and ID,
+// the ATT&CK URL and the first sentence of the description when the bundle
+// has them.
+func printTableBanner(w io.Writer, mit courseOfAction, totalMitigations int, pal palette) {
+	mitExt, _ := externalID(mit.ExternalRefs)
+	fmt.Fprintf(w, "MITIGATION\t%s\n", pal.bold(fmt.Sprintf("%s (%s)", mit.Name, mitExt)))
+	if url := externalURL(mit.ExternalRefs); url != "" {
+		fmt.Fprintf(w, "URL\t%s\n", url)
+	}
+	if desc := firstSentence(mit.Description); desc != "" {
+		fmt.Fprintf(w, "DESCRIPTION\t%s\n", desc)
+	}
+	fmt.Fprintf(w, "ATT&CK\t%s\n", bundleRelease)
+	fmt.Fprintf(w, "ACTIVE MITIGATIONS\t%d %s mitigations (all others filtered out)\n", totalMitigations, domainLabels())
+	fmt.Fprintln(w, "---------------------------------------------------------------")
+}
+
+// printTable renders the default table. width is the terminal width to fit
+// into; 0 means never truncate (pipes, -wide). banner adds the mitigation
+// block (printTableBanner) above the column header.
+// Optional trailing columns: detections adds DATA SOURCES, describe adds
+// DESCRIPTION (first sentence). -width fitting doesn't account for them.
+func printTable(out io.Writer, mit courseOfAction, data []techniqueInfo, totalMitigations int, width int, pal palette, banner, detections, describe bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	if banner {
+		printTableBanner(w, mit, totalMitigations, pal)
+	}
+	header := []string{"TECHNIQUE ID", "TECHNIQUE NAME", "TACTICS", "PLATFORMS"}
+	if multiDomain() {
+		header = append(header, "DOMAIN")
+	}
+	if detections {
+		header = append(header, "DATA SOURCES")
+	}
+	if describe {
+		header = append(header, "DESCRIPTION")
+	}
+	for i, h := range header {
+		header[i] = pal.bold(h)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	// Every cell but the last is wrapped (see palette) so colour codes
+	// don't skew the alignment. Sub-techniques are dimmed so the parent
+	// rows stand out
+	names, tactics, platforms, legend := fitTableColumns(data, width)
+	for i, t := range data {
+		id, name := pal.cyan(t.ExternalID), pal.plain(names[i])
+		if isSubtechnique(t.ExternalID) {
+			id, name = pal.dim(t.ExternalID), pal.dim(names[i])
+		}
+		cells := []string{id, name, pal.yellow(tactics[i]), platforms[i]}
+		if multiDomain() {
+			cells = append(cells, t.Domain)
+		}
+		if detections {
+			cells = append(cells, strings.Join(t.DataSources, ", "))
+		}
+		if describe {
+			cells = append(cells, firstSentence(t.Description))
+		}
+		for j := 3; j < len(cells)-1; j++ {
+			cells[j] = pal.plain(cells[j])
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+
+	_ = w.Flush()
+
+	if len(legend) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "TACTICS: "+strings.Join(legend, ", "))
+	}
+}
+
+// fitTableColumns returns the name and tactics cell for every row so the
+// table fits in width columns. Tactics switch to TA-IDs first (with a legend
+// of the IDs used); names are then cut with an ellipsis, never below a
+// readable minimum. width 0 returns everything unchanged.
+func fitTableColumns(data []techniqueInfo, width int) (names, tactics, platforms, legend []string) {
+	const gap = 2      // tabwriter padding
+	const minName = 16 // don't cut names shorter than this
+
+	names = make([]string, len(data))
+	tactics = make([]string, len(data))
+	platforms = make([]string, len(data))
+	abbrev := make([]string, len(data))
+
+	idW, nameW, tacW, abbrW, platW := len("TECHNIQUE ID"), len("TECHNIQUE NAME"), len("TACTICS"), len("TACTICS"), len("PLATFORMS")
+	used := make(map[string]bool)
+	for i, t := range data {
+		names[i] = t.displayName()
+		if t.RevokedFrom != "" {
+			names[i] += " (replaces revoked " + t.RevokedFrom + ")"
+		}
+		tacticNames := make([]string, len(t.Tactics))
+		for j, phase := range t.Tactics {
+			tacticNames[j] = tacticName(phase)
+		}
+		tactics[i] = strings.Join(tacticNames, ", ")
+		platforms[i] = strings.Join(t.Platforms, ", ")
+
+		ids := make([]string, len(t.Tactics))
+		for j, phase := range t.Tactics {
+			if id, ok := tacticPhaseToID[phase]; ok {
+				ids[j] = id
+				used[id+" = "+phase] = true
+			} else {
+				ids[j] = phase
+			}
+		}
+		abbrev[i] = strings.Join(ids, ",")
+
+		idW = max(idW, utf8.RuneCountInString(t.ExternalID))
+		nameW = max(nameW, utf8.RuneCountInString(names[i]))
+		tacW = max(tacW, utf8.RuneCountInString(tactics[i]))
+		abbrW = max(abbrW, utf8.RuneCountInString(abbrev[i]))
+		platW = max(platW, utf8.RuneCountInString(platforms[i]))
+	}
+
+	if width <= 0 || idW+gap+nameW+gap+tacW+gap+platW <= width {
+		return names, tactics, platforms, nil
+	}
+
+	// Tight: abbreviate tactics, then cut names to what's left
+	tactics = abbrev
+	for entry := range used {
+		legend = append(legend, entry)
+	}
+	sort.Strings(legend)
+
+	room := max(width-idW-gap-gap-abbrW-gap-platW, minName)
+	for i, n := range names {
+		if utf8.RuneCountInString(n) > room {
+			r := []rune(n)
+			names[i] = string(r[:room-1]) + "…"
+		}
+	}
+	return names, tactics, platforms, legend
+}
+
+/*
+-------------------------------------------------------------
+Markdown table output (-md)
+-------------------------------------------------------------
+*/
+
+// mdReplacer escapes characters that would break a GFM table cell or be
+// picked up as inline formatting.
+var mdReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	"|", `\|`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+	"\n", " ",
+)
+
+func mdEscape(s string) string {
+	return mdReplacer.Replace(s)
+}
+
+// printMarkdown writes one "##" section per mitigation, so several calls in a
+// row produce a single well-formed document.
+func printMarkdown(out io.Writer, mitExt, mitName string, data []techniqueInfo, describe bool) {
+	fmt.Fprintf(out, "## %s – %s\n\n", mdEscape(mitExt), mdEscape(mitName))
+	fmt.Fprintf(out, "- **Mitigation ID:** %s\n", mdEscape(mitExt))
+	fmt.Fprintf(out, "- **Mitigation name:** %s\n", mdEscape(mitName))
+	fmt.Fprintf(out, "- **Techniques:** %d\n", len(data))
+	fmt.Fprintf(out, "- **Data:** %s\n\n", mdEscape(bundleRelease.String()))
+
+	header := []string{"Technique ID", "Technique Name", "Tactics", "Platforms"}
+	if multiDomain() {
+		header = append(header, "Domain")
+	}
+	if describe {
+		header = append(header, "Description")
+	}
+	fmt.Fprintf(out, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(out, "|%s\n", strings.Repeat("---|", len(header)))
+	for _, t := range data {
+		id := mdEscape(t.ExternalID)
+		if t.URL != "" {
+			id = fmt.Sprintf("[%s](%s)", id, t.URL)
+		}
+		fmt.Fprintf(out, "| %s | %s | %s | %s |", id, mdEscape(t.Name), mdEscape(tacticLabels(t.Tactics)), mdEscape(strings.Join(t.Platforms, ", ")))
+		if multiDomain() {
+			fmt.Fprintf(out, " %s |", mdEscape(t.Domain))
+		}
+		if describe {
+			fmt.Fprintf(out, " %s |", mdEscape(displayDescription(t.Description)))
+		}
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintln(out)
+}
+
+/*
+-------------------------------------------------------------
+Summary counts (-count)
+-------------------------------------------------------------
+*/
+
+type countSummary struct {
+	MitigationID   string         `json:"mitigation_id"`
+	MitigationName string         `json:"mitigation_name"`
+	Total          int            `json:"total"`
+	Subtechniques  int            `json:"subtechniques"`
+	Tactics        map[string]int `json:"tactics"`
+	Orphaned       int            `json:"orphaned_relationships,omitempty"` // mitigates edges to unknown objects
+	Release        attackRelease  `json:"attack_release"`
+	Warnings       []string       `json:"warnings,omitempty"`       // dropped and orphaned relationships
+	ParseWarnings  []string       `json:"parse_warnings,omitempty"` // skipped bundle objects
+	Database       *countDatabase `json:"database,omitempty"`       // nil without a connection
+}
+
+// countDatabase is what -count found in Nebula: a cheap drift indicator.
+type countDatabase struct {
+	TechniquesPresent int `json:"techniques_present"`
+	TechniquesMissing int `json:"techniques_missing"`
+	MitigatesEdges    int `json:"mitigates_edges"`
+	StaleEdges        int `json:"stale_edges"` // edges to techniques ATT&CK no longer lists
+}
+
+// countFromDatabase fills in countDatabase for the mitigation's techniques.
+func countFromDatabase(session *nebula.Session, g graphNames, mitigationID string, data []techniqueInfo) (*countDatabase, error) {
+	ids := make([]string, len(data))
+	for i, t := range data {
+		ids[i] = t.ExternalID
+	}
+	missing, err := findMissingTechniques(session, g, ids)
+	if err != nil {
+		return nil, err
+	}
+	mitigated, err := findMitigatedTechniques(session, g, mitigationID)
+	if err != nil {
+		return nil, err
+	}
+	_, _, stale := diffMitigates(data, mitigated)
+	return &countDatabase{
+		TechniquesPresent: len(ids) - len(missing),
+		TechniquesMissing: len(missing),
+		MitigatesEdges:    len(mitigated),
+		StaleEdges:        len(stale),
+	}, nil
+}
+
+func summarize(mitExt, mitName string, data []techniqueInfo) countSummary {
+	sum := countSummary{
+		MitigationID:   mitExt,
+		MitigationName: mitName,
+		Total:          len(data),
+		Tactics:        make(map[string]int),
+		Release:        bundleRelease,
+	}
+	for _, t := range data {
+		if isSubtechnique(t.ExternalID) {
+			sum.Subtechniques++
+		}
+		for _, tactic := range t.Tactics {
+			sum.Tactics[tactic]++
+		}
+	}
+	return sum
+}
+
+// printCount renders the summary with a per-tactic histogram, largest first.
+func printCount(out io.Writer, sum countSummary) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MITIGATION\t%s (%s)\n", sum.MitigationName, sum.MitigationID)
+	fmt.Fprintf(w, "TECHNIQUES\t%d\n", sum.Total)
+	fmt.Fprintf(w, "SUB-TECHNIQUES\t%d\n", sum.Subtechniques)
+	fmt.Fprintf(w, "ATT&CK\t%s\n", sum.Release)
+	if sum.Orphaned > 0 {
+		fmt.Fprintf(w, "ORPHANED RELATIONSHIPS\t%d\n", sum.Orphaned)
+	}
+	if db := sum.Database; db != nil {
+		fmt.Fprintf(w, "IN NEBULA\t%d (%d missing)\n", db.TechniquesPresent, db.TechniquesMissing)
+		fmt.Fprintf(w, "MITIGATES EDGES\t%d (%d stale)\n", db.MitigatesEdges, db.StaleEdges)
+	}
+	fmt.Fprintln(w, "---------------------------------------------------------------")
+	printHistogram(w, sum.Tactics)
+	_ = w.Flush()
+}
+
+// printHistogram writes one "key count ####" row per key, largest first and
+// by name among equals.
+func printHistogram(w io.Writer, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", k, counts[k], strings.Repeat("#", counts[k]))
+	}
+}
+
+/*
+-------------------------------------------------------------
+Platform breakdown (-platforms-summary)
+-------------------------------------------------------------
+*/
+
+// noPlatform counts techniques whose x_mitre_platforms is empty.
+const noPlatform = "(none)"
+
+// platformCounts tallies techniques per platform; a technique counts once
+// for each platform it lists.
+func platformCounts(data []techniqueInfo) map[string]int {
+	counts := make(map[string]int)
+	for _, t := range data {
+		if len(t.Platforms) == 0 {
+			counts[noPlatform]++
+		}
+		for _, p := range t.Platforms {
+			counts[p]++
+		}
+	}
+	return counts
+}
+
+func printPlatformsSummary(out io.Writer, mitExt, mitName string, total int, counts map[string]int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MITIGATION\t%s (%s)\n", mitName, mitExt)
+	fmt.Fprintf(w, "TECHNIQUES\t%d\n", total)
+	fmt.Fprintln(w, "---------------------------------------------------------------")
+	printHistogram(w, counts)
+	_ = w.Flush()
+}
+
+/*
+-------------------------------------------------------------
+JSON Lines output (-jsonl)
+-------------------------------------------------------------
+*/
+
+// jsonlRecord carries the mitigation on every line so each one stands alone.
+type jsonlRecord struct {
+	MitigationID   string `json:"mitigation_id"`
+	MitigationName string `json:"mitigation_name"`
+	techniqueInfo
+}
+
+// printJSONL writes one compact record per technique and flushes after each
+// line so `tail -f`-style consumers see records as they are produced.
+func printJSONL(out io.Writer, mitExt, mitName string, data []techniqueInfo, full, describe bool) error {
+	bw := bufio.NewWriter(out)
+	enc := json.NewEncoder(bw)
+	for _, t := range data {
+		if !full {
+			t = t.brief(describe)
+		}
+		if err := enc.Encode(jsonlRecord{MitigationID: mitExt, MitigationName: mitName, techniqueInfo: t}); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+-------------------------------------------------------------
+Mitigation listing (-list-mitigations)
+-------------------------------------------------------------
+*/
+
+type mitigationEntry struct {
+	ExternalID  string `json:"external_id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// listableMitigations returns the mitigations sorted by external ID, leaving
+// out revoked/deprecated ones unless includeRevoked is set.
+func listableMitigations(mitMap map[string]courseOfAction, includeRevoked bool) []mitigationEntry {
+	var list []mitigationEntry
+	for _, co := range mitMap {
+		if (co.Revoked || co.Deprecated) && !includeRevoked {
+			continue
+		}
+		ext, ok := externalID(co.ExternalRefs)
+		if !ok {
+			continue
+		}
+		list = append(list, mitigationEntry{ExternalID: ext, Name: co.Name, Description: co.Description})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ExternalID < list[j].ExternalID })
+	return list
+}
+
+func listMitigationsTable(out io.Writer, mitMap map[string]courseOfAction, includeRevoked bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MITIGATION ID\tNAME")
+	for _, m := range listableMitigations(mitMap, includeRevoked) {
+		fmt.Fprintf(w, "%s\t%s\n", m.ExternalID, m.Name)
+	}
+	return w.Flush()
+}
+
+func listMitigationsJSON(out io.Writer, mitMap map[string]courseOfAction, includeRevoked bool) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(listableMitigations(mitMap, includeRevoked))
+}
+
+func listMitigationsCSV(out io.Writer, mitMap map[string]courseOfAction, includeRevoked bool) error {
+	w := csv.NewWriter(out)
+	_ = w.Write([]string{"Mitigation ID", "Mitigation Name", "Description"})
+	for _, m := range listableMitigations(mitMap, includeRevoked) {
+		_ = w.Write([]string{m.ExternalID, m.Name, m.Description})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+/*
+-------------------------------------------------------------
+Keyword search (-search)
+-------------------------------------------------------------
+*/
+
+type searchMatch struct {
+	Type       string `json:"type"` // "technique" or "mitigation"
+	ExternalID string `json:"external_id"`
+	Name       string `json:"name"`
+	Field      string `json:"matched_in"` // "name" or "description"
+}
+
+// searchObjects does a case-insensitive substring search over technique and
+// mitigation names (and descriptions when inDesc is set). Mitigations come
+// first, each group sorted by ID.
+func searchObjects(mitMap map[string]courseOfAction, techMap map[string]attackPattern, query string, inDesc, includeRevoked bool) []searchMatch {
+	q := strings.ToLower(strings.TrimSpace(query))
+	field := func(name, desc string) string {
+		switch {
+		case strings.Contains(strings.ToLower(name), q):
+			return "name"
+		case inDesc && strings.Contains(strings.ToLower(desc), q):
+			return "description"
+		}
+		return ""
+	}
+
+	var matches []searchMatch
+	for _, co := range mitMap {
+		if (co.Revoked || co.Deprecated) && !includeRevoked {
+			continue
+		}
+		if f := field(co.Name, co.Description); f != "" {
+			ext, _ := externalID(co.ExternalRefs)
+			matches = append(matches, searchMatch{Type: "mitigation", ExternalID: ext, Name: co.Name, Field: f})
+		}
+	}
+	for _, ap := range techMap {
+		if (ap.Revoked || ap.Deprecated) && !includeRevoked {
+			continue
+		}
+		if f := field(ap.Name, ap.Description); f != "" {
+			ext, _ := externalID(ap.ExternalRefs)
+			matches = append(matches, searchMatch{Type: "technique", ExternalID: ext, Name: ap.Name, Field: f})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Type != matches[j].Type {
+			return matches[i].Type == "mitigation"
+		}
+		return matches[i].ExternalID < matches[j].ExternalID
+	})
+	return matches
+}
+
+/*
+-------------------------------------------------------------
+Grouping by tactic (-group-by tactic)
+-------------------------------------------------------------
+*/
+
+// tacticGroup is one section of -group-by tactic output.
+type tacticGroup struct {
+	Tactic     string
+	Techniques []techniqueInfo
+}
+
+const uncategorized = "uncategorized"
+
+// groupByTactic splits data into one group per tactic in matrix order. A
+// technique appears under every tactic it belongs to. Phases that are
+// neither in the matrix nor in the bundle's tactic list, and techniques
+// without any phase, end up in a trailing "uncategorized" group. Order
+// inside a group follows data.
+func groupByTactic(data []techniqueInfo) []tacticGroup {
+	byPhase := make(map[string][]techniqueInfo)
+	var other []string // known to the bundle but not in tacticOrder
+	var rest []techniqueInfo
+	for _, t := range data {
+		placed := false
+		for _, phase := range t.Tactics {
+			if tacticRank(phase) == len(tacticOrder) {
+				if _, ok := tacticPhaseToID[phase]; !ok {
+					continue
+				}
+				if _, seen := byPhase[phase]; !seen {
+					other = append(other, phase)
+				}
+			}
+			byPhase[phase] = append(byPhase[phase], t)
+			placed = true
+		}
+		if !placed {
+			rest = append(rest, t)
+		}
+	}
+	sort.Strings(other)
+
+	var groups []tacticGroup
+	for _, phase := range append(append([]string{}, tacticOrder...), other...) {
+		if ts := byPhase[phase]; len(ts) > 0 {
+			groups = append(groups, tacticGroup{Tactic: phase, Techniques: ts})
+		}
+	}
+	if len(rest) > 0 {
+		groups = append(groups, tacticGroup{Tactic: uncategorized, Techniques: rest})
+	}
+	return groups
+}
+
+// printGroupedTable renders one section per tactic with its count.
+func printGroupedTable(out io.Writer, mit courseOfAction, groups []tacticGroup, totalMitigations int, pal palette, banner, detections, describe bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	if banner {
+		printTableBanner(w, mit, totalMitigations, pal)
+	}
+
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		title := strings.ToUpper(tacticName(g.Tactic))
+		if id, ok := tacticPhaseToID[g.Tactic]; ok {
+			title += " (" + id + ")"
+		}
+		fmt.Fprintf(w, "%s – %d technique(s)\n", pal.bold(pal.yellow(title)), len(g.Techniques))
+		for _, t := range g.Techniques {
+			id, name := pal.cyan(t.ExternalID), pal.plain(t.displayName())
+			if isSubtechnique(t.ExternalID) {
+				id, name = pal.dim(t.ExternalID), pal.dim(t.displayName())
+			}
+			cells := []string{id, name, strings.Join(t.Platforms, ", ")}
+			if multiDomain() {
+				cells = append(cells, t.Domain)
+			}
+			if detections {
+				cells = append(cells, strings.Join(t.DataSources, ", "))
+			}
+			if describe {
+				cells = append(cells, firstSentence(t.Description))
+			}
+			for j := 2; j < len(cells)-1; j++ {
+				cells[j] = pal.plain(cells[j])
+			}
+			fmt.Fprintln(w, "  "+strings.Join(cells, "\t"))
+		}
+	}
+	_ = w.Flush()
+}
+
+// groupedJSON encodes groups as one object keyed by tactic, keeping the
+// matrix order of the keys (a Go map would sort them).
+type groupedJSON []tacticGroup
+
+func (g groupedJSON) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, grp := range g {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(grp.Tactic)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(grp.Techniques)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
 }
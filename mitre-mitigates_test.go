@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests when runMain re-executes the test
+// binary.
+func TestMain(m *testing.M) {
+	if os.Getenv("MITREMIT_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the command line args in a child process, offline and with
+// an empty cache, and returns its stdout and stderr. The run must succeed.
+func runMain(t *testing.T, args ...string) (stdout, stderr []byte) {
+	t.Helper()
+	stdout, stderr, code := runMainExit(t, args...)
+	if code != 0 {
+		t.Fatalf("mitremit %s: exit status %d\n%s", strings.Join(args, " "), code, stderr)
+	}
+	return stdout, stderr
+}
+
+// runMainExit is runMain for runs that may fail, with their exit status.
+func runMainExit(t *testing.T, args ...string) (stdout, stderr []byte, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "MITREMIT_TEST_MAIN=1", "MITRE_OFFLINE=1", "MITRE_CACHE_DIR="+t.TempDir(), "NO_COLOR=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("mitremit %s: %v", strings.Join(args, " "), err)
+	}
+	return out.Bytes(), errOut.Bytes(), code
+}
+
+func TestDebugJSONStdout(t *testing.T) {
+	for _, format := range []string{"-json", "-format=json"} {
+		stdout, stderr := runMain(t, "-debug", format, "-bundle-path", fixture("enterprise-attack-2.1.json"), "-mitigation", "M1026")
+		if !bytes.Contains(stderr, []byte(">>> ")) {
+			t.Errorf("%s: no debug output on stderr", format)
+		}
+		if bytes.Contains(stdout, []byte(">>>")) {
+			t.Errorf("%s: debug output on stdout:\n%s", format, stdout)
+		}
+		var v any
+		if err := json.Unmarshal(stdout, &v); err != nil {
+			t.Errorf("%s: stdout is not JSON: %v\n%s", format, err, stdout)
+		}
+	}
+}
+
+func TestTacticMapFromBundle(t *testing.T) {
+	data := parseFixture(t, "enterprise-attack-2.1.json")
+	got := tacticMapFromBundle(data.Tactics)
+	if !reflect.DeepEqual(got, staticTacticPhaseToID) {
+		t.Errorf("tacticMapFromBundle\n got %v\nwant %v", got, staticTacticPhaseToID)
+	}
+	if names := tacticNamesFromBundle(data.Tactics); names["command-and-control"] != "Command and Control" {
+		t.Errorf("command-and-control is named %q", names["command-and-control"])
+	}
+}
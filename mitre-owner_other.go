@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+// mitre-owner_other.go
+//
+// No uid to compare: on Windows the temp dir is already per user.
+// --------------------------------------------------------------
+
+package main
+
+import "os"
+
+func ownedByUser(info os.FileInfo) bool { return true }
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+// mitre-owner_unix.go
+//
+// File ownership for the temp cache directory check.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser reports whether info is of a file owned by this process's user.
+func ownedByUser(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
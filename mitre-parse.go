@@ -0,0 +1,437 @@
+// mitre-parse.go
+//
+// Single-pass bundle parsing. The `objects` array is streamed with a
+// json.Decoder; each element's "type" is probed from its first keys (MITRE
+// writes "type" first, so the probe usually stops after one token) and the
+// object is then decoded exactly once into its concrete struct.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// attackData holds the lookup maps built from one bundle.
+type attackData struct {
+	SpecVersion   string                    // bundle-level spec_version ("" for STIX 2.1)
+	ObjectSpec    string                    // spec_version of the first objects, see stixVersion
+	Release       attackRelease             // from the x-mitre-collection, see release
+	NewestObject  string                    // latest "modified" of any mitigation, technique or relationship
+	Mitigations   map[string]courseOfAction // key = STIX ID
+	Techniques    map[string]attackPattern  // key = STIX ID
+	Relationships []relationship
+	Tactics       []xMitreTactic
+	DataSources   map[string]xMitreDataSource    // key = STIX ID
+	Components    map[string]xMitreDataComponent // key = STIX ID
+	RevokedBy     map[string]string              // revoked STIX ID -> replacement STIX ID
+	Raw           map[string]json.RawMessage     // verbatim objects, only with keepRaw
+	Objects       int                            // number of objects seen
+	Skipped       map[string]int                 // type -> objects that failed to decode
+	SkipSamples   []skippedObject                // the first maxSkipSamples of them
+
+	// External ID (upper case) -> STIX ID, built by index once the
+	// bundles are loaded
+	MitigationByExt map[string]string
+	TechniqueByExt  map[string]string
+}
+
+// skippedObject is a bundle object add could not use.
+type skippedObject struct {
+	Type string
+	ID   string
+	Err  string
+}
+
+// maxSkipSamples bounds the skipped objects reported one by one.
+const maxSkipSamples = 5
+
+// parseBundle streams a STIX bundle from r. keepRaw retains the verbatim JSON
+// of mitigations, techniques and relationships (needed by -stix). progress,
+// if non-nil, is called after every object with the count so far and the
+// decoder's byte offset.
+func parseBundle(r io.Reader, keepRaw bool, progress func(objects int, offset int64)) (*attackData, error) {
+	data := newAttackData(keepRaw)
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, fmt.Errorf("bundle: %w", err)
+	}
+
+	sawObjects := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("bundle: %w", err)
+		}
+		key, _ := tok.(string)
+
+		switch key {
+		case "spec_version":
+			if err := dec.Decode(&data.SpecVersion); err != nil {
+				return nil, fmt.Errorf("bundle spec_version: %w", err)
+			}
+		case "objects":
+			sawObjects = true
+			if err := expectDelim(dec, '['); err != nil {
+				return nil, fmt.Errorf("bundle objects: %w", err)
+			}
+			for dec.More() {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return nil, fmt.Errorf("bundle object %d: %w", data.Objects, err)
+				}
+				data.Objects++
+				data.add(raw, keepRaw)
+				if data.ObjectSpec == "" && data.Objects <= specProbeObjects {
+					data.ObjectSpec = probeString(raw, "spec_version")
+				}
+				if progress != nil {
+					progress(data.Objects, dec.InputOffset())
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return nil, fmt.Errorf("bundle objects: %w", err)
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, fmt.Errorf("bundle %s: %w", key, err)
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, fmt.Errorf("bundle: %w", err)
+	}
+	if !sawObjects {
+		return nil, fmt.Errorf("bundle has no objects array")
+	}
+	return data, nil
+}
+
+// add decodes one object into the matching map. Objects of types we don't
+// use are ignored; malformed ones of types we do are counted by skip.
+func (d *attackData) add(raw json.RawMessage, keepRaw bool) {
+	typ := probeType(raw)
+	var err error
+	switch typ {
+	case "":
+		err = fmt.Errorf("not an object with a \"type\"")
+	case "course-of-action":
+		var co courseOfAction
+		if err = json.Unmarshal(raw, &co); err == nil && co.ID == "" {
+			err = errNoID
+		}
+		if err == nil {
+			d.noteModified(co.Modified)
+			d.Mitigations[co.ID] = co
+			d.keep(co.ID, raw, keepRaw)
+		}
+	case "attack-pattern":
+		var ap attackPattern
+		if err = json.Unmarshal(raw, &ap); err == nil && ap.ID == "" {
+			err = errNoID
+		}
+		if err == nil {
+			d.noteModified(ap.Modified)
+			d.Techniques[ap.ID] = ap
+			d.keep(ap.ID, raw, keepRaw)
+		}
+	case "relationship":
+		var r relationship
+		if err = json.Unmarshal(raw, &r); err == nil && r.ID == "" {
+			err = errNoID
+		}
+		if err == nil {
+			d.noteModified(r.Modified)
+			if r.RelationshipType == "revoked-by" {
+				d.RevokedBy[r.SourceRef] = r.TargetRef
+			}
+			d.Relationships = append(d.Relationships, r)
+			d.keep(r.ID, raw, keepRaw)
+		}
+	case "x-mitre-tactic":
+		var t xMitreTactic
+		if err = json.Unmarshal(raw, &t); err == nil {
+			d.Tactics = append(d.Tactics, t)
+		}
+	case "x-mitre-collection":
+		var c struct {
+			Name     string `json:"name"`
+			Version  string `json:"x_mitre_version"`
+			Modified string `json:"modified"`
+		}
+		if err = json.Unmarshal(raw, &c); err == nil && d.Release.Version == "" {
+			d.Release = attackRelease{Name: c.Name, Version: c.Version, Modified: c.Modified}
+		}
+	case "x-mitre-data-source":
+		var s xMitreDataSource
+		if err = json.Unmarshal(raw, &s); err == nil {
+			d.DataSources[s.ID] = s
+		}
+	case "x-mitre-data-component":
+		var c xMitreDataComponent
+		if err = json.Unmarshal(raw, &c); err == nil {
+			d.Components[c.ID] = c
+		}
+	}
+	if err != nil {
+		d.skip(typ, raw, err)
+	}
+}
+
+var errNoID = fmt.Errorf("no \"id\"")
+
+// skip records an object add could not use. The ID is read on its own so
+// it is known even when the rest of the object doesn't decode.
+func (d *attackData) skip(typ string, raw json.RawMessage, err error) {
+	if typ == "" {
+		typ = "(untyped)"
+	}
+	d.Skipped[typ]++
+	if len(d.SkipSamples) < maxSkipSamples {
+		var probe struct {
+			ID any `json:"id"`
+		}
+		_ = json.Unmarshal(raw, &probe)
+		id, _ := probe.ID.(string)
+		d.SkipSamples = append(d.SkipSamples, skippedObject{Type: typ, ID: id, Err: err.Error()})
+	}
+}
+
+// skipCount is the number of skipped objects.
+func (d *attackData) skipCount() int {
+	n := 0
+	for _, c := range d.Skipped {
+		n += c
+	}
+	return n
+}
+
+// skipWarnings describes the skipped objects: a per-type summary, then the
+// sampled objects. Empty when nothing was skipped.
+func (d *attackData) skipWarnings() []string {
+	n := d.skipCount()
+	if n == 0 {
+		return nil
+	}
+	types := make([]string, 0, len(d.Skipped))
+	for typ := range d.Skipped {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for i, typ := range types {
+		types[i] = fmt.Sprintf("%s %d", typ, d.Skipped[typ])
+	}
+	out := []string{fmt.Sprintf("skipped %d malformed bundle object(s): %s", n, strings.Join(types, ", "))}
+	for _, o := range d.SkipSamples {
+		id := o.ID
+		if id == "" {
+			id = "without id"
+		}
+		out = append(out, fmt.Sprintf("skipped %s %s: %s", o.Type, id, o.Err))
+	}
+	if n > len(d.SkipSamples) {
+		out = append(out, fmt.Sprintf("... and %d more", n-len(d.SkipSamples)))
+	}
+	return out
+}
+
+// specProbeObjects is how many objects parseBundle looks at for a
+// spec_version: 2.1 has it on every object, so the first one does, and a
+// bundle without it shouldn't cost a probe per object.
+const specProbeObjects = 10
+
+// stixVersion is the detected STIX version: 2.0 bundles state it on the
+// bundle, 2.1 bundles only on their objects, and some 2.0 mirrors nowhere
+// ("unstated"). Both parse the same way; unknown fields such as
+// created_by_ref and object_marking_refs are ignored.
+func (d *attackData) stixVersion() string {
+	switch {
+	case d.SpecVersion != "":
+		return d.SpecVersion
+	case d.ObjectSpec != "":
+		return d.ObjectSpec
+	}
+	return "unstated"
+}
+
+func (d *attackData) noteModified(ts string) {
+	if modifiedAfter(ts, d.NewestObject) {
+		d.NewestObject = ts
+	}
+}
+
+// release is the collection's release, or an estimate from the newest
+// object when the bundle has no x-mitre-collection.
+func (d *attackData) release() attackRelease {
+	if d.Release.Version != "" {
+		return d.Release
+	}
+	return attackRelease{Modified: d.NewestObject, Estimated: true}
+}
+
+// index builds the external-ID lookups. When several objects share an ID
+// (a revoked copy next to the live one) the live one wins, then the lowest
+// STIX ID, so the result doesn't depend on map order.
+func (d *attackData) index() {
+	d.MitigationByExt = make(map[string]string, len(d.Mitigations))
+	for id, co := range d.Mitigations {
+		indexExternalID(d.MitigationByExt, co.ExternalRefs, id, co.Revoked || co.Deprecated, func(other string) bool {
+			return d.Mitigations[other].Revoked || d.Mitigations[other].Deprecated
+		})
+	}
+	d.TechniqueByExt = make(map[string]string, len(d.Techniques))
+	for id, ap := range d.Techniques {
+		indexExternalID(d.TechniqueByExt, ap.ExternalRefs, id, ap.Revoked || ap.Deprecated, func(other string) bool {
+			return d.Techniques[other].Revoked || d.Techniques[other].Deprecated
+		})
+	}
+}
+
+func indexExternalID(idx map[string]string, refs []externalReference, id string, dead bool, otherDead func(string) bool) {
+	ext, ok := externalID(refs)
+	if !ok {
+		return
+	}
+	key := strings.ToUpper(ext)
+	if other, dup := idx[key]; dup {
+		if od := otherDead(other); od == dead && other < id || !od && dead {
+			return
+		}
+	}
+	idx[key] = id
+}
+
+// mitigationByExternalID looks up a mitigation by its ATT&CK ID (M1037),
+// ignoring case.
+func (d *attackData) mitigationByExternalID(ext string) (string, bool) {
+	id, ok := d.MitigationByExt[strings.ToUpper(strings.TrimSpace(ext))]
+	return id, ok
+}
+
+// techniqueByExternalID looks up a technique by its ATT&CK ID (T1059.001),
+// ignoring case.
+func (d *attackData) techniqueByExternalID(ext string) (attackPattern, bool) {
+	id, ok := d.TechniqueByExt[strings.ToUpper(strings.TrimSpace(ext))]
+	return d.Techniques[id], ok
+}
+
+// droppedRelationship is a mitigates relationship resolveMitigates left out.
+type droppedRelationship struct {
+	Relationship relationship
+	Reason       string
+}
+
+// resolveMitigates splits the mitigates relationships into the ones that can
+// become edges and the ones that can't: the relationship itself revoked or
+// deprecated, its mitigation missing, revoked or deprecated, or its technique
+// deprecated. Missing techniques (orphans) and revoked ones (followed
+// through revoked-by) are left to the collection step, which reports or
+// resolves them.
+func (d *attackData) resolveMitigates() (kept []relationship, dropped []droppedRelationship) {
+	for _, r := range d.Relationships {
+		if r.RelationshipType != "mitigates" {
+			continue
+		}
+		reason := ""
+		co, haveSource := d.Mitigations[r.SourceRef]
+		ap, haveTarget := d.Techniques[r.TargetRef]
+		switch {
+		case r.Revoked:
+			reason = "relationship revoked"
+		case r.Deprecated:
+			reason = "relationship deprecated"
+		case !haveSource:
+			reason = "mitigation " + r.SourceRef + " not in the bundle"
+		case co.Revoked:
+			reason = "mitigation revoked"
+		case co.Deprecated:
+			reason = "mitigation deprecated"
+		case haveTarget && ap.Deprecated && !ap.Revoked:
+			reason = "technique deprecated"
+		}
+		if reason != "" {
+			dropped = append(dropped, droppedRelationship{r, reason})
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, dropped
+}
+
+// detectedBy maps technique STIX IDs to the "Data Source: Component" labels
+// of the components that detect them, as the ATT&CK site writes them.
+func (d *attackData) detectedBy() map[string][]string {
+	out := make(map[string][]string)
+	for _, r := range d.Relationships {
+		if r.RelationshipType != "detects" || r.Revoked || r.Deprecated {
+			continue
+		}
+		c, ok := d.Components[r.SourceRef]
+		if !ok {
+			continue
+		}
+		label := c.Name
+		if s, ok := d.DataSources[c.SourceRef]; ok {
+			label = s.Name + ": " + c.Name
+		}
+		out[r.TargetRef] = append(out[r.TargetRef], label)
+	}
+	return out
+}
+
+func (d *attackData) keep(id string, raw json.RawMessage, keepRaw bool) {
+	if keepRaw {
+		d.Raw[id] = raw
+	}
+}
+
+// probeType returns the top-level "type" of a JSON object, reading only as
+// far as that key.
+func probeType(raw []byte) string {
+	return probeString(raw, "type")
+}
+
+// probeString returns the top-level string key of a JSON object, reading
+// only as far as that key; "" if it is missing or not a string.
+func probeString(raw []byte, key string) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if expectDelim(dec, '{') != nil {
+		return ""
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if tok == key {
+			var v string
+			if dec.Decode(&v) != nil {
+				return ""
+			}
+			return v
+		}
+		var skip json.RawMessage
+		if dec.Decode(&skip) != nil {
+			return ""
+		}
+	}
+	return ""
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSTIXVersions(t *testing.T) {
+	swap(t, &verbosity, levelError)
+	results := map[string][]techniqueInfo{}
+	for _, tt := range []struct{ file, want string }{
+		{"enterprise-attack-2.0.json", "2.0"},
+		{"enterprise-attack-2.1.json", "2.1"},
+	} {
+		raw := readFixture(t, tt.file)
+		if err := validateBundle(raw, tt.file); err != nil {
+			t.Fatal(err)
+		}
+		data := parseFixture(t, tt.file)
+		if got := data.stixVersion(); got != tt.want {
+			t.Errorf("%s: STIX %s, want %s", tt.file, got, tt.want)
+		}
+		data.index()
+		mitigates, _ := data.resolveMitigates()
+		mit, _ := data.mitigationByExternalID("M1026")
+		techniques, _, _ := collectTechniques(data, mitigates, mit, "", nil, func(string, ...any) {})
+		results[tt.want] = techniques
+	}
+	if len(results["2.1"]) != 3 || !reflect.DeepEqual(results["2.0"], results["2.1"]) {
+		t.Errorf("M1026 techniques differ:\n2.0 %+v\n2.1 %+v", results["2.0"], results["2.1"])
+	}
+
+	// A 2.0 mirror that dropped the bundle's spec_version states it nowhere
+	raw := bytes.Replace(readFixture(t, "enterprise-attack-2.0.json"), []byte(`"spec_version": "2.0",`), nil, 1)
+	data, err := parseBundle(bytes.NewReader(raw), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data.stixVersion(); got != "unstated" {
+		t.Errorf("no spec_version: STIX %s, want unstated", got)
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	data := parseFixture(t, "enterprise-attack-2.1.json")
+	if data.Objects != 128 || len(data.Techniques) != 9 || len(data.Mitigations) != 5 || len(data.Tactics) != 14 {
+		t.Errorf("got %d objects, %d techniques, %d mitigations, %d tactics",
+			data.Objects, len(data.Techniques), len(data.Mitigations), len(data.Tactics))
+	}
+	if data.Release.Version != "16.1" {
+		t.Errorf("release %q, want 16.1", data.Release.Version)
+	}
+	if n := data.skipCount(); n != 0 {
+		t.Errorf("skipped %d objects: %v", n, data.skipWarnings())
+	}
+}
+
+// linearMitigation is what the external-ID index replaced: a scan of every
+// mitigation, with the same tie-break (live before dead, then lowest STIX ID).
+func linearMitigation(d *attackData, ext string) (string, bool) {
+	best := ""
+	for id, co := range d.Mitigations {
+		e, ok := externalID(co.ExternalRefs)
+		if !ok || !strings.EqualFold(e, strings.TrimSpace(ext)) {
+			continue
+		}
+		if best == "" || betterIndexed(id, co.Revoked || co.Deprecated, best, d.Mitigations[best].Revoked || d.Mitigations[best].Deprecated) {
+			best = id
+		}
+	}
+	return best, best != ""
+}
+
+func linearTechnique(d *attackData, ext string) (string, bool) {
+	best := ""
+	for id, ap := range d.Techniques {
+		e, ok := externalID(ap.ExternalRefs)
+		if !ok || !strings.EqualFold(e, strings.TrimSpace(ext)) {
+			continue
+		}
+		if best == "" || betterIndexed(id, ap.Revoked || ap.Deprecated, best, d.Techniques[best].Revoked || d.Techniques[best].Deprecated) {
+			best = id
+		}
+	}
+	return best, best != ""
+}
+
+func betterIndexed(id string, dead bool, other string, otherDead bool) bool {
+	if dead != otherDead {
+		return !dead
+	}
+	return id < other
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	data := parseFixture(t, "enterprise-attack-2.1.json")
+	data.index()
+
+	tests := []struct {
+		ext  string
+		want string // STIX ID, "" for not found
+	}{
+		{"M1026", "course-of-action--9bb9e696-bff8-4ae1-9454-961fc7d91d5f"},
+		{" m1026 ", "course-of-action--9bb9e696-bff8-4ae1-9454-961fc7d91d5f"},
+		// live copy next to a revoked one with a lower STIX ID
+		{"M1037", "course-of-action--86598de0-b347-4928-9eb0-0acbfc21908c"},
+		// only copy, deprecated
+		{"M1042", "course-of-action--eb88d97c-32f1-40be-80f0-d61a4b0b4b31"},
+		{"M9999", ""},
+		{"T1059.001", "attack-pattern--970a3432-3237-47ad-bcca-7d8cbb217736"},
+		// live copy with the highest of three STIX IDs
+		{"T1003", "attack-pattern--e0e0e0e0-5b6e-4d4e-9d4a-0ca4a2f8e0e0"},
+		{"t1003", "attack-pattern--e0e0e0e0-5b6e-4d4e-9d4a-0ca4a2f8e0e0"},
+		// revoked and deprecated copies only: the lowest STIX ID
+		{"T1086", "attack-pattern--2c2c2c2c-0a44-4bdb-a9a3-2c2c2c2c2c2c"},
+		{"T9999", ""},
+	}
+	for _, tt := range tests {
+		var got, linear string
+		var ok, linearOK bool
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(tt.ext)), "M") {
+			got, ok = data.mitigationByExternalID(tt.ext)
+			linear, linearOK = linearMitigation(data, tt.ext)
+		} else {
+			var ap attackPattern
+			ap, ok = data.techniqueByExternalID(tt.ext)
+			got = ap.ID
+			linear, linearOK = linearTechnique(data, tt.ext)
+		}
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%q: index gives %q, %v; want %q", tt.ext, got, ok, tt.want)
+		}
+		if got != linear || ok != linearOK {
+			t.Errorf("%q: index gives %q, linear scan %q", tt.ext, got, linear)
+		}
+	}
+
+	// Every external ID in the bundle, not just the table's
+	for _, co := range data.Mitigations {
+		if ext, ok := externalID(co.ExternalRefs); ok {
+			got, _ := data.mitigationByExternalID(ext)
+			if linear, _ := linearMitigation(data, ext); got != linear {
+				t.Errorf("%s: index gives %s, linear scan %s", ext, got, linear)
+			}
+		}
+	}
+	for _, ap := range data.Techniques {
+		if ext, ok := externalID(ap.ExternalRefs); ok {
+			got, _ := data.techniqueByExternalID(ext)
+			if linear, _ := linearTechnique(data, ext); got.ID != linear {
+				t.Errorf("%s: index gives %s, linear scan %s", ext, got.ID, linear)
+			}
+		}
+	}
+}
+
+func BenchmarkParseBundle(b *testing.B) {
+	raw, err := os.ReadFile(fixture("enterprise-attack-2.1.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, keepRaw := range []bool{false, true} {
+		name := "typed"
+		if keepRaw {
+			name = "keepRaw"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := parseBundle(bytes.NewReader(raw), keepRaw, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// mitre-progress.go
+//
+// Download progress for the bundle fetch. On a terminal stderr gets one line
+// updated in place (percentage, bytes, rate and ETA from Content-Length;
+// bytes and rate when the server sends none); otherwise a line when the
+// download starts and one when it ends, so logs show where the time went.
+// Each attempt wraps its own response body, so a retry starts again from
+// zero. -quiet (or -log-level warn and up) turns it off.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// progressInterval limits redraws of the in-place line.
+const progressInterval = 200 * time.Millisecond
+
+// downloadProgress is an io.Reader over a response body that reports how
+// much of it has been read.
+type downloadProgress struct {
+	r     io.Reader
+	name  string // last element of the URL
+	total int64  // Content-Length, -1 if unknown
+	read  int64
+	start time.Time
+	drawn time.Time
+	tty   bool
+}
+
+// newDownloadProgress wraps body; nil when progress is off.
+func newDownloadProgress(body io.Reader, rawURL string, total int64) *downloadProgress {
+	if !logEnabled(levelInfo) {
+		return nil
+	}
+	p := &downloadProgress{
+		r:     body,
+		name:  path.Base(rawURL),
+		total: total,
+		start: time.Now(),
+		tty:   isTerminal(os.Stderr),
+	}
+	p.drawn = p.start // the first rate is meaningless; wait one interval
+	if !p.tty {
+		size := "size unknown"
+		if total >= 0 {
+			size = formatBytes(total)
+		}
+		infof("downloading %s (%s)\n", rawURL, size)
+	}
+	return p
+}
+
+func (p *downloadProgress) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.tty && time.Since(p.drawn) >= progressInterval {
+		p.draw(false)
+	}
+	return n, err
+}
+
+// rate is the average transfer rate in bytes per second.
+func (p *downloadProgress) rate() float64 {
+	secs := time.Since(p.start).Seconds()
+	if secs <= 0 {
+		return 0
+	}
+	return float64(p.read) / secs
+}
+
+// draw rewrites the line; the final one has no ETA.
+func (p *downloadProgress) draw(final bool) {
+	p.drawn = time.Now()
+	rate := p.rate()
+	line := fmt.Sprintf("downloading %s: %s  %s/s", p.name, formatBytes(p.read), formatBytes(int64(rate)))
+	if p.total > 0 {
+		eta := "  ETA ?"
+		switch {
+		case final:
+			eta = ""
+		case rate > 0:
+			eta = "  ETA " + time.Duration(float64(p.total-p.read)/rate*float64(time.Second)).Round(time.Second).String()
+		}
+		line = fmt.Sprintf("downloading %s: %3d%%  %s / %s  %s/s%s", p.name,
+			p.read*100/p.total, formatBytes(p.read), formatBytes(p.total), formatBytes(int64(rate)), eta)
+	}
+	fmt.Fprintf(os.Stderr, "\r%s\x1b[K", line)
+}
+
+// done ends the report; err is the outcome of reading the body.
+func (p *downloadProgress) done(err error) {
+	if p == nil {
+		return
+	}
+	took := time.Since(p.start).Round(time.Millisecond)
+	switch {
+	case p.tty && err == nil:
+		p.draw(true)
+		fmt.Fprintf(os.Stderr, " – done in %s\n", took)
+	case p.tty:
+		fmt.Fprintln(os.Stderr) // the error is reported on its own line
+	case err == nil:
+		infof("downloaded %s (%s) in %s, %s/s\n", p.name, formatBytes(p.read), took, formatBytes(int64(p.rate())))
+	}
+}
+
+// formatBytes is n in B, KB or MB (powers of 1024).
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,105 @@
+// mitre-prometheus.go
+//
+// GET /metrics for -serve, in the Prometheus text format (client_golang):
+//
+//	mitremit_http_requests_total{endpoint,code}          requests answered
+//	mitremit_http_request_duration_seconds{endpoint}     latency histogram
+//	mitremit_bundle_reloads_total{result}                /reload, ok or error
+//	mitremit_bundle_loaded_timestamp_seconds             when the bundle went live
+//	mitremit_bundle_modified_timestamp_seconds           the ATT&CK release's "modified"
+//	mitremit_index_cache_lookups_total{result}           parsed-index hit or miss
+//
+// plus the usual go_* and process_* collectors. endpoint is the route
+// ("/mitigation/{id}"), never the raw path, so IDs don't multiply series.
+// Alert on time() - mitremit_bundle_loaded_timestamp_seconds for a bundle
+// that stopped reloading, and on the 404/5xx share of requests.
+// These are separate from -metrics-out, which records CLI runs to a file.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// indexHits and indexMisses count readIndex lookups in loadAttackData.
+var indexHits, indexMisses atomic.Int64
+
+type apiMetrics struct {
+	registry       *prometheus.Registry
+	requests       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	reloads        *prometheus.CounterVec
+	loadedAt       prometheus.Gauge
+	bundleModified prometheus.Gauge
+}
+
+func newAPIMetrics() *apiMetrics {
+	m := &apiMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mitremit_http_requests_total",
+			Help: "API requests by endpoint and status code.",
+		}, []string{"endpoint", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mitremit_http_request_duration_seconds",
+			Help:    "API request latency by endpoint.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mitremit_bundle_reloads_total",
+			Help: "POST /reload runs by result (ok, error).",
+		}, []string{"result"}),
+		loadedAt: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mitremit_bundle_loaded_timestamp_seconds",
+			Help: "Unix time the served bundle was loaded.",
+		}),
+		bundleModified: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mitremit_bundle_modified_timestamp_seconds",
+			Help: "Unix time of the served ATT&CK release (its modified date).",
+		}),
+	}
+	lookups := func(result string, n *atomic.Int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "mitremit_index_cache_lookups_total",
+			Help:        "Parsed-index lookups while loading the bundle, by result (hit, miss).",
+			ConstLabels: prometheus.Labels{"result": result},
+		}, func() float64 { return float64(n.Load()) })
+	}
+	m.registry.MustRegister(
+		m.requests, m.duration, m.reloads, m.loadedAt, m.bundleModified,
+		lookups("hit", &indexHits), lookups("miss", &indexMisses),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	for _, result := range []string{"ok", "error"} {
+		m.reloads.WithLabelValues(result) // export zeros before the first reload
+	}
+	return m
+}
+
+// instrument counts and times h under the endpoint label.
+func (m *apiMetrics) instrument(endpoint string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"endpoint": endpoint}
+	return promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), h))
+}
+
+// handler serves /metrics.
+func (m *apiMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// bundleLoaded records the bundle that just went live.
+func (m *apiMetrics) bundleLoaded(st *apiState) {
+	m.loadedAt.Set(float64(st.loadedAt.Unix()))
+	if t, err := time.Parse(time.RFC3339, st.release.Modified); err == nil {
+		m.bundleModified.Set(float64(t.Unix()))
+	}
+}
@@ -0,0 +1,150 @@
+// mitre-release.go
+//
+// The ATT&CK release a run used, from the bundle's x-mitre-collection
+// (name, x_mitre_version, modified). It is stamped into the table banner,
+// the -count summary, the nGQL header and the md/html reports so a script
+// read months later still says which data produced it. Bundles without a
+// collection object fall back to the newest "modified" timestamp.
+//
+// Runs that talk to Nebula also read the Mitre_Attack_Version values of the
+// techniques already in the graph and warn when the graph is behind.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	nebula "github.com/vesoft-inc/nebula-go/v3"
+)
+
+// attackRelease describes the ATT&CK data of this run.
+type attackRelease struct {
+	Name      string `json:"name,omitempty"`      // "Enterprise ATT&CK"
+	Version   string `json:"version,omitempty"`   // "16.1"
+	Modified  string `json:"modified,omitempty"`  // STIX timestamp
+	Estimated bool   `json:"estimated,omitempty"` // no collection: Modified is the newest object's
+	Pinned    bool   `json:"pinned,omitempty"`    // chosen with -attack-version
+}
+
+// bundleRelease is set in main once the bundles are loaded.
+var bundleRelease attackRelease
+
+// String is "Enterprise ATT&CK v16.1, released 2024-10-31", with
+// " (pinned)" under -attack-version.
+func (r attackRelease) String() string {
+	if r.Pinned {
+		r.Pinned = false
+		return r.String() + " (pinned)"
+	}
+	date := r.Modified
+	if len(date) >= len("2006-01-02") {
+		date = date[:len("2006-01-02")]
+	}
+	switch {
+	case r.Version != "":
+		name := r.Name
+		if name == "" {
+			name = "ATT&CK"
+		}
+		s := name + " v" + r.Version
+		if date != "" {
+			s += ", released " + date
+		}
+		return s
+	case date != "":
+		return "unknown ATT&CK release (no x-mitre-collection; newest object modified " + date + ")"
+	}
+	return "unknown ATT&CK release"
+}
+
+// compareVersions compares dotted versions numerically ("9.0" < "16.1").
+// Non-numeric parts compare as strings.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errX := strconv.Atoi(x)
+		ny, errY := strconv.Atoi(y)
+		switch {
+		case errX == nil && errY == nil && nx != ny:
+			if nx < ny {
+				return -1
+			}
+			return 1
+		case (errX != nil || errY != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// graphAttackVersions returns the distinct attack-version column values of
+// the given techniques in the graph.
+func graphAttackVersions(session *nebula.Session, g graphNames, techniqueIDs []string) ([]string, error) {
+	if len(techniqueIDs) == 0 || techSchema.AttackVersionColumn == "" {
+		return nil, nil
+	}
+	quoted := make([]string, len(techniqueIDs))
+	for i, id := range techniqueIDs {
+		quoted[i] = quoteID(id)
+	}
+	query := fmt.Sprintf("MATCH (t:%s) WHERE id(t) IN [%s] RETURN collect(DISTINCT toString(t.%s.%s)) AS versions;",
+		g.TechniqueTag, strings.Join(quoted, ", "), g.TechniqueTag, techSchema.AttackVersionColumn)
+	debugf("Query: %s\n", query)
+	result, err := session.Execute(query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	if !result.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", result.GetErrorMsg())
+	}
+	return collectedStrings(result)
+}
+
+// warnIfGraphBehind warns when techniques in the graph were loaded from an
+// older ATT&CK release than the bundle. Query errors only show under -debug:
+// this is advice, not a pre-flight check.
+func warnIfGraphBehind(session *nebula.Session, g graphNames, presentIDs []string) {
+	if bundleRelease.Version == "" {
+		return
+	}
+	versions, err := graphAttackVersions(session, g, presentIDs)
+	if err != nil {
+		debugf("reading %s from the graph: %v\n", techSchema.AttackVersionColumn, err)
+		return
+	}
+	var older []string
+	for _, v := range versions {
+		if v != "" && compareVersions(v, bundleRelease.Version) < 0 {
+			older = append(older, "v"+v)
+		}
+	}
+	if len(older) > 0 {
+		warnf("the graph holds techniques from ATT&CK %s; this bundle is v%s (the graph is behind)\n",
+			strings.Join(older, ", "), bundleRelease.Version)
+	}
+}
+
+// presentTechniques is all minus missing.
+func presentTechniques(all, missing []string) []string {
+	gone := make(map[string]bool, len(missing))
+	for _, id := range missing {
+		gone[id] = true
+	}
+	var out []string
+	for _, id := range all {
+		if !gone[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+// mitre-retry.go
+//
+// Retries for the bundle download. GitHub's raw host answers with the odd
+// 502 or reset connection; those, 5xx in general and 429 are tried again,
+// up to -download-retries attempts in all. The wait doubles from one second
+// with up to 50% jitter, capped at 30s; a Retry-After from the server wins
+// when it asks for longer (up to two minutes). Anything else – 404, a 304,
+// Ctrl-C – ends the loop at once. When every attempt fails the error lists
+// all of them.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	retryBaseWait = time.Second
+	retryMaxWait  = 30 * time.Second
+	retryAfterMax = 2 * time.Minute
+)
+
+// httpStatusError is a non-200 answer to the bundle download.
+type httpStatusError struct {
+	URL        string
+	Status     int
+	Msg        string        // start of the body, if any
+	RetryAfter time.Duration // 0 if the server sent none
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Msg != "" {
+		return fmt.Sprintf("bundle %s: HTTP %d: %s", e.URL, e.Status, e.Msg)
+	}
+	return fmt.Sprintf("bundle %s: HTTP %d", e.URL, e.Status)
+}
+
+// transportError is a download that failed before or while reading the
+// response: connection refused or reset, timeout, truncated body.
+type transportError struct{ err error }
+
+func (e *transportError) Error() string { return e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+// retryable reports whether another attempt may succeed.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		return se.Status >= 500 || se.Status == http.StatusTooManyRequests
+	}
+	var te *transportError
+	return errors.As(err, &te)
+}
+
+// parseRetryAfter reads delay-seconds or an HTTP date; 0 if absent or bad.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// retryWait is the pause before attempt n+1 (n from 1).
+func retryWait(n int, err error) time.Duration {
+	wait := min(retryBaseWait<<(n-1), retryMaxWait)
+	wait += time.Duration(rand.Int63n(int64(wait/2) + 1))
+	var se *httpStatusError
+	if errors.As(err, &se) && se.RetryAfter > wait {
+		wait = min(se.RetryAfter, retryAfterMax)
+	}
+	return wait
+}
+
+// downloadWithRetry is downloadBundle with retries on transient failures.
+func downloadWithRetry(bundleURL string, cond httpValidators) ([]byte, httpValidators, error) {
+	attempts := max(*flagDownloadRetries, 1)
+	var errs []error
+	for n := 1; ; n++ {
+		data, got, err := downloadBundle(bundleURL, cond)
+		if err == nil || errors.Is(err, errNotModified) {
+			return data, got, err
+		}
+		errs = append(errs, err)
+		if !retryable(err) || n == attempts {
+			if len(errs) == 1 {
+				return nil, got, err
+			}
+			return nil, got, &retriesError{errs}
+		}
+		wait := retryWait(n, err)
+		warnf("download attempt %d of %d failed: %v; retrying in %s\n", n, attempts, err, wait.Round(100*time.Millisecond))
+		if ierr := sleepInterruptible(wait, "to retry"); ierr != nil {
+			return nil, got, fmt.Errorf("%w (attempt %d failed: %v)", ierr, n, err)
+		}
+	}
+}
+
+// sleepInterruptible waits d; Ctrl-C cuts the wait short with an error
+// wrapping context.Canceled that says what was being waited for.
+func sleepInterruptible(d time.Duration, waitingFor string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("interrupted while waiting %s: %w", waitingFor, ctx.Err())
+	}
+}
+
+// retriesError is the failure of every download attempt; errors.Is and
+// errors.As see all of them.
+type retriesError struct{ errs []error }
+
+func (e *retriesError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "download failed after %d attempt(s):", len(e.errs))
+	for i, err := range e.errs {
+		fmt.Fprintf(&b, "\n  %d: %v", i+1, err)
+	}
+	return b.String()
+}
+
+func (e *retriesError) Unwrap() []error { return e.errs }
@@ -0,0 +1,436 @@
+// mitre-schema.go
+//
+// The target graph model. graphNames holds the tag and edge type names
+// (-technique-tag, -mitigates-edge, ...); techniqueSchema holds the columns
+// of the technique vertex written by -ngql/-execute. Deployments differ in
+// what else they keep on a technique vertex, so everything except the ID and
+// name columns is a configurable default (-technique-schema FILE):
+//
+//	{
+//	  "id_column":   "Technique_ID",
+//	  "name_column": "Technique_Name",
+//	  "attack_version_column":    "Mitre_Attack_Version",
+//	  "technique_version_column": "Technique_Version",
+//	  "defaults": [
+//	    {"column": "Mitre_Attack_Version", "value": "18.0"},
+//	    {"column": "rcelpe", "value": false}
+//	  ]
+//	}
+//
+// Values are JSON strings, numbers, booleans or null and are written as the
+// matching nGQL literal. Column order is kept as given. The ATT&CK release of
+// the bundle (its x-mitre-collection version) replaces the default of
+// attack_version_column; the default only applies to bundles without one.
+// technique_version_column, if set, gets each technique's x_mitre_version.
+//
+// The properties of the mitigates edge come from -mitigates-props: nGQL
+// literals in the edge type's order ('NULL,{domain}', the default) or by
+// name ('confidence=0.8,domain={domain}'). {domain} is the technique's
+// ATT&CK domain ("Enterprise"). Runs that talk to Nebula check them against
+// DESCRIBE EDGE before anything is written.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	nebula "github.com/vesoft-inc/nebula-go/v3"
+)
+
+// graphNames are the tag and edge type names used in every statement and
+// query.
+type graphNames struct {
+	TechniqueTag     string
+	MitigationTag    string
+	MitigatesEdge    string
+	SubtechniqueEdge string
+	PartOfEdge       string
+}
+
+var defaultGraphNames = graphNames{
+	TechniqueTag:     "tMitreTechnique",
+	MitigationTag:    "tMitreMitigation",
+	MitigatesEdge:    "mitigates",
+	SubtechniqueEdge: "has_subtechnique",
+	PartOfEdge:       "part_of",
+}
+
+// validate checks that every name is a plain identifier, so it can be put
+// into nGQL unquoted.
+func (g graphNames) validate() error {
+	for _, n := range []struct{ flag, value string }{
+		{"technique-tag", g.TechniqueTag},
+		{"mitigation-tag", g.MitigationTag},
+		{"mitigates-edge", g.MitigatesEdge},
+		{"subtechnique-edge", g.SubtechniqueEdge},
+		{"part-of-edge", g.PartOfEdge},
+	} {
+		if !columnNamePattern.MatchString(n.value) {
+			return fmt.Errorf("invalid -%s %q (letters, digits and _ only)", n.flag, n.value)
+		}
+	}
+	return nil
+}
+
+// verifyCountQuery counts the mitigates edges of one mitigation.
+func verifyCountQuery(g graphNames, mitigationID string) string {
+	return fmt.Sprintf(`MATCH (m:%s)-[e:%s]->(t) WHERE id(m) == "%s" RETURN COUNT(e);`, g.MitigationTag, g.MitigatesEdge, mitigationID)
+}
+
+type techniqueSchema struct {
+	IDColumn               string          `json:"id_column"`
+	NameColumn             string          `json:"name_column"`
+	AttackVersionColumn    string          `json:"attack_version_column,omitempty"`
+	TechniqueVersionColumn string          `json:"technique_version_column,omitempty"`
+	Defaults               []columnDefault `json:"defaults"`
+
+	// AttackVersion is the bundle's ATT&CK release, set once it is parsed
+	AttackVersion string `json:"-"`
+}
+
+type columnDefault struct {
+	Column string `json:"column"`
+	Value  any    `json:"value"`
+}
+
+// defaultTechniqueSchema matches the tMitreTechnique tag this tool was
+// written against.
+var defaultTechniqueSchema = techniqueSchema{
+	IDColumn:            "Technique_ID",
+	NameColumn:          "Technique_Name",
+	AttackVersionColumn: "Mitre_Attack_Version",
+	Defaults: []columnDefault{
+		{"Mitre_Attack_Version", "18.0"},
+		{"rcelpe", false},
+		{"priority", json.Number("4")},
+		{"execution_min", json.Number("0.1667")},
+		{"execution_max", json.Number("120")},
+	},
+}
+
+// techSchema is the schema in effect; main replaces it with -technique-schema.
+var techSchema = defaultTechniqueSchema
+
+var columnNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// loadTechniqueSchema reads and validates a -technique-schema file. Numbers
+// are kept as written ("0.1667" stays "0.1667").
+func loadTechniqueSchema(path string) (techniqueSchema, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return techniqueSchema{}, err
+	}
+	var s techniqueSchema
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return techniqueSchema{}, fmt.Errorf("%s: %w", path, err)
+	}
+	// Files written before attack_version_column existed still get the
+	// release in the column this tool always used for it
+	if s.AttackVersionColumn == "" {
+		for _, d := range s.Defaults {
+			if d.Column == defaultTechniqueSchema.AttackVersionColumn {
+				s.AttackVersionColumn = d.Column
+			}
+		}
+	}
+	if err := s.validate(); err != nil {
+		return techniqueSchema{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// validate checks that the ID and name columns are set, every column name is
+// a plain identifier used once, and every default has a supported type.
+func (s techniqueSchema) validate() error {
+	if s.IDColumn == "" {
+		return fmt.Errorf("id_column is required")
+	}
+	if s.NameColumn == "" {
+		return fmt.Errorf("name_column is required")
+	}
+
+	seen := make(map[string]bool)
+	columns := []string{s.IDColumn, s.NameColumn}
+	if s.TechniqueVersionColumn != "" {
+		columns = append(columns, s.TechniqueVersionColumn)
+	}
+	for _, d := range s.Defaults {
+		columns = append(columns, d.Column)
+	}
+	if s.AttackVersionColumn != "" {
+		found := false
+		for _, d := range s.Defaults {
+			found = found || d.Column == s.AttackVersionColumn
+		}
+		if !found {
+			columns = append(columns, s.AttackVersionColumn)
+		}
+	}
+	for _, c := range columns {
+		if !columnNamePattern.MatchString(c) {
+			return fmt.Errorf("invalid column name %q", c)
+		}
+		if seen[strings.ToLower(c)] {
+			return fmt.Errorf("column %s listed more than once", c)
+		}
+		seen[strings.ToLower(c)] = true
+	}
+
+	for _, d := range s.Defaults {
+		if _, err := nGQLValue(d.Value); err != nil {
+			return fmt.Errorf("column %s: %w", d.Column, err)
+		}
+	}
+	return nil
+}
+
+// values returns every column after ID and name with its value for one
+// technique: the defaults, with the ATT&CK release and the technique version
+// filled in where the schema names columns for them.
+func (s techniqueSchema) values(t techniqueInfo) []columnDefault {
+	var out []columnDefault
+	versionDone := s.AttackVersionColumn == "" || s.AttackVersion == ""
+	for _, d := range s.Defaults {
+		if d.Column == s.AttackVersionColumn && s.AttackVersion != "" {
+			d.Value = s.AttackVersion
+			versionDone = true
+		}
+		out = append(out, d)
+	}
+	if !versionDone {
+		out = append(out, columnDefault{s.AttackVersionColumn, s.AttackVersion})
+	}
+	if s.TechniqueVersionColumn != "" {
+		var v any // NULL when the technique has no x_mitre_version
+		if t.Version != "" {
+			v = t.Version
+		}
+		out = append(out, columnDefault{s.TechniqueVersionColumn, v})
+	}
+	return out
+}
+
+// insertVertex returns the INSERT VERTEX statement for one technique.
+func (s techniqueSchema) insertVertex(tag string, t techniqueInfo) string {
+	columns := []string{s.IDColumn, s.NameColumn}
+	values := []string{quoteLiteral(t.ExternalID), quoteLiteral(t.Name)}
+	for _, d := range s.values(t) {
+		v, _ := nGQLValue(d.Value) // checked by validate
+		columns = append(columns, d.Column)
+		values = append(values, v)
+	}
+	return fmt.Sprintf("INSERT VERTEX IF NOT EXISTS %s(%s) VALUES %s:(%s);",
+		tag, strings.Join(columns, ", "), quoteID(t.ExternalID), strings.Join(values, ", "))
+}
+
+// nGQLValue renders a decoded JSON value as an nGQL literal.
+func nGQLValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return quoteLiteral(v), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v (use a string, number, boolean or null)", v)
+}
+
+// domainPlaceholder in -mitigates-props becomes the technique's domain.
+const domainPlaceholder = "{domain}"
+
+// mitigatesProps are the property values of every mitigates edge.
+type mitigatesProps struct {
+	Names  []string // nil: Values are in the edge type's property order
+	Values []string // nGQL literals or domainPlaceholder
+}
+
+var defaultMitigatesProps = mitigatesProps{Values: []string{"NULL", domainPlaceholder}}
+
+// edgeProps is in effect; main replaces it with -mitigates-props.
+var edgeProps = defaultMitigatesProps
+
+// parseMitigatesProps parses -mitigates-props: comma-separated values, all
+// of them plain or all name=value. A value is NULL, true, false, a number,
+// a double-quoted string or {domain}. An empty list is an edge without
+// properties.
+func parseMitigatesProps(value string) (mitigatesProps, error) {
+	var p mitigatesProps
+	items, err := splitPropList(value)
+	if err != nil {
+		return p, fmt.Errorf("invalid -mitigates-props: %w", err)
+	}
+	for i, item := range items {
+		name, v, named := "", item, false
+		if eq := strings.Index(item, "="); eq > 0 && columnNamePattern.MatchString(strings.TrimSpace(item[:eq])) {
+			name, v, named = strings.TrimSpace(item[:eq]), strings.TrimSpace(item[eq+1:]), true
+		}
+		if i > 0 && named != (p.Names != nil) {
+			return p, fmt.Errorf("invalid -mitigates-props: use name=value for all properties or for none")
+		}
+		if named {
+			for _, n := range p.Names {
+				if strings.EqualFold(n, name) {
+					return p, fmt.Errorf("invalid -mitigates-props: %s given more than once", name)
+				}
+			}
+			p.Names = append(p.Names, name)
+		}
+		lit, err := propLiteral(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid -mitigates-props: %w", err)
+		}
+		p.Values = append(p.Values, lit)
+	}
+	return p, nil
+}
+
+// splitPropList splits at commas outside double quotes and trims the items.
+func splitPropList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var items []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ',' && !quoted:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated string in %s", s)
+	}
+	return append(items, strings.TrimSpace(s[start:])), nil
+}
+
+// propLiteral checks one -mitigates-props value and returns it as written
+// into nGQL; strings are re-quoted with quoteLiteral.
+func propLiteral(v string) (string, error) {
+	switch {
+	case v == domainPlaceholder:
+		return v, nil
+	case strings.EqualFold(v, "NULL"):
+		return "NULL", nil
+	case v == "true" || v == "false":
+		return v, nil
+	case strings.HasPrefix(v, `"`):
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", fmt.Errorf("bad string %s", v)
+		}
+		return quoteLiteral(s), nil
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return v, nil
+	}
+	return "", fmt.Errorf("unsupported value %q (use NULL, true, false, a number, a \"string\" or %s)", v, domainPlaceholder)
+}
+
+// insertEdge returns the INSERT EDGE statement for the mitigates edge from
+// mitigationID to t.
+func (p mitigatesProps) insertEdge(edge, mitigationID string, t techniqueInfo) string {
+	values := make([]string, len(p.Values))
+	for i, v := range p.Values {
+		if v == domainPlaceholder {
+			v = quoteLiteral(t.Domain)
+		}
+		values[i] = v
+	}
+	if p.Names != nil {
+		edge += "(" + strings.Join(p.Names, ", ") + ")"
+	}
+	return fmt.Sprintf("INSERT EDGE IF NOT EXISTS %s VALUES %s->%s@0:(%s);",
+		edge, quoteID(mitigationID), quoteID(t.ExternalID), strings.Join(values, ", "))
+}
+
+// edgeField is one property of an edge type, from DESCRIBE EDGE.
+type edgeField struct {
+	Name string
+	Type string // e.g. "string", "int64", "fixed_string(8)"
+}
+
+// describeEdgeFields returns the properties of the edge type in order.
+func describeEdgeFields(session *nebula.Session, edge string) ([]edgeField, error) {
+	query := fmt.Sprintf("DESCRIBE EDGE %s;", edge)
+	debugf("Query: %s\n", query)
+	result, err := session.Execute(query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	if !result.IsSucceed() {
+		return nil, fmt.Errorf("DESCRIBE EDGE %s: %s", edge, result.GetErrorMsg())
+	}
+	var fields []edgeField
+	for i := 0; i < result.GetRowSize(); i++ {
+		record, err := result.GetRowValuesByIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get row: %w", err)
+		}
+		fieldVal, err := record.GetValueByColName("Field")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Field: %w", err)
+		}
+		typeVal, err := record.GetValueByColName("Type")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Type: %w", err)
+		}
+		field, _ := fieldVal.AsString()
+		typ, _ := typeVal.AsString()
+		fields = append(fields, edgeField{Name: field, Type: typ})
+	}
+	return fields, nil
+}
+
+// checkMitigatesProps compares p with the properties of the edge type:
+// positional values must match their number, names must exist.
+func checkMitigatesProps(fields []edgeField, edge string, p mitigatesProps) error {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	if p.Names == nil {
+		if len(p.Values) != len(fields) {
+			return fmt.Errorf("-mitigates-props has %d value(s) but edge %s has %d properties (%s)",
+				len(p.Values), edge, len(fields), strings.Join(names, ", "))
+		}
+		return nil
+	}
+	for _, n := range p.Names {
+		if fieldByName(fields, n) == nil {
+			return fmt.Errorf("-mitigates-props names %s, which edge %s doesn't have (it has: %s)", n, edge, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+func fieldByName(fields []edgeField, name string) *edgeField {
+	for i := range fields {
+		if fields[i].Name == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+// mitre-serve.go
+//
+// -serve ADDR: a read-only JSON API over the loaded bundle, for web apps
+// that would otherwise shell out to the tool. The listener opens first and
+// answers 503 until the bundle is loaded and parsed (once, at startup);
+// after that every request is served from the in-memory maps.
+//
+//	GET /mitigations        the list, as -list-mitigations -format json
+//	GET /mitigation/{id}    its techniques, as -mitigation ID -format json
+//	GET /technique/{id}     the mitigations of a technique
+//	GET /healthz            ATT&CK release and object counts; 503 while loading
+//	POST /reload            fetch and parse the bundle again, then swap it in
+//	GET /metrics            Prometheus metrics, see mitre-prometheus.go
+//
+// -full, -describe-techniques, -sort, -group-by, -only-domain,
+// -follow-revoked and -include-revoked apply as on the command line;
+// -exclude and -include-only don't. Unknown IDs are a 404 with a JSON
+// {"error": ...} body.
+//
+// /reload goes through the cache like a new run would: a copy younger than
+// -cache-ttl is reused, -refresh downloads every time. The new maps and the
+// tactic tables are swapped in under a write lock; requests hold the read
+// lock while they build their answer, so each one sees either the old
+// bundle or the new one. A failed reload keeps the old bundle.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiOptions are the output flags the API honours.
+type apiOptions struct {
+	Full           bool
+	Describe       bool
+	Sort           string
+	GroupBy        string
+	OnlyDomain     string
+	FollowRevoked  bool
+	IncludeRevoked bool
+}
+
+// apiState is the loaded bundle the handlers read.
+type apiState struct {
+	data       *attackData
+	mitigates  []relationship      // resolveMitigates, computed once
+	detectedBy map[string][]string // technique STIX ID -> "Source: Component"
+	release    attackRelease
+	loadedAt   time.Time
+}
+
+type apiServer struct {
+	opts apiOptions
+	load func() (*attackData, error) // for /reload
+
+	mu    sync.RWMutex // guards state and the tactic/release globals
+	state *apiState    // nil while loading
+
+	reloading sync.Mutex // one /reload at a time
+	metrics   *apiMetrics
+}
+
+// apiStatus is the /healthz and /reload answer.
+type apiStatus struct {
+	Status        string `json:"status"` // "ok" or "loading"
+	AttackVersion string `json:"attack_version,omitempty"`
+	Release       string `json:"release,omitempty"`
+	LoadedAt      string `json:"loaded_at,omitempty"`
+	Mitigations   int    `json:"mitigations"`
+	Techniques    int    `json:"techniques"`
+	Relationships int    `json:"relationships"`
+	Took          string `json:"took,omitempty"` // /reload only
+}
+
+// apiError is an error answer: {"error": "..."}.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// techniqueMitigations is the /technique/{id} answer.
+type techniqueMitigations struct {
+	ExternalID  string            `json:"external_id"`
+	Name        string            `json:"name"`
+	URL         string            `json:"url,omitempty"`
+	Mitigations []mitigationEntry `json:"mitigations"`
+}
+
+// startAPIServer listens on addr and serves 503 until setData is called;
+// load is what /reload runs. Errors from the listener after startup arrive
+// on the channel.
+func startAPIServer(addr string, opts apiOptions, load func() (*attackData, error)) (*apiServer, <-chan error, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("-serve %s: %w", addr, err)
+	}
+	s := &apiServer{opts: opts, load: load, metrics: newAPIMetrics()}
+	srv := &http.Server{Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	infof("serving the API on http://%s (loading the bundle)\n", ln.Addr())
+	return s, errc, nil
+}
+
+// setData makes data live; requests from now on are answered from it.
+// The caller holds s.mu.
+func (s *apiServer) setData(data *attackData) {
+	mitigates, _ := data.resolveMitigates()
+	s.state = &apiState{
+		data:       data,
+		mitigates:  mitigates,
+		detectedBy: data.detectedBy(),
+		release:    data.release(),
+		loadedAt:   time.Now(),
+	}
+	s.metrics.bundleLoaded(s.state)
+}
+
+// ready publishes the bundle main loaded at startup.
+func (s *apiServer) ready(data *attackData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setData(data)
+}
+
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern, endpoint string, h http.Handler) {
+		mux.Handle(pattern, s.metrics.instrument(endpoint, h))
+	}
+	handle("/mitigations", "/mitigations", s.get(s.handleMitigations))
+	handle("/mitigation/", "/mitigation/{id}", s.get(s.handleMitigation))
+	handle("/technique/", "/technique/{id}", s.get(s.handleTechnique))
+	handle("/healthz", "/healthz", s.get(s.handleHealth))
+	handle("/reload", "/reload", http.HandlerFunc(s.handleReload))
+	handle("/", "other", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPI(w, http.StatusNotFound, apiError{"no such endpoint: " + r.URL.Path})
+	}))
+	mux.Handle("/metrics", s.metrics.handler())
+	return mux
+}
+
+// get wraps a handler: GET (and HEAD) only, 503 while the bundle loads.
+// The answer is built and encoded under the read lock and sent after it is
+// released, so a slow client can't hold up a reload.
+func (s *apiServer) get(h func(*http.Request, *apiState) (int, any)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPI(w, http.StatusMethodNotAllowed, apiError{r.Method + " not allowed"})
+			return
+		}
+		debugf("%s %s\n", r.Method, r.URL.Path)
+		s.mu.RLock()
+		status, v := http.StatusServiceUnavailable, any(apiError{"the ATT&CK bundle is still loading"})
+		if s.state != nil {
+			status, v = h(r, s.state)
+		} else if r.URL.Path == "/healthz" {
+			v = apiStatus{Status: "loading"}
+		}
+		body, err := encodeAPI(v)
+		s.mu.RUnlock()
+
+		if err != nil {
+			status = http.StatusInternalServerError
+			body, _ = encodeAPI(apiError{err.Error()})
+		}
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "5")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	}
+}
+
+func (s *apiServer) handleMitigations(r *http.Request, st *apiState) (int, any) {
+	return http.StatusOK, listableMitigations(st.data.Mitigations, s.opts.IncludeRevoked)
+}
+
+func (s *apiServer) handleMitigation(r *http.Request, st *apiState) (int, any) {
+	ext := strings.TrimPrefix(r.URL.Path, "/mitigation/")
+	id, ok := st.data.mitigationByExternalID(ext)
+	if !ok {
+		return http.StatusNotFound, apiError{fmt.Sprintf("mitigation %s not found in ATT&CK data", ext)}
+	}
+	if co := st.data.Mitigations[id]; co.Revoked {
+		note := revokedNote(id, st.data.RevokedBy, st.data.Mitigations, st.data.Techniques)
+		repl, ok := resolveRevoked(id, st.data.RevokedBy)
+		if _, found := st.data.Mitigations[repl]; !s.opts.FollowRevoked || !ok || !found {
+			return http.StatusNotFound, apiError{fmt.Sprintf("mitigation %s is %s", ext, note)}
+		}
+		id = repl
+	}
+
+	results, _, _ := collectTechniques(st.data, st.mitigates, id, s.opts.OnlyDomain, st.detectedBy, debugf)
+	sortTechniques(results, s.opts.Sort)
+	items := make([]techniqueInfo, len(results))
+	for i, t := range results {
+		if !s.opts.Full {
+			t = t.brief(s.opts.Describe)
+		}
+		items[i] = t
+	}
+	if s.opts.GroupBy == "tactic" {
+		return http.StatusOK, groupedJSON(groupByTactic(items))
+	}
+	return http.StatusOK, items
+}
+
+func (s *apiServer) handleTechnique(r *http.Request, st *apiState) (int, any) {
+	ext := strings.TrimPrefix(r.URL.Path, "/technique/")
+	tp, ok := st.data.techniqueByExternalID(ext)
+	if !ok {
+		return http.StatusNotFound, apiError{fmt.Sprintf("technique %s not found in ATT&CK data", ext)}
+	}
+	if tp.Revoked {
+		note := revokedNote(tp.ID, st.data.RevokedBy, st.data.Mitigations, st.data.Techniques)
+		return http.StatusNotFound, apiError{fmt.Sprintf("technique %s is %s", ext, note)}
+	}
+
+	// Edges to a revoked technique count for its replacement, as in
+	// collectTechniques
+	seen := make(map[string]bool)
+	resp := techniqueMitigations{Mitigations: []mitigationEntry{}}
+	resp.ExternalID, _ = externalID(tp.ExternalRefs)
+	resp.Name, resp.URL = tp.Name, techniqueURL(resp.ExternalID, tp.ExternalRefs)
+	for _, rel := range st.mitigates {
+		target := rel.TargetRef
+		if t, found := st.data.Techniques[target]; found && t.Revoked {
+			target, _ = resolveRevoked(target, st.data.RevokedBy)
+		}
+		if target != tp.ID || seen[rel.SourceRef] {
+			continue
+		}
+		seen[rel.SourceRef] = true
+		co := st.data.Mitigations[rel.SourceRef]
+		if mitExt, ok := externalID(co.ExternalRefs); ok {
+			resp.Mitigations = append(resp.Mitigations, mitigationEntry{ExternalID: mitExt, Name: co.Name})
+		}
+	}
+	sort.Slice(resp.Mitigations, func(i, j int) bool { return resp.Mitigations[i].ExternalID < resp.Mitigations[j].ExternalID })
+	return http.StatusOK, resp
+}
+
+func (s *apiServer) handleHealth(r *http.Request, st *apiState) (int, any) {
+	return http.StatusOK, st.status()
+}
+
+// status describes the loaded bundle.
+func (st *apiState) status() apiStatus {
+	return apiStatus{
+		Status:        "ok",
+		AttackVersion: st.release.Version,
+		Release:       st.release.String(),
+		LoadedAt:      st.loadedAt.UTC().Format(time.RFC3339),
+		Mitigations:   len(st.data.Mitigations),
+		Techniques:    len(st.data.Techniques),
+		Relationships: len(st.data.Relationships),
+	}
+}
+
+// handleReload loads the bundle again and swaps it in. Requests keep being
+// served from the old bundle until the new one is ready.
+func (s *apiServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeAPI(w, http.StatusMethodNotAllowed, apiError{r.Method + " not allowed"})
+		return
+	}
+	s.mu.RLock()
+	loading := s.state == nil
+	s.mu.RUnlock()
+	if loading {
+		w.Header().Set("Retry-After", "5")
+		writeAPI(w, http.StatusServiceUnavailable, apiError{"the ATT&CK bundle is still loading"})
+		return
+	}
+	if !s.reloading.TryLock() {
+		writeAPI(w, http.StatusConflict, apiError{"a reload is already running"})
+		return
+	}
+	defer s.reloading.Unlock()
+
+	start := time.Now()
+	infof("reloading the ATT&CK bundle\n")
+	data, err := s.load()
+	if err == nil {
+		for _, msg := range data.skipWarnings() {
+			warnf("%s\n", msg)
+		}
+		if *flagStrict && data.skipCount() > 0 {
+			err = fmt.Errorf("%d bundle object(s) could not be parsed (-strict)", data.skipCount())
+		}
+	}
+	if err != nil {
+		s.metrics.reloads.WithLabelValues("error").Inc()
+		warnf("reload failed: %v; still serving the previous bundle\n", err)
+		writeAPI(w, http.StatusInternalServerError, apiError{"reload failed: " + err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	useBundleTables(data)
+	s.setData(data)
+	st := s.state.status()
+	s.mu.Unlock()
+	s.metrics.reloads.WithLabelValues("ok").Inc()
+
+	st.Took = time.Since(start).Round(time.Millisecond).String()
+	infof("reloaded %s: %d mitigations, %d techniques in %s\n", st.Release, st.Mitigations, st.Techniques, st.Took)
+	writeAPI(w, http.StatusOK, st)
+}
+
+// encodeAPI renders v indented like -format json. Errors and status
+// answers are left unescaped so "ATT&CK" reads as such.
+func encodeAPI(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	switch v.(type) {
+	case apiError, apiStatus:
+		enc.SetEscapeHTML(false)
+	}
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+// writeAPI sends v with status; for answers built outside the read lock.
+func writeAPI(w http.ResponseWriter, status int, v any) {
+	body, err := encodeAPI(v)
+	if err != nil {
+		debugf("encoding response: %v\n", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// waitAPIServer blocks until the listener fails.
+func waitAPIServer(errc <-chan error) error {
+	err := <-errc
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
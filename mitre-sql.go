@@ -0,0 +1,108 @@
+// mitre-sql.go
+//
+// -sql: the same data -ngql writes, as INSERT statements for a relational
+// database. No connection is made; every insert skips rows that already
+// exist, so the script can be re-run. -sql-dialect picks the upsert syntax:
+//
+//	postgres  INSERT ... ON CONFLICT DO NOTHING
+//	sqlite    INSERT OR IGNORE ...
+//	mysql     INSERT IGNORE ...
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var sqlDialects = []string{"postgres", "sqlite", "mysql"}
+
+func validSQLDialect(d string) bool {
+	for _, v := range sqlDialects {
+		if d == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlLiteral quotes s as an SQL string literal. MySQL additionally treats
+// backslash as an escape character unless NO_BACKSLASH_ESCAPES is set.
+func sqlLiteral(s, dialect string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if dialect == "mysql" {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
+
+// sqlInsert returns one idempotent INSERT for the dialect.
+func sqlInsert(dialect, table string, columns, values []string) string {
+	cols, vals := strings.Join(columns, ", "), strings.Join(values, ", ")
+	switch dialect {
+	case "sqlite":
+		return fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s);", table, cols, vals)
+	case "mysql":
+		return fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s);", table, cols, vals)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING;", table, cols, vals)
+}
+
+// sqlSchema is the CREATE TABLE preamble, emitted commented out.
+func sqlSchema(dialect string) []string {
+	id, name, text := "TEXT", "TEXT", "TEXT"
+	if dialect == "mysql" {
+		// MySQL can't index TEXT without a prefix length
+		id, name = "VARCHAR(16)", "VARCHAR(255)"
+	}
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS mitre_mitigation (mitigation_id %s PRIMARY KEY, mitigation_name %s NOT NULL, matrix %s, description %s);", id, name, name, text),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS mitre_technique (technique_id %s PRIMARY KEY, technique_name %s NOT NULL, parent_id %s, tactics %s);", id, name, id, name),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS mitre_mitigates (mitigation_id %s NOT NULL, technique_id %s NOT NULL, domain %s, PRIMARY KEY (mitigation_id, technique_id));", id, id, name),
+	}
+}
+
+// generateSQL mirrors generateNGQL: the mitigation row, every technique (with
+// its parent and tactics in place of the has_subtechnique/part_of edges) and
+// one mitigates row per technique.
+func generateSQL(dialect, mitigationID string, mit courseOfAction, techniques []techniqueInfo) string {
+	var b strings.Builder
+	lit := func(s string) string { return sqlLiteral(s, dialect) }
+
+	b.WriteString("-- ============================================================\n")
+	b.WriteString(fmt.Sprintf("-- SQL (%s) for mitigation %s (%s)\n", dialect, mitigationID, mit.Name))
+	b.WriteString(fmt.Sprintf("-- Data: %s\n", bundleRelease))
+	b.WriteString("-- ============================================================\n\n")
+
+	b.WriteString("-- Schema (uncomment to create the tables):\n")
+	for _, stmt := range sqlSchema(dialect) {
+		b.WriteString("-- " + stmt + "\n")
+	}
+
+	b.WriteString("\n-- Mitigation\n")
+	b.WriteString(sqlInsert(dialect, "mitre_mitigation",
+		[]string{"mitigation_id", "mitigation_name", "matrix", "description"},
+		[]string{lit(mitigationID), lit(mit.Name), lit(mit.Domain), lit(mit.Description)}) + "\n")
+
+	b.WriteString("\n-- Techniques\n")
+	for _, t := range techniques {
+		parent := "NULL"
+		if isSubtechnique(t.ExternalID) {
+			parent = lit(getParentTechniqueID(t.ExternalID))
+		}
+		b.WriteString(sqlInsert(dialect, "mitre_technique",
+			[]string{"technique_id", "technique_name", "parent_id", "tactics"},
+			[]string{lit(t.ExternalID), lit(t.Name), parent, lit(strings.Join(t.Tactics, ","))}) + "\n")
+	}
+
+	b.WriteString("\n-- Mitigates\n")
+	for _, t := range techniques {
+		b.WriteString(sqlInsert(dialect, "mitre_mitigates",
+			[]string{"mitigation_id", "technique_id", "domain"},
+			[]string{lit(mitigationID), lit(t.ExternalID), lit(t.Domain)}) + "\n")
+	}
+
+	b.WriteString(fmt.Sprintf("\n-- Expected mitigates rows for %s: %d\n", mitigationID, len(techniques)))
+	return b.String()
+}
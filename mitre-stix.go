@@ -0,0 +1,140 @@
+// mitre-stix.go
+//
+// -stix: write the selected mitigation as a standalone STIX bundle. Objects
+// are copied verbatim from the source bundle (we keep their raw JSON), so
+// STIX IDs, timestamps and properties we don't model survive untouched.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// newBundleID returns "bundle--" followed by a random (v4) UUID.
+func newBundleID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("bundle--%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+// stixSlice picks the objects to export: the course-of-action, the
+// attack-patterns it mitigates (limited to `allowed` external IDs), and the
+// connecting relationships. Revoked or deprecated objects are left out unless
+// includeRevoked is set – except a revoked technique whose replacement is
+// only reached through it: that one keeps its mitigates relationship and
+// brings the revoked-by chain and the replacement, so every reference in the
+// slice resolves.
+func stixSlice(mitSTIXID string, rels []relationship, techMap map[string]attackPattern, allowed map[string]bool, includeRevoked bool, revokedBy map[string]string, rawByID map[string]json.RawMessage) []json.RawMessage {
+	objects := []json.RawMessage{rawByID[mitSTIXID]}
+
+	type pick struct {
+		ext   string
+		tech  json.RawMessage
+		links []json.RawMessage
+	}
+	picked := make(map[string]*pick)
+	add := func(ap attackPattern, link json.RawMessage) {
+		p := picked[ap.ID]
+		if p == nil {
+			ext, _ := externalID(ap.ExternalRefs)
+			p = &pick{ext: ext, tech: rawByID[ap.ID]}
+			picked[ap.ID] = p
+		}
+		if link != nil {
+			p.links = append(p.links, link)
+		}
+	}
+
+	// revoked-by relationship objects by source, to follow a chain, and
+	// the techniques the mitigation names directly
+	revokedByRel := make(map[string]json.RawMessage)
+	direct := make(map[string]bool)
+	for _, r := range rels {
+		switch {
+		case r.RelationshipType == "revoked-by":
+			revokedByRel[r.SourceRef] = rawByID[r.ID]
+		case r.RelationshipType == "mitigates" && r.SourceRef == mitSTIXID && !r.Revoked && !r.Deprecated:
+			direct[r.TargetRef] = true
+		}
+	}
+
+	for _, r := range rels {
+		if r.RelationshipType != "mitigates" || r.SourceRef != mitSTIXID {
+			continue
+		}
+		if (r.Revoked || r.Deprecated) && !includeRevoked {
+			continue
+		}
+		ap, ok := techMap[r.TargetRef]
+		if !ok {
+			continue
+		}
+		ext, _ := externalID(ap.ExternalRefs)
+		if ap.Revoked && !includeRevoked {
+			repl, ok := resolveRevoked(ap.ID, revokedBy)
+			replAP, found := techMap[repl]
+			replExt, _ := externalID(replAP.ExternalRefs)
+			if !ok || !found || !allowed[replExt] || direct[repl] {
+				continue
+			}
+			add(ap, rawByID[r.ID])
+			for cur := ap.ID; cur != repl; cur = revokedBy[cur] {
+				if link := revokedByRel[cur]; link != nil {
+					add(techMap[cur], link)
+				}
+				add(techMap[revokedBy[cur]], nil)
+			}
+			continue
+		}
+		if ap.Revoked || ap.Deprecated {
+			if !includeRevoked {
+				continue
+			}
+		} else if !allowed[ext] {
+			continue
+		}
+
+		add(ap, rawByID[r.ID])
+	}
+
+	ordered := make([]*pick, 0, len(picked))
+	for _, p := range picked {
+		ordered = append(ordered, p)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].ext < ordered[j].ext })
+
+	for _, p := range ordered {
+		objects = append(objects, p.tech)
+	}
+	for _, p := range ordered {
+		objects = append(objects, p.links...)
+	}
+	return objects
+}
+
+// writeSTIXBundle wraps objects in a new bundle. STIX 2.0 requires the
+// bundle-level spec_version, 2.1 dropped it, so we follow the source bundle.
+func writeSTIXBundle(w io.Writer, sourceSpec string, objects []json.RawMessage) error {
+	id, err := newBundleID()
+	if err != nil {
+		return err
+	}
+
+	out := Bundle{Type: "bundle", ID: id, Objects: objects}
+	if sourceSpec == "2.0" {
+		out.SpecVersion = "2.0"
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,119 @@
+// mitre-techids.go
+//
+// One place that turns user-supplied technique IDs (from flags or files)
+// into validated, normalized ATT&CK IDs, so every flag that accepts them
+// reports problems the same way.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var techIDPattern = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+// techIDIssue is a rejected or unrecognized ID together with where it came
+// from ("-exclude" or "ids.txt:12 (-exclude)").
+type techIDIssue struct {
+	ID     string
+	Source string
+}
+
+// techIDList is the structured result of parsing one flag value.
+type techIDList struct {
+	Valid     []string      // normalized and present in the bundle
+	Unknown   []techIDIssue // well-formed but not in the bundle
+	Malformed []techIDIssue // not T####(.###)
+}
+
+// parseTechniqueIDs accepts a comma/whitespace separated list, or "@path" to
+// read IDs from a file (one or more per line, "#" starts a comment). IDs are
+// upper-cased, stripped of whitespace and a UTF-8 BOM, deduplicated, and
+// checked against known (external ID -> true).
+func parseTechniqueIDs(flagName, value string, known map[string]bool) (techIDList, error) {
+	var list techIDList
+	seen := make(map[string]bool)
+
+	add := func(raw, source string) {
+		id := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(raw, "\ufeff")))
+		if id == "" || seen[id] {
+			return
+		}
+		seen[id] = true
+
+		switch {
+		case !techIDPattern.MatchString(id):
+			list.Malformed = append(list.Malformed, techIDIssue{ID: raw, Source: source})
+		case !known[id]:
+			list.Unknown = append(list.Unknown, techIDIssue{ID: id, Source: source})
+		default:
+			list.Valid = append(list.Valid, id)
+		}
+	}
+
+	if !strings.HasPrefix(value, "@") {
+		for _, field := range splitIDs(value) {
+			add(field, "-"+flagName)
+		}
+		return list, nil
+	}
+
+	path := strings.TrimPrefix(value, "@")
+	f, err := os.Open(path)
+	if err != nil {
+		return list, fmt.Errorf("-%s: %w", flagName, err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, field := range splitIDs(line) {
+			add(field, fmt.Sprintf("%s:%d (-%s)", path, lineNo, flagName))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return list, fmt.Errorf("-%s: %s: %w", flagName, path, err)
+	}
+	return list, nil
+}
+
+func splitIDs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\r'
+	})
+}
+
+// report prints a verdict for every rejected ID and returns an error when any
+// of them is malformed. Unknown IDs are warnings only.
+func (l techIDList) report() error {
+	for _, u := range l.Unknown {
+		warnf("%s from %s is not a technique in the ATT&CK bundle\n", u.ID, u.Source)
+	}
+	for _, m := range l.Malformed {
+		errorf("error: %q from %s is not a technique ID (expected T#### or T####.###)\n", m.ID, m.Source)
+	}
+	if len(l.Malformed) > 0 {
+		return fmt.Errorf("%d malformed technique ID(s)", len(l.Malformed))
+	}
+	return nil
+}
+
+// set returns the valid IDs as a lookup map.
+func (l techIDList) set() map[string]bool {
+	m := make(map[string]bool, len(l.Valid))
+	for _, id := range l.Valid {
+		m[id] = true
+	}
+	return m
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTechniqueIDs(t *testing.T) {
+	known := map[string]bool{"T1059": true, "T1059.001": true, "T1547": true}
+	issue := func(id string) techIDIssue { return techIDIssue{ID: id, Source: "-exclude"} }
+
+	tests := []struct {
+		name  string
+		value string
+		want  techIDList
+	}{
+		{"empty", "", techIDList{}},
+		{"valid", "T1059, T1059.001;T1547", techIDList{Valid: []string{"T1059", "T1059.001", "T1547"}}},
+		{"normalized", " t1059\tt1059.001 ", techIDList{Valid: []string{"T1059", "T1059.001"}}},
+		{"deduplicated", "T1059,t1059,T1059", techIDList{Valid: []string{"T1059"}}},
+		{"bom", "\ufeffT1547", techIDList{Valid: []string{"T1547"}}},
+		{"unknown", "T1059,T9999,T1059.999", techIDList{
+			Valid:   []string{"T1059"},
+			Unknown: []techIDIssue{issue("T9999"), issue("T1059.999")},
+		}},
+		{"malformed", "T105,M1037,T1059.1,T1059.0011,1059", techIDList{
+			Malformed: []techIDIssue{issue("T105"), issue("M1037"), issue("T1059.1"), issue("T1059.0011"), issue("1059")},
+		}},
+		{"mixed", "T1547,T0000,x", techIDList{
+			Valid:     []string{"T1547"},
+			Unknown:   []techIDIssue{issue("T0000")},
+			Malformed: []techIDIssue{issue("x")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTechniqueIDs("exclude", tt.value, known)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTechniqueIDs(%q)\n got %+v\nwant %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTechniqueIDsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids.txt")
+	content := "\ufeff# excluded techniques\nT1059 # interpreter\n\nt1547,T1234\r\nbogus\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseTechniqueIDs("exclude", "@"+path, map[string]bool{"T1059": true, "T1547": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := techIDList{
+		Valid:     []string{"T1059", "T1547"},
+		Unknown:   []techIDIssue{{ID: "T1234", Source: path + ":4 (-exclude)"}},
+		Malformed: []techIDIssue{{ID: "bogus", Source: path + ":5 (-exclude)"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	if _, err := parseTechniqueIDs("exclude", "@"+path+".missing", nil); err == nil {
+		t.Error("missing file: no error")
+	}
+}
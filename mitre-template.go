@@ -0,0 +1,90 @@
+// mitre-template.go
+//
+// -template FILE / -template-inline TEXT: render the results through a Go
+// text/template. The template is parsed before the bundle is loaded so a
+// syntax error (reported with its line number) costs nothing.
+//
+// The template receives a templateData value:
+//
+//	.Mitigation.ID / .Name / .Description / .URL
+//	.Techniques   []techniqueInfo (.ExternalID .Name .Tactics .URL
+//	              .Description .Platforms .Detection .DataSources)
+//
+// Helper functions: join LIST SEP, upper, lower, attackURL ID.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateData is the value passed to -template.
+type templateData struct {
+	Mitigation templateMitigation
+	Techniques []techniqueInfo
+}
+
+type templateMitigation struct {
+	ID          string
+	Name        string
+	Description string
+	URL         string
+}
+
+var templateFuncs = template.FuncMap{
+	"join":      func(list []string, sep string) string { return strings.Join(list, sep) },
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"attackURL": attackURL,
+}
+
+// attackURL returns the attack.mitre.org page for a technique (T1059,
+// T1059.001), mitigation (M1037) or tactic (TA0002) ID.
+func attackURL(id string) string {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	switch {
+	case strings.HasPrefix(id, "TA"):
+		return "https://attack.mitre.org/tactics/" + id + "/"
+	case strings.HasPrefix(id, "M"):
+		return "https://attack.mitre.org/mitigations/" + id + "/"
+	case strings.HasPrefix(id, "T"):
+		return "https://attack.mitre.org/techniques/" + strings.Replace(id, ".", "/", 1) + "/"
+	}
+	return ""
+}
+
+// loadTemplate parses -template (a file) or -template-inline. It returns nil
+// when neither is set.
+func loadTemplate(file, inline string) (*template.Template, error) {
+	switch {
+	case file != "" && inline != "":
+		return nil, fmt.Errorf("use either -template or -template-inline, not both")
+	case file != "":
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return template.New(file).Funcs(templateFuncs).Parse(string(text))
+	case inline != "":
+		return template.New("inline").Funcs(templateFuncs).Parse(inline)
+	}
+	return nil, nil
+}
+
+func renderTemplate(out io.Writer, tmpl *template.Template, mit courseOfAction, data []techniqueInfo) error {
+	mitExt, _ := externalID(mit.ExternalRefs)
+	return tmpl.Execute(out, templateData{
+		Mitigation: templateMitigation{
+			ID:          mitExt,
+			Name:        mit.Name,
+			Description: mit.Description,
+			URL:         externalURL(mit.ExternalRefs),
+		},
+		Techniques: data,
+	})
+}
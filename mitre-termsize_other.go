@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+// mitre-termsize_other.go
+//
+// Terminal width fallback: honour $COLUMNS where there's no ioctl.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+func terminalWidth(f *os.File) int {
+	n, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return n
+}
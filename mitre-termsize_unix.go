@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+// mitre-termsize_unix.go
+//
+// Terminal width via TIOCGWINSZ.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the column count of the terminal behind f, or 0 if
+// it cannot be determined.
+func terminalWidth(f *os.File) int {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.Col)
+}
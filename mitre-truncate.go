@@ -0,0 +1,157 @@
+// mitre-truncate.go
+//
+// FIXED_STRING columns silently truncate (or reject) long values depending on
+// server settings. We read the declared sizes with DESCRIBE TAG and fit the
+// values in Go before any statement is generated, so the reviewed script is
+// exactly what gets executed.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	nebula "github.com/vesoft-inc/nebula-go/v3"
+)
+
+var fixedStringType = regexp.MustCompile(`(?i)^fixed_string\((\d+)\)$`)
+
+// describeStringLimits returns column name -> max bytes for every
+// FIXED_STRING column of the tag. Plain `string` columns are unbounded and
+// not listed.
+func describeStringLimits(session *nebula.Session, tag string) (map[string]int, error) {
+	query := fmt.Sprintf("DESCRIBE TAG %s;", tag)
+
+	debugf("Query: %s\n", query)
+
+	result, err := session.Execute(query)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	if !result.IsSucceed() {
+		return nil, fmt.Errorf("DESCRIBE TAG %s: %s", tag, result.GetErrorMsg())
+	}
+
+	limits := make(map[string]int)
+	for i := 0; i < result.GetRowSize(); i++ {
+		record, err := result.GetRowValuesByIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get row: %w", err)
+		}
+		fieldVal, err := record.GetValueByColName("Field")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Field: %w", err)
+		}
+		typeVal, err := record.GetValueByColName("Type")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Type: %w", err)
+		}
+		field, _ := fieldVal.AsString()
+		typ, _ := typeVal.AsString()
+
+		if m := fixedStringType.FindStringSubmatch(strings.TrimSpace(typ)); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			limits[field] = n
+		}
+	}
+	return limits, nil
+}
+
+// truncation records one value that was shortened to fit its column.
+type truncation struct {
+	Object   string // technique ID
+	Field    string // column name
+	Limit    int    // declared size in bytes
+	Original int    // original length in bytes
+	Kept     int    // length after cutting at a rune boundary
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// fitTechniques returns a copy of techniques whose string properties fit the
+// tMitreTechnique column limits: the name and, with technique_version_column,
+// the technique version. With strict set (-no-truncate) an overlong value is
+// an error instead. IDs are never truncated – that would change the vertex
+// identity – and neither are the values every technique shares (schema
+// defaults, the ATT&CK release): those come from -technique-schema or the
+// bundle, so a value that doesn't fit is reported as an error.
+func fitTechniques(techniques []techniqueInfo, limits map[string]int, strict bool) ([]techniqueInfo, []truncation, error) {
+	if err := checkSharedLimits(limits); err != nil {
+		return nil, nil, err
+	}
+
+	fitted := make([]techniqueInfo, len(techniques))
+	copy(fitted, techniques)
+
+	var truncs []truncation
+	var overlong []string
+	for i := range fitted {
+		t := &fitted[i]
+
+		idCol := techSchema.IDColumn
+		if n, ok := limits[idCol]; ok && len(t.ExternalID) > n {
+			return nil, nil, fmt.Errorf("technique ID %s is %d bytes, %s holds %d", t.ExternalID, len(t.ExternalID), idCol, n)
+		}
+
+		fit := func(col string, v *string) {
+			n, ok := limits[col]
+			if col == "" || !ok || len(*v) <= n {
+				return
+			}
+			if strict {
+				overlong = append(overlong, fmt.Sprintf("%s %s (%d bytes > %d)", t.ExternalID, col, len(*v), n))
+				return
+			}
+			short := truncateUTF8(*v, n)
+			truncs = append(truncs, truncation{Object: t.ExternalID, Field: col, Limit: n, Original: len(*v), Kept: len(short)})
+			*v = short
+		}
+		fit(techSchema.NameColumn, &t.Name)
+		fit(techSchema.TechniqueVersionColumn, &t.Version)
+	}
+
+	if len(overlong) > 0 {
+		return nil, nil, fmt.Errorf("values exceed column sizes (-no-truncate):\n  %s", strings.Join(overlong, "\n  "))
+	}
+	return fitted, truncs, nil
+}
+
+// checkSharedLimits checks the string values that are the same for every
+// technique against their FIXED_STRING sizes.
+func checkSharedLimits(limits map[string]int) error {
+	for _, d := range techSchema.values(techniqueInfo{}) {
+		s, isString := d.Value.(string)
+		if d.Column == techSchema.TechniqueVersionColumn || !isString {
+			continue
+		}
+		if n, ok := limits[d.Column]; ok && len(s) > n {
+			return fmt.Errorf("%s value %q is %d bytes, the column holds %d (check -technique-schema)", d.Column, s, len(s), n)
+		}
+	}
+	return nil
+}
+
+func printTruncations(out io.Writer, truncs []truncation) {
+	if len(truncs) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "TRUNCATED VALUES (%d):\n", len(truncs))
+	for _, tr := range truncs {
+		fmt.Fprintf(out, "  %s %s: %d -> %d bytes (limit %d, -%d)\n", tr.Object, tr.Field, tr.Original, tr.Kept, tr.Limit, tr.Original-tr.Kept)
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"PowerShell", 20, "PowerShell"},
+		{"PowerShell", 10, "PowerShell"},
+		{"PowerShell", 5, "Power"},
+		{"PowerShell", 0, ""},
+		{"Café", 4, "Caf"},  // é is 2 bytes: cut inside it
+		{"Café", 5, "Café"}, // exactly fits
+		{"a€b", 2, "a"},     // € is 3 bytes
+		{"a€b", 3, "a"},     // still inside €
+		{"a€b", 4, "a€"},    // right after €
+		{"x🔥y", 4, "x"},     // 4-byte rune, cut after its third byte
+		{"x🔥y", 5, "x🔥"},
+		{"日本語", 7, "日本"},
+		{"日本語", 2, ""},
+	}
+	for _, tt := range tests {
+		got := truncateUTF8(tt.s, tt.n)
+		if got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) || len(got) > tt.n && got != tt.s {
+			t.Errorf("truncateUTF8(%q, %d) = %q: invalid or too long", tt.s, tt.n, got)
+		}
+	}
+}
+
+func fitSchema() techniqueSchema {
+	return techniqueSchema{
+		IDColumn:               "Technique_ID",
+		NameColumn:             "Technique_Name",
+		AttackVersionColumn:    "Mitre_Attack_Version",
+		TechniqueVersionColumn: "Technique_Version",
+		Defaults: []columnDefault{
+			{"Mitre_Attack_Version", "18.0"},
+			{"source", "mitre"},
+			{"priority", json.Number("4")},
+		},
+		AttackVersion: "16.1",
+	}
+}
+
+func TestFitTechniques(t *testing.T) {
+	swap(t, &techSchema, fitSchema())
+	techniques := []techniqueInfo{
+		{ExternalID: "T1059.001", Name: "PowerShell", Version: "1.4"},
+		{ExternalID: "T1547", Name: "Démarrage automatique", Version: "2.10.1"},
+		{ExternalID: "T1003", Name: "短い名前です", Version: "1.0"},
+	}
+	limits := map[string]int{
+		"Technique_ID":         16,
+		"Technique_Name":       10,
+		"Technique_Version":    4,
+		"Mitre_Attack_Version": 8,
+		"source":               8,
+	}
+
+	fitted, truncs, err := fitTechniques(techniques, limits, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames := []string{"PowerShell", "Démarrage", "短い名"}
+	wantVersions := []string{"1.4", "2.10", "1.0"}
+	for i, f := range fitted {
+		if f.Name != wantNames[i] || f.Version != wantVersions[i] {
+			t.Errorf("%s: got %q %q, want %q %q", f.ExternalID, f.Name, f.Version, wantNames[i], wantVersions[i])
+		}
+	}
+	wantTruncs := []truncation{
+		{Object: "T1547", Field: "Technique_Name", Limit: 10, Original: 22, Kept: 10},
+		{Object: "T1547", Field: "Technique_Version", Limit: 4, Original: 6, Kept: 4},
+		{Object: "T1003", Field: "Technique_Name", Limit: 10, Original: 18, Kept: 9},
+	}
+	if !reflect.DeepEqual(truncs, wantTruncs) {
+		t.Errorf("truncations\n got %+v\nwant %+v", truncs, wantTruncs)
+	}
+	if techniques[1].Name != "Démarrage automatique" {
+		t.Error("fitTechniques changed its input")
+	}
+
+	// Every value written fits after fitting
+	for _, f := range fitted {
+		stmt := techSchema.insertVertex("tMitreTechnique", f)
+		for col, n := range limits {
+			for _, d := range append(techSchema.values(f), columnDefault{"Technique_Name", f.Name}) {
+				if s, ok := d.Value.(string); ok && d.Column == col && len(s) > n {
+					t.Errorf("%s: %s is %d bytes > %d in %s", f.ExternalID, col, len(s), n, stmt)
+				}
+			}
+		}
+	}
+}
+
+func TestFitTechniquesStrict(t *testing.T) {
+	swap(t, &techSchema, fitSchema())
+	techniques := []techniqueInfo{{ExternalID: "T1547", Name: "Démarrage automatique", Version: "2.10.1"}}
+	_, _, err := fitTechniques(techniques, map[string]int{"Technique_Name": 10, "Technique_Version": 4}, true)
+	if err == nil {
+		t.Fatal("strict: no error")
+	}
+	for _, want := range []string{"T1547 Technique_Name (22 bytes > 10)", "T1547 Technique_Version (6 bytes > 4)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q lacks %q", err, want)
+		}
+	}
+}
+
+func TestFitTechniquesErrors(t *testing.T) {
+	swap(t, &techSchema, fitSchema())
+	techniques := []techniqueInfo{{ExternalID: "T1059.001", Name: "PowerShell"}}
+	tests := []struct {
+		name   string
+		limits map[string]int
+		want   string
+	}{
+		{"id never cut", map[string]int{"Technique_ID": 5}, "technique ID T1059.001 is 9 bytes"},
+		{"schema default", map[string]int{"source": 3}, `source value "mitre" is 5 bytes`},
+		{"attack release", map[string]int{"Mitre_Attack_Version": 2}, `Mitre_Attack_Version value "16.1" is 4 bytes`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := fitTechniques(techniques, tt.limits, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertMitigationStmt(t *testing.T) {
+	co := courseOfAction{Name: "Contrôle des privilèges", Domain: "Enterprise", Description: "Limit\nprivileges.", Version: "1.2"}
+	limits := map[string]int{"Mitigation_ID": 8, "Mitigation_Name": 10, "Description": 64}
+
+	stmt, truncs, err := insertMitigationStmt(defaultGraphNames, "M1026", co, limits, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt, `"Contrôle ", "Enterprise", "Limit privileges.", "1.2"`) {
+		t.Errorf("statement %s", stmt)
+	}
+	want := []truncation{{Object: "M1026", Field: "Mitigation_Name", Limit: 10, Original: 25, Kept: 10}}
+	if !reflect.DeepEqual(truncs, want) {
+		t.Errorf("truncations %+v, want %+v", truncs, want)
+	}
+
+	// -no-truncate fails instead, naming the value
+	_, _, err = insertMitigationStmt(defaultGraphNames, "M1026", co, limits, true)
+	if err == nil || !strings.Contains(err.Error(), "M1026 Mitigation_Name (25 bytes > 10)") {
+		t.Errorf("strict: error %v", err)
+	}
+
+	// An ID that doesn't fit is never cut
+	limits["Mitigation_ID"] = 4
+	if _, _, err := insertMitigationStmt(defaultGraphNames, "M1026", co, limits, false); err == nil {
+		t.Error("overlong ID accepted")
+	}
+}
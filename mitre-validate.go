@@ -0,0 +1,179 @@
+// mitre-validate.go
+//
+// Sanity checks on the raw bundle before anything is parsed out of it: valid
+// JSON, type "bundle", STIX 2.0 or 2.1, and a plausible number of objects.
+// A truncated download or a cached error page fails here with the start of
+// the payload instead of as "mitigation not found" much later. -skip-validation
+// turns the checks off for hand-made bundles.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// minBundleObjects is far below any real ATT&CK release (tens of thousands)
+// but above what an error page or a truncated file parses to.
+const minBundleObjects = 100
+
+// validateBundle checks data; what names it in the error ("cached bundle").
+func validateBundle(data []byte, what string) error {
+	if *flagSkipValidation {
+		return nil
+	}
+	bundle, err := scanBundle(data)
+
+	// STIX 2.0 puts spec_version on the bundle, 2.1 on each object; some
+	// 2.0 mirrors have neither, which is accepted. Single malformed objects
+	// are left to the parser, which reports them
+	spec := bundle.SpecVersion
+	switch {
+	case err != nil:
+		err = fmt.Errorf("not valid JSON: %w", err)
+	case bundle.Type != "bundle":
+		err = fmt.Errorf("type is %q, want \"bundle\"", bundle.Type)
+	case spec != "" && spec != "2.0" && spec != "2.1":
+		err = fmt.Errorf("spec_version is %q, want 2.0 or 2.1", spec)
+	case bundle.Objects < minBundleObjects:
+		err = fmt.Errorf("only %d objects, expected at least %d", bundle.Objects, minBundleObjects)
+	}
+
+	if err != nil {
+		debugf("validation of %s failed: %v\n", what, err)
+		return fmt.Errorf("%s is not a usable ATT&CK bundle: %w (starts with %q; -skip-validation to use it anyway)", what, err, payloadStart(data))
+	}
+	if logEnabled(levelDebug) {
+		if spec == "" {
+			spec = "version not stated"
+		}
+		debugf("validated %s: STIX %s, %d objects\n", what, spec, bundle.Objects)
+	}
+	return nil
+}
+
+// bundleShape is what validateBundle looks at.
+type bundleShape struct {
+	Type        string
+	SpecVersion string // the bundle's, else the first object's that has one
+	Objects     int
+}
+
+// scanBundle reads the shape of a bundle without decoding it: json.Valid
+// checks the syntax (allocating nothing), then one pass over the bytes
+// picks out the top-level type and spec_version, counts the elements of
+// objects and finds the first spec_version among them. A full decode is
+// the parser's job; validating a bundle of hundreds of MB shouldn't need a
+// second copy of it in memory.
+func scanBundle(data []byte) (bundleShape, error) {
+	var b bundleShape
+	if !json.Valid(data) {
+		// Unmarshal stops at the syntax check and explains the error
+		return b, json.Unmarshal(data, &struct{}{})
+	}
+	if t := bytes.TrimSpace(data); t[0] != '{' {
+		return b, fmt.Errorf("a JSON %s, not an object", jsonKind(t[0]))
+	}
+
+	var (
+		depth       int
+		key         []byte // the last object key read
+		arrayStart  = -1   // offset of the objects array while inside it
+		commas      int    // separators between its elements
+		objectsSpec string
+	)
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{', '[':
+			depth++
+			if depth == 2 && string(key) == "objects" {
+				if data[i] == '{' {
+					return b, fmt.Errorf("objects is an object, want an array")
+				}
+				arrayStart, key = i, nil
+			}
+		case '}', ']':
+			if depth == 2 && arrayStart >= 0 {
+				if len(bytes.TrimSpace(data[arrayStart+1:i])) > 0 {
+					b.Objects = commas + 1
+				}
+				arrayStart = -1
+			}
+			depth--
+		case ',':
+			if depth == 2 && arrayStart >= 0 {
+				commas++
+			}
+		case '"':
+			end := stringEnd(data, i)
+			s := data[i : end+1]
+			i = end
+			if next := skipSpace(data, end+1); next < len(data) && data[next] == ':' {
+				key = s[1 : len(s)-1]
+				continue
+			}
+			switch {
+			case depth == 1 && string(key) == "type":
+				json.Unmarshal(s, &b.Type)
+			case depth == 1 && string(key) == "spec_version":
+				json.Unmarshal(s, &b.SpecVersion)
+			case depth == 3 && arrayStart >= 0 && string(key) == "spec_version" && objectsSpec == "":
+				json.Unmarshal(s, &objectsSpec)
+			}
+		}
+	}
+	if b.SpecVersion == "" {
+		b.SpecVersion = objectsSpec
+	}
+	return b, nil
+}
+
+// stringEnd is the offset of the quote that closes the JSON string opened
+// at data[start]; data is valid JSON.
+func stringEnd(data []byte, start int) int {
+	i := start + 1
+	for {
+		i += bytes.IndexByte(data[i:], '"')
+		// Escaped if preceded by an odd number of backslashes
+		bs := 0
+		for data[i-1-bs] == '\\' {
+			bs++
+		}
+		if bs%2 == 0 {
+			return i
+		}
+		i++
+	}
+}
+
+// skipSpace is the offset of the first non-whitespace byte at or after i.
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\r' || data[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+func jsonKind(first byte) string {
+	switch first {
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// payloadStart is the first 200 bytes of data, for diagnostics.
+func payloadStart(data []byte) string {
+	if len(data) > 200 {
+		data = data[:200]
+	}
+	return string(data)
+}
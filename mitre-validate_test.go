@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// testBundle is a bundle of n identity objects around the given extra
+// bundle keys and first object.
+func testBundle(n int, keys, first string) string {
+	var b strings.Builder
+	b.WriteString(`{"type": "bundle", "id": "bundle--1"` + keys + `, "objects": [`)
+	if first != "" {
+		b.WriteString(first + ",")
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"type": "identity", "id": "identity--x", "name": "x"}`)
+	}
+	b.WriteString("]}")
+	return b.String()
+}
+
+func TestValidateBundle(t *testing.T) {
+	swap(t, &verbosity, levelError)
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"fixture", string(readFixture(t, "enterprise-attack-2.1.json")), ""},
+		{"2.0 on the bundle", testBundle(100, `, "spec_version": "2.0"`, ""), ""},
+		{"2.1 on an object", testBundle(99, "", `{"type": "identity", "spec_version": "2.1"}`), ""},
+		{"version not stated", testBundle(100, "", ""), ""},
+		{"odd objects", testBundle(99, "", `[1, 2]`), ""},
+		{"error page", "<html><body>404: Not Found</body></html>", "not valid JSON"},
+		{"truncated", testBundle(150, "", "")[:3000], "not valid JSON"},
+		{"trailing data", testBundle(100, "", "") + "{}", "not valid JSON"},
+		{"not an object", `["bundle"]`, "a JSON array, not an object"},
+		{"wrong type", strings.Replace(testBundle(100, "", ""), `"bundle"`, `"report"`, 1), `type is "report"`},
+		{"STIX 3", testBundle(100, `, "spec_version": "3.0"`, ""), `spec_version is "3.0"`},
+		{"STIX 3 on an object", testBundle(99, "", `{"type": "identity", "spec_version": "3.0"}`), `spec_version is "3.0"`},
+		{"too few objects", testBundle(5, "", ""), "only 5 objects"},
+		{"null objects", `{"type": "bundle", "objects": null}`, "only 0 objects"},
+		{"objects not an array", `{"type": "bundle", "objects": {}}`, "want an array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBundle([]byte(tt.data), "test bundle")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanBundle(t *testing.T) {
+	tricky := `{"type": "identity", "name": "a, [b] {c} \\\"d\\\", e\\\\", "spec_version": "2.1", "x": {"spec_version": "9"}}`
+	tests := []struct {
+		data string
+		want bundleShape
+	}{
+		{testBundle(3, `, "spec_version": "2.0"`, ""), bundleShape{"bundle", "2.0", 3}},
+		{testBundle(3, "", tricky), bundleShape{"bundle", "2.1", 4}},
+		{`{"objects": [], "type": "bundle"}`, bundleShape{"bundle", "", 0}},
+		{`{"objects": [{"objects": [1, 2, 3]}], "x": {"type": "nested"}}`, bundleShape{"", "", 1}},
+	}
+	for _, tt := range tests {
+		got, err := scanBundle([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.data, err)
+		} else if got != tt.want {
+			t.Errorf("%s\n got %+v\nwant %+v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkValidateBundle(b *testing.B) {
+	swap(b, &verbosity, levelError)
+	data := bigBundle(b, 50)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := validateBundle(data, "benchmark bundle"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
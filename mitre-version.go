@@ -0,0 +1,64 @@
+// mitre-version.go
+//
+// Build metadata for -version, the User-Agent and the nGQL header. Release
+// builds set it with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without -ldflags, commit and date come from the VCS stamp Go embeds in
+// binaries built inside a git checkout.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo returns commit and build date, falling back to the embedded
+// VCS stamp; "unknown" when neither is available.
+func buildInfo() (rev, date string) {
+	rev, date = commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok && commit == "" {
+		dirty := false
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				rev = s.Value
+				if len(rev) > 12 {
+					rev = rev[:12]
+				}
+			case "vcs.time":
+				if date == "" {
+					date = s.Value
+				}
+			case "vcs.modified":
+				dirty = s.Value == "true"
+			}
+		}
+		if rev != "" && dirty {
+			rev += "-dirty"
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return rev, date
+}
+
+// versionLine is what -version prints.
+func versionLine() string {
+	rev, date := buildInfo()
+	return fmt.Sprintf("mitremit %s (commit %s, built %s, %s %s/%s)", version, rev, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,248 @@
+// mitre-xlsx.go
+//
+// -xlsx: a minimal Office Open XML workbook written with the standard
+// library only (archive/zip + inline strings), so the tool keeps a single
+// third-party dependency. One sheet per mitigation plus a Summary sheet;
+// every data sheet has a frozen header row and an auto-filter.
+// --------------------------------------------------------------
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xlsxMitigation is the data for one mitigation sheet.
+type xlsxMitigation struct {
+	ID         string
+	Name       string
+	Techniques []techniqueInfo
+}
+
+var xlsxHeader = []string{"Mitigation ID", "Mitigation Name", "Technique ID", "Technique Name", "Tactics", "Sub-technique", "Parent ID", "Platforms"}
+
+// writeXLSX writes the workbook to path atomically.
+func writeXLSX(path string, mits []xlsxMitigation) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return buildXLSX(w, mits)
+	})
+}
+
+func buildXLSX(w io.Writer, mits []xlsxMitigation) error {
+	zw := zip.NewWriter(w)
+
+	sheetNames := []string{"Summary"}
+	for _, m := range mits {
+		sheetNames = append(sheetNames, xlsxSheetName(m.ID, sheetNames))
+	}
+
+	files := map[string]string{
+		"[Content_Types].xml":        xlsxContentTypes(len(sheetNames)),
+		"_rels/.rels":                xlsxRootRels,
+		"xl/workbook.xml":            xlsxWorkbook(sheetNames, mits),
+		"xl/_rels/workbook.xml.rels": xlsxWorkbookRels(len(sheetNames)),
+	}
+
+	// Summary sheet
+	summary := [][]xlsxCell{{xlsxStr("Mitigation ID"), xlsxStr("Mitigation Name"), xlsxStr("Technique Count")}}
+	for _, m := range mits {
+		summary = append(summary, []xlsxCell{xlsxStr(m.ID), xlsxStr(m.Name), xlsxNum(len(m.Techniques))})
+	}
+	files["xl/worksheets/sheet1.xml"] = xlsxSheet(summary)
+
+	// One sheet per mitigation
+	for i, m := range mits {
+		rows := [][]xlsxCell{}
+		header := make([]xlsxCell, len(xlsxHeader))
+		for j, h := range xlsxHeader {
+			header[j] = xlsxStr(h)
+		}
+		rows = append(rows, header)
+
+		for _, t := range m.Techniques {
+			sub, parent := "no", ""
+			if isSubtechnique(t.ExternalID) {
+				sub, parent = "yes", getParentTechniqueID(t.ExternalID)
+			}
+			rows = append(rows, []xlsxCell{
+				xlsxStr(m.ID), xlsxStr(m.Name), xlsxStr(t.ExternalID), xlsxStr(t.Name),
+				xlsxStr(strings.Join(t.Tactics, ", ")), xlsxStr(sub), xlsxStr(parent),
+				xlsxStr(strings.Join(t.Platforms, ", ")),
+			})
+		}
+		files[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+2)] = xlsxSheet(rows)
+	}
+
+	// Write in a stable order
+	order := []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"}
+	for i := range sheetNames {
+		order = append(order, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+	}
+	for _, name := range order {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+/*
+-------------------------------------------------------------
+Cells and sheets
+-------------------------------------------------------------
+*/
+
+type xlsxCell struct {
+	text  string
+	isNum bool
+}
+
+func xlsxStr(s string) xlsxCell { return xlsxCell{text: s} }
+func xlsxNum(n int) xlsxCell    { return xlsxCell{text: fmt.Sprint(n), isNum: true} }
+
+// xlsxCol converts a zero-based column index to its letter name (0 -> A).
+func xlsxCol(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xlsxSheet renders rows with the first one frozen and auto-filtered.
+func xlsxSheet(rows [][]xlsxCell) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+
+	width := 0
+	for r, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := fmt.Sprintf("%s%d", xlsxCol(c), r+1)
+			if cell.isNum {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, cell.text)
+			} else {
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xlsxEscape(cell.text))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+
+	if width > 0 {
+		fmt.Fprintf(&b, `<autoFilter ref="A1:%s%d"/>`, xlsxCol(width-1), len(rows))
+	}
+	b.WriteString(`</worksheet>`)
+	return b.String()
+}
+
+// xlsxSheetName makes a unique, valid (<= 31 chars, no []:*?/\) sheet name.
+func xlsxSheetName(base string, taken []string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, base)
+	if name == "" {
+		name = "Sheet"
+	}
+	if len(name) > 31 {
+		name = name[:31]
+	}
+
+	unique := name
+	for n := 2; ; n++ {
+		clash := false
+		for _, t := range taken {
+			if strings.EqualFold(t, unique) {
+				clash = true
+				break
+			}
+		}
+		if !clash {
+			return unique
+		}
+		suffix := fmt.Sprintf(" (%d)", n)
+		if len(name)+len(suffix) > 31 {
+			unique = name[:31-len(suffix)] + suffix
+		} else {
+			unique = name + suffix
+		}
+	}
+}
+
+/*
+-------------------------------------------------------------
+Package parts
+-------------------------------------------------------------
+*/
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+func xlsxContentTypes(sheets int) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(names []string, mits []xlsxMitigation) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range names {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(name), i+1, i+1)
+	}
+	b.WriteString(`</sheets><definedNames>`)
+
+	// Excel expects a hidden _FilterDatabase name for every auto-filter
+	fmt.Fprintf(&b, `<definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">'%s'!$A$1:$C$%d</definedName>`,
+		xlsxEscape(names[0]), len(mits)+1)
+	for i, m := range mits {
+		fmt.Fprintf(&b, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!$A$1:$%s$%d</definedName>`,
+			i+1, xlsxEscape(strings.ReplaceAll(names[i+1], "'", "''")), xlsxCol(len(xlsxHeader)-1), len(m.Techniques)+1)
+	}
+	b.WriteString(`</definedNames></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(sheets int) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}